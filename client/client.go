@@ -282,11 +282,6 @@ func (c *Client) readAllOK(parsed path.Parsed) error {
 }
 
 func (c *Client) pack(entry *upspin.DirEntry, data []byte, packer upspin.Packer, s *metric.Span) error {
-	// Start the I/O.
-	store, err := bind.StoreServer(c.config, c.config.StoreEndpoint())
-	if err != nil {
-		return err
-	}
 	bp, err := packer.Pack(c.config, entry)
 	if err != nil {
 		return err
@@ -304,14 +299,14 @@ func (c *Client) pack(entry *upspin.DirEntry, data []byte, packer upspin.Packer,
 		}
 		data = data[n:]
 		ss = s.StartSpan("store.Put")
-		refdata, err := store.Put(cipher)
+		refdata, endpoint, err := c.putBlock(cipher)
 		ss.End()
 		if err != nil {
 			return err
 		}
 		bp.SetLocation(
 			upspin.Location{
-				Endpoint:  c.config.StoreEndpoint(),
+				Endpoint:  endpoint,
 				Reference: refdata.Reference,
 			},
 		)
@@ -0,0 +1,88 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"sync"
+	"time"
+
+	"upspin.io/bind"
+	"upspin.io/config"
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// storeFailureInterval is how long a store server that could not be
+// reached is tried only after the config's other store servers.
+// It is a variable so it can be changed in tests.
+var storeFailureInterval = 30 * time.Second
+
+// storeFailures records when each store server last could not be reached.
+var storeFailures = struct {
+	sync.Mutex
+	when map[upspin.Endpoint]time.Time
+}{
+	when: make(map[upspin.Endpoint]time.Time),
+}
+
+// putBlock stores the block on the first of the config's store servers,
+// as listed by config.StoreEndpoints, that accepts it, and returns the
+// endpoint of that server. Servers that could not be reached within the
+// last storeFailureInterval are tried last. Only I/O errors cause the
+// next server to be tried; any other error is returned at once.
+func (c *Client) putBlock(data []byte) (*upspin.Refdata, upspin.Endpoint, error) {
+	eps := config.StoreEndpoints(c.config)
+	if len(eps) == 0 {
+		// Let bind report the problem with the unassigned endpoint.
+		eps = []upspin.Endpoint{c.config.StoreEndpoint()}
+	}
+	var err error
+	for _, e := range storeOrder(eps, time.Now()) {
+		var store upspin.StoreServer
+		store, err = bind.StoreServer(c.config, e)
+		if err == nil {
+			var refdata *upspin.Refdata
+			refdata, err = store.Put(data)
+			if err == nil {
+				markStore(e, false)
+				return refdata, e, nil
+			}
+		}
+		if !errors.Match(errors.E(errors.IO), err) {
+			return nil, e, err
+		}
+		markStore(e, true)
+	}
+	return nil, upspin.Endpoint{}, err
+}
+
+// storeOrder returns the endpoints in the order in which they should be
+// tried at the given time: those that have not failed recently, in their
+// original order, followed by those that have.
+func storeOrder(eps []upspin.Endpoint, now time.Time) []upspin.Endpoint {
+	storeFailures.Lock()
+	defer storeFailures.Unlock()
+	var ok, failed []upspin.Endpoint
+	for _, e := range eps {
+		if t, found := storeFailures.when[e]; found && now.Sub(t) < storeFailureInterval {
+			failed = append(failed, e)
+		} else {
+			ok = append(ok, e)
+		}
+	}
+	return append(ok, failed...)
+}
+
+// markStore records whether the store server at the endpoint
+// could not be reached.
+func markStore(e upspin.Endpoint, failed bool) {
+	storeFailures.Lock()
+	defer storeFailures.Unlock()
+	if failed {
+		storeFailures.when[e] = time.Now()
+	} else {
+		delete(storeFailures.when, e)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"upspin.io/upspin"
+)
+
+func TestStoreOrder(t *testing.T) {
+	a := upspin.Endpoint{Transport: upspin.Remote, NetAddr: "a.example.com:443"}
+	b := upspin.Endpoint{Transport: upspin.Remote, NetAddr: "b.example.com:443"}
+	c := upspin.Endpoint{Transport: upspin.Remote, NetAddr: "c.example.com:443"}
+	eps := []upspin.Endpoint{a, b, c}
+	defer func() {
+		markStore(a, false)
+		markStore(b, false)
+	}()
+
+	now := time.Now()
+	if got := storeOrder(eps, now); !reflect.DeepEqual(got, eps) {
+		t.Errorf("storeOrder with no failures = %v, want %v", got, eps)
+	}
+
+	// Recently failed servers are tried last.
+	markStore(a, true)
+	markStore(b, true)
+	want := []upspin.Endpoint{c, a, b}
+	if got := storeOrder(eps, now); !reflect.DeepEqual(got, want) {
+		t.Errorf("storeOrder after failures = %v, want %v", got, want)
+	}
+
+	// Once the interval has passed, they are tried in order again.
+	if got := storeOrder(eps, now.Add(storeFailureInterval+time.Second)); !reflect.DeepEqual(got, eps) {
+		t.Errorf("storeOrder after interval = %v, want %v", got, eps)
+	}
+
+	// A success clears the failure.
+	markStore(a, false)
+	want = []upspin.Endpoint{a, c, b}
+	if got := storeOrder(eps, now); !reflect.DeepEqual(got, want) {
+		t.Errorf("storeOrder after success = %v, want %v", got, want)
+	}
+}
@@ -33,9 +33,12 @@ The flags are:
 		Make storage cache writethrough.
 	-cachesize=bytes
 		Set the maximum bytes usable for the on disk cache to 'bytes'.
+		If not set, the cache_maxsize value in the config is used,
+		by default 5GB.
 
 Example $HOME/upspin/config entry:
 
 	cache: localhost:9999
+	cache_maxsize: 10GB
 */
 package main // import "upspin.io/cmd/cacheserver"
@@ -27,7 +27,7 @@ import (
 )
 
 var (
-	cacheSizeFlag = flag.Int64("cachesize", 5e9, "max disk `bytes` for cache")
+	cacheSizeFlag = flag.Int64("cachesize", 0, "max disk `bytes` for cache; if zero, the config's cache_maxsize")
 	writethrough  = flag.Bool("writethrough", false, "make storage cache writethrough")
 )
 
@@ -36,7 +36,11 @@ func serve(cfg upspin.Config, addr string) (<-chan error, error) {
 	cfg = config.SetCacheEndpoint(cfg, upspin.Endpoint{})
 
 	// Calculate limits.
-	maxRefBytes := (9 * (*cacheSizeFlag)) / 10
+	cacheSize := *cacheSizeFlag
+	if cacheSize == 0 {
+		cacheSize = config.CacheMaxSize(cfg)
+	}
+	maxRefBytes := (9 * cacheSize) / 10
 	maxLogBytes := maxRefBytes / 9
 
 	sc, blockFlusher, err := storecache.New(cfg, flags.CacheDir, maxRefBytes, *writethrough)
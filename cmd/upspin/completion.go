@@ -0,0 +1,221 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"upspin.io/flags"
+)
+
+func init() {
+	// Registered here, not in the commands map,
+	// because completion itself refers to the map.
+	commands["completion"] = (*State).completion
+}
+
+func (s *State) completion(args ...string) {
+	const help = `
+Completion writes to standard output a script that makes the named
+shell, which must be bash, zsh, or fish, complete the arguments of
+upspin commands: subcommand names, global flags, the flags of each
+subcommand, and Upspin path names that begin with a user name, such
+as ann@example.com/dir/file. Path names are completed by running
+upspin ls on the directory being typed.
+
+For instance, to enable completion in bash, add this line to .bashrc:
+
+	source <(upspin completion bash)
+
+For zsh, add the same line, with zsh in place of bash, to .zshrc.
+For fish, run
+
+	upspin completion fish > ~/.config/fish/completions/upspin.fish
+
+The flags of each subcommand are found by running it with -help,
+which requires a valid configuration; the global flags given to
+upspin completion are passed to those runs.
+`
+	fs := flag.NewFlagSet("completion", flag.ExitOnError)
+	s.ParseFlags(fs, args, help, "completion bash|zsh|fish")
+	if fs.NArg() != 1 {
+		usageAndExit(fs)
+	}
+	shell := fs.Arg(0)
+	switch shell {
+	case "bash", "zsh", "fish":
+	default:
+		s.Exitf("unknown shell %q; must be bash, zsh, or fish", shell)
+	}
+	if err := writeCompletion(os.Stdout, shell, s.completions()); err != nil {
+		s.Exit(err)
+	}
+}
+
+// completions holds the words completed by a completion script.
+type completions struct {
+	commands []string            // Subcommand names, sorted.
+	global   []string            // Global flags, such as "-config".
+	flags    map[string][]string // Flags of each subcommand, by name.
+}
+
+// completions returns the words to complete for this upspin command.
+func (s *State) completions() *completions {
+	c := &completions{
+		commands: commandNames(),
+		flags:    make(map[string][]string),
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		c.global = append(c.global, "-"+f.Name)
+	})
+	for _, name := range c.commands {
+		// As in gendoc, run the command to obtain its help text.
+		var b bytes.Buffer
+		cmd := exec.Command(os.Args[0], append(flags.Args(), name, "-help")...)
+		cmd.Stdout = &b
+		cmd.Stderr = &b
+		cmd.Run() // Exits with status 2 after printing the help.
+		_, lines := splitFlags(b.String())
+		c.flags[name] = flagNames(lines)
+	}
+	return c
+}
+
+// commandNames returns the sorted names of the subcommands that are not
+// hidden, including shell and those installed as separate binaries
+// called "upspin-foo".
+func commandNames() []string {
+	seen := map[string]bool{"shell": true}
+	names := []string{"shell"}
+	for _, name := range append(keys(commands), findUpspinBinaries()...) {
+		if hiddenCommands[name] || seen[name] {
+			continue
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// keys returns the names of the commands in the map.
+func keys(m map[string]func(*State, ...string)) []string {
+	var names []string
+	for name := range m {
+		names = append(names, name)
+	}
+	return names
+}
+
+// flagNames returns the names, with leading hyphen, of the flags described
+// by the lines, which are in the format printed by the flag package.
+func flagNames(lines []string) []string {
+	var names []string
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "  -") {
+			continue
+		}
+		name := strings.TrimPrefix(line, "  ")
+		if i := strings.IndexAny(name, " \t"); i >= 0 {
+			name = name[:i]
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// writeCompletion writes to w the completion script for the named shell.
+func writeCompletion(w io.Writer, shell string, c *completions) error {
+	var b bytes.Buffer
+	switch shell {
+	case "bash":
+		writeBashCompletion(&b, c)
+	case "zsh":
+		// Zsh can run bash completion functions.
+		fmt.Fprintf(&b, "#compdef upspin\n\nautoload -U +X bashcompinit && bashcompinit\n\n")
+		writeBashCompletion(&b, c)
+	case "fish":
+		writeFishCompletion(&b, c)
+	default:
+		return fmt.Errorf("unknown shell %q", shell)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func writeBashCompletion(b *bytes.Buffer, c *completions) {
+	fmt.Fprintf(b, "# Completion for the upspin command; generated by \"upspin completion\".\n\n")
+	fmt.Fprintf(b, "_upspin() {\n")
+	fmt.Fprintf(b, "\tlocal commands=%q\n", strings.Join(c.commands, " "))
+	fmt.Fprintf(b, "\tlocal global=%q\n", strings.Join(c.global, " "))
+	fmt.Fprint(b, `	local cur="${COMP_WORDS[COMP_CWORD]}"
+	local cmd="" i
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		if [[ " $commands " == *" ${COMP_WORDS[i]} "* ]]; then
+			cmd="${COMP_WORDS[i]}"
+			break
+		fi
+	done
+
+	if [[ "$cur" == -* ]]; then
+		local words="$global"
+		case "$cmd" in
+`)
+	for _, name := range c.commands {
+		if len(c.flags[name]) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "\t\t%s) words=%q ;;\n", name, strings.Join(c.flags[name], " "))
+	}
+	fmt.Fprint(b, `		esac
+		COMPREPLY=($(compgen -W "$words" -- "$cur"))
+		return
+	fi
+	if [[ -z "$cmd" ]]; then
+		COMPREPLY=($(compgen -W "$commands" -- "$cur"))
+		return
+	fi
+	if [[ "$cur" == [!@]*@*/* ]]; then
+		# An Upspin path name: list the directory being typed.
+		COMPREPLY=($(compgen -W "$(upspin ls "${cur%/*}/" 2>/dev/null)" -- "$cur"))
+		[[ "${COMPREPLY[0]}" == */ ]] && compopt -o nospace 2>/dev/null
+		return
+	fi
+	COMPREPLY=($(compgen -f -- "$cur"))
+}
+
+complete -F _upspin upspin
+`)
+}
+
+func writeFishCompletion(b *bytes.Buffer, c *completions) {
+	fmt.Fprint(b, `# Completion for the upspin command; generated by "upspin completion".
+
+function __upspin_paths
+	# Complete Upspin path names that begin with a user name.
+	set -l cur (commandline -ct)
+	string match -q -r '^[^@]+@[^/]*/' -- $cur; or return
+	upspin ls (string replace -r '[^/]*$' '' -- $cur) 2>/dev/null
+end
+
+`)
+	fmt.Fprintf(b, "complete -c upspin -n __fish_use_subcommand -x -a %q\n", strings.Join(c.commands, " "))
+	for _, f := range c.global {
+		fmt.Fprintf(b, "complete -c upspin -n __fish_use_subcommand -o %s\n", strings.TrimPrefix(f, "-"))
+	}
+	for _, name := range c.commands {
+		for _, f := range c.flags[name] {
+			fmt.Fprintf(b, "complete -c upspin -n '__fish_seen_subcommand_from %s' -o %s\n", name, strings.TrimPrefix(f, "-"))
+		}
+	}
+	fmt.Fprintf(b, "complete -c upspin -n 'not __fish_use_subcommand' -a '(__upspin_paths)'\n")
+}
@@ -0,0 +1,76 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompletion(t *testing.T) {
+	_, lines := splitFlags(manHelp)
+	if got, want := flagNames(lines), []string{"-R", "-log"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("flagNames = %q, want %q", got, want)
+	}
+
+	c := &completions{
+		commands: commandNames(),
+		global:   []string{"-config", "-log"},
+		flags:    map[string][]string{"cp": {"-R", "-help"}},
+	}
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var b bytes.Buffer
+		if err := writeCompletion(&b, shell, c); err != nil {
+			t.Fatalf("%s: %v", shell, err)
+		}
+		script := b.String()
+		words := strings.FieldsFunc(script, func(r rune) bool {
+			return strings.ContainsRune(" \t\n\"'=();", r)
+		})
+		has := func(word string) bool {
+			for _, w := range words {
+				if w == word {
+					return true
+				}
+			}
+			return false
+		}
+		for name := range commands {
+			if hiddenCommands[name] {
+				continue
+			}
+			if !has(name) {
+				t.Errorf("%s: script does not complete command %q", shell, name)
+			}
+		}
+		for _, word := range []string{"shell", "-config", "-log", "-R", "-help"} {
+			if !has(word) && !has(strings.TrimPrefix(word, "-")) {
+				t.Errorf("%s: script does not complete %q", shell, word)
+			}
+		}
+		if !strings.Contains(script, "upspin ls") {
+			t.Errorf("%s: script does not complete Upspin paths", shell)
+		}
+	}
+	if err := writeCompletion(&bytes.Buffer{}, "csh", c); err == nil {
+		t.Errorf("writeCompletion(csh) succeeded")
+	}
+}
+
+func TestHiddenCommand(t *testing.T) {
+	commands["testhelper"] = (*State).ls
+	hideCommand("testhelper")
+	defer func() {
+		delete(commands, "testhelper")
+		delete(hiddenCommands, "testhelper")
+	}()
+	for _, name := range commandNames() {
+		if name == "testhelper" {
+			t.Errorf("commandNames includes hidden command %q", name)
+		}
+	}
+}
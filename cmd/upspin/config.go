@@ -0,0 +1,220 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"upspin.io/bind"
+	"upspin.io/config"
+	"upspin.io/errors"
+	"upspin.io/flags"
+	"upspin.io/rpc/local"
+	"upspin.io/transports"
+	"upspin.io/upspin"
+)
+
+func (s *State) config(args ...string) {
+	const help = `
+Config displays, checks, or changes the configuration in the file named
+by the global -config flag. The operation is named by the first argument.
+
+Show prints the user name, packing, endpoints, and any other values in
+the configuration, one per line, as key: value pairs. The factotum line
+reports only whether keys are present.
+
+Get prints the value of the named key, as shown by show.
+
+Check verifies that the configuration is well formed and then contacts
+each server it names, printing a line for each reporting whether the
+server could be reached. The key server is asked to look up the user,
+the directory server to look up the user's root, and the store server
+to fetch a block; errors such as the user not being found still show
+that the server is reachable. Each server must respond within the time
+given by the -timeout flag. Check exits with non-zero status if any
+server cannot be reached.
+
+Set changes the value of the named key in the configuration file.
+Only the line holding the key is changed, or a line is added for it;
+comments, included files, and profiles are left as they are, and
+values from the environment are not written to the file. Set refuses to write a configuration that cannot be loaded,
+for instance because the key is unknown or the value is malformed,
+unless the -force flag is given.
+`
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	force := fs.Bool("force", false, "write the configuration even if it cannot be loaded (set only)")
+	timeout := fs.Duration("timeout", 5*time.Second, "time to wait for each server to respond (check only)")
+	var op string
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		op, args = args[0], args[1:]
+	}
+	s.ParseFlags(fs, args, help, "config show | get key | check [-timeout=duration] | set [-force] key value")
+
+	switch {
+	case op == "show" && fs.NArg() == 0:
+		cfg := s.loadConfigFile()
+		configShow(os.Stdout, cfg)
+	case op == "get" && fs.NArg() == 1:
+		cfg := s.loadConfigFile()
+		v, err := configGet(cfg, fs.Arg(0))
+		if err != nil {
+			s.Exit(err)
+		}
+		fmt.Println(v)
+	case op == "check" && fs.NArg() == 0:
+		cfg := s.loadConfigFile()
+		transports.Init(cfg)
+		if !configCheck(os.Stdout, cfg, *timeout) {
+			s.ExitCode = 1
+		}
+	case op == "set" && fs.NArg() == 2:
+		if err := configSet(flags.Config, fs.Arg(0), fs.Arg(1), *force); err != nil {
+			s.Exit(err)
+		}
+	default:
+		usageAndExit(fs)
+	}
+}
+
+// loadConfigFile loads the config file named by the -config flag.
+// A config with no secrets is acceptable.
+func (s *State) loadConfigFile() upspin.Config {
+	cfg, err := config.FromFile(flags.Config)
+	if err != nil && err != config.ErrNoFactotum {
+		s.Exit(err)
+	}
+	return cfg
+}
+
+// configShow writes to w the contents of the config, one key per line,
+// in sorted order.
+func configShow(w io.Writer, cfg upspin.Config) {
+	m := config.ToMap(cfg)
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s: %s\n", k, m[k])
+	}
+}
+
+// configGet returns the value of the key in the config, as shown by configShow.
+func configGet(cfg upspin.Config, key string) (string, error) {
+	v, ok := config.ToMap(cfg)[key]
+	if !ok {
+		return "", errors.E(errors.NotExist, errors.Errorf("no value for key %q", key))
+	}
+	return v, nil
+}
+
+// configCheck validates the config and probes each server it names,
+// writing a status line for each to w. It reports whether all checks
+// passed.
+func configCheck(w io.Writer, cfg upspin.Config, timeout time.Duration) bool {
+	if err := config.Validate(cfg); err != nil {
+		fmt.Fprintf(w, "\u2717 config: %v\n", err)
+		return false
+	}
+	fmt.Fprintf(w, "\u2713 config: valid\n")
+	ok := true
+	servers := []struct {
+		name string
+		ep   upspin.Endpoint
+	}{
+		{"keyserver", cfg.KeyEndpoint()},
+		{"dirserver", cfg.DirEndpoint()},
+		{"storeserver", cfg.StoreEndpoint()},
+		{"cache", cfg.CacheEndpoint()},
+	}
+	for _, srv := range servers {
+		if srv.ep.Transport == upspin.Unassigned {
+			continue
+		}
+		done := make(chan error, 1)
+		go func(name string, ep upspin.Endpoint) {
+			done <- probe(cfg, name, ep, timeout)
+		}(srv.name, srv.ep)
+		var err error
+		select {
+		case err = <-done:
+		case <-time.After(timeout):
+			err = errors.Errorf("no response after %v", timeout)
+		}
+		if err != nil {
+			fmt.Fprintf(w, "\u2717 %s %s: %v\n", srv.name, srv.ep, err)
+			ok = false
+			continue
+		}
+		fmt.Fprintf(w, "\u2713 %s %s: reachable\n", srv.name, srv.ep)
+	}
+	return ok
+}
+
+// probe makes a lightweight request to the named server at the endpoint.
+// It returns an error only if the server could not be reached; errors
+// reported by the server itself show that it is reachable.
+func probe(cfg upspin.Config, name string, ep upspin.Endpoint, timeout time.Duration) error {
+	if name == "cache" {
+		// The cache server is a proxy for the others,
+		// so just check that it is listening.
+		if ep.Transport != upspin.Remote {
+			return nil
+		}
+		d := &local.Dialer{Timeout: timeout}
+		conn, err := d.DialContext(context.Background(), "tcp", string(ep.NetAddr))
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+	if cfg.Factotum() == nil && ep.Transport == upspin.Remote {
+		return errors.E(errors.Invalid, errors.Str("cannot authenticate to remote server without secrets"))
+	}
+	var err error
+	switch name {
+	case "keyserver":
+		key, bindErr := bind.KeyServer(cfg, ep)
+		if bindErr != nil {
+			return bindErr
+		}
+		_, err = key.Lookup(cfg.UserName())
+	case "dirserver":
+		dir, bindErr := bind.DirServer(cfg, ep)
+		if bindErr != nil {
+			return bindErr
+		}
+		_, err = dir.Lookup(upspin.PathName(cfg.UserName() + "/"))
+	case "storeserver":
+		store, bindErr := bind.StoreServer(cfg, ep)
+		if bindErr != nil {
+			return bindErr
+		}
+		_, _, _, err = store.Get(upspin.HTTPBaseMetadata)
+	}
+	if err != nil && errors.Match(errors.E(errors.IO), err) {
+		return err
+	}
+	return nil
+}
+
+// configSet sets the key to the value in the named config file, editing
+// only the line that holds the key. Unless force is set, it returns an
+// error without changing the file if the resulting config cannot be
+// loaded, for instance because the key is unknown.
+func configSet(file, key, value string, force bool) error {
+	err := config.SetFileValue(file, key, value, !force)
+	if err != nil && !force && errors.Match(errors.E(errors.Invalid), err) {
+		return errors.E(errors.Invalid, errors.Errorf("%v (use -force to write anyway)", err))
+	}
+	return err
+}
@@ -0,0 +1,178 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"upspin.io/config"
+	"upspin.io/transports"
+	"upspin.io/upspin"
+)
+
+func TestConfigCommand(t *testing.T) {
+	dir, err := ioutil.TempDir("", "upspin-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config")
+	const orig = "username: ann@example.com\ndirserver: dir.example.com\nsecrets: none\n"
+	if err := ioutil.WriteFile(file, []byte(orig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	load := func() []byte {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	// Show.
+	cfg, err := config.FromFile(file)
+	if err != config.ErrNoFactotum {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	configShow(&b, cfg)
+	for _, want := range []string{
+		"dirserver: remote,dir.example.com:443\n",
+		"factotum: none\n",
+		"username: ann@example.com\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("show output does not contain %q:\n%s", want, b.String())
+		}
+	}
+
+	// Get.
+	if v, err := configGet(cfg, "username"); err != nil || v != "ann@example.com" {
+		t.Errorf("get username = %q, %v; want ann@example.com", v, err)
+	}
+	if _, err := configGet(cfg, "nonesuch"); err == nil {
+		t.Errorf("get nonesuch: got no error")
+	}
+
+	// Set a known key, replacing its value, and add another.
+	if err := configSet(file, "dirserver", "newdir.example.com", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := configSet(file, "storeserver", "store.example.com:8080", false); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err = config.FromFile(file)
+	if err != config.ErrNoFactotum {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"username":    "ann@example.com",
+		"dirserver":   "remote,newdir.example.com:443",
+		"storeserver": "remote,store.example.com:8080",
+	} {
+		if v, err := configGet(cfg, key); err != nil || v != want {
+			t.Errorf("after set: get %s = %q, %v; want %q", key, v, err, want)
+		}
+	}
+
+	// Unknown keys and bad values are rejected, leaving the file unchanged.
+	before := load()
+	for _, kv := range [][2]string{{"nonesuch", "1"}, {"packing", "nonesuch"}, {"dirserver_timeout", "soon"}} {
+		if err := configSet(file, kv[0], kv[1], false); err == nil {
+			t.Errorf("set %s %s: got no error", kv[0], kv[1])
+		}
+		if !bytes.Equal(load(), before) {
+			t.Fatalf("set %s %s changed the file", kv[0], kv[1])
+		}
+	}
+
+	// Unless -force is given.
+	if err := configSet(file, "nonesuch", "1", true); err != nil {
+		t.Fatalf("set -force nonesuch: %v", err)
+	}
+	if !strings.Contains(string(load()), "nonesuch: \"1\"\n") {
+		t.Errorf("set -force did not write key:\n%s", load())
+	}
+
+	// A missing file is an error.
+	if err := configSet(filepath.Join(dir, "missing"), "username", "bob@example.com", false); err == nil {
+		t.Errorf("set in missing file: got no error")
+	}
+}
+
+func TestConfigCheck(t *testing.T) {
+	secrets, err := filepath.Abs("../../key/testdata/user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	load := func(text string) upspin.Config {
+		cfg, err := config.InitConfig(strings.NewReader("username: user1@google.com\nsecrets: " + secrets + "\n" + text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		transports.Init(cfg)
+		return cfg
+	}
+
+	// In-process servers are always reachable.
+	cfg := load("keyserver: inprocess\ndirserver: inprocess\nstoreserver: inprocess\n")
+	var b bytes.Buffer
+	if !configCheck(&b, cfg, 5*time.Second) {
+		t.Errorf("check of in-process servers failed:\n%s", b.String())
+	}
+	for _, want := range []string{
+		"\u2713 config: valid\n",
+		"\u2713 keyserver inprocess: reachable\n",
+		"\u2713 dirserver inprocess: reachable\n",
+		"\u2713 storeserver inprocess: reachable\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, b.String())
+		}
+	}
+
+	// A closed port, and a server that never responds, are not.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	cfg = load("keyserver: inprocess\ndirserver: remote," + closedAddr + "\nstoreserver: remote," + silent.Addr().String() + "\n")
+	b.Reset()
+	if configCheck(&b, cfg, 500*time.Millisecond) {
+		t.Errorf("check of unreachable servers succeeded:\n%s", b.String())
+	}
+	for _, want := range []string{
+		"\u2713 keyserver inprocess: reachable\n",
+		"\u2717 dirserver remote," + closedAddr + ": ",
+		"\u2717 storeserver remote," + silent.Addr().String() + ": no response after 500ms\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("output does not contain %q:\n%s", want, b.String())
+		}
+	}
+
+	// An invalid config is reported without contacting any servers.
+	b.Reset()
+	if configCheck(&b, config.SetDirEndpoint(cfg, upspin.Endpoint{Transport: upspin.Remote}), time.Second) {
+		t.Errorf("check of invalid config succeeded:\n%s", b.String())
+	}
+	if out := b.String(); !strings.HasPrefix(out, "\u2717 config: ") || strings.Count(out, "\n") != 1 {
+		t.Errorf("check of invalid config: got output\n%s", out)
+	}
+}
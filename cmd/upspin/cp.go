@@ -6,6 +6,7 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
@@ -38,10 +39,18 @@ they must be absolute paths or start with '.', '..',  or '~'.
 When copying from one Upspin path to another Upspin path, cp can be
 very efficient, copying only the references to the data rather than
 the data itself.
+
+The -on-conflict flag controls what happens when a destination file
+already exists. By default (fail), cp reports an error for that file
+and exits with non-zero status after attempting the remaining copies.
+With skip, the file is not copied; with overwrite, the existing file
+is replaced; with rename, the copy is written to the first unused name
+formed by appending .1, .2, and so on to the destination name.
 `
 	fs := flag.NewFlagSet("cp", flag.ExitOnError)
 	fs.Bool("v", false, "log each file as it is copied")
 	fs.Bool("R", false, "recursively copy directories")
+	fs.String("on-conflict", "fail", "`action` when a destination file exists: fail, skip, overwrite, or rename")
 	s.ParseFlags(fs, args, help, "cp [opts] file... file or cp [opts] file... directory")
 
 	var err error
@@ -53,10 +62,17 @@ the data itself.
 	}
 
 	cs := &copyState{
-		state:   s,
-		flagSet: fs,
-		recur:   subcmd.BoolFlag(fs, "R"),
-		verbose: subcmd.BoolFlag(fs, "v"),
+		state:      s,
+		flagSet:    fs,
+		recur:      subcmd.BoolFlag(fs, "R"),
+		verbose:    subcmd.BoolFlag(fs, "v"),
+		onConflict: subcmd.StringFlag(fs, "on-conflict"),
+	}
+	switch cs.onConflict {
+	case "fail", "skip", "overwrite", "rename":
+	default:
+		s.Failf("invalid -on-conflict action %q", cs.onConflict)
+		usageAndExit(fs)
 	}
 
 	// Do all the glob processing here.
@@ -76,10 +92,11 @@ the data itself.
 }
 
 type copyState struct {
-	state   *State
-	flagSet *flag.FlagSet // Used only to call Usage.
-	verbose bool
-	recur   bool
+	state      *State
+	flagSet    *flag.FlagSet // Used only to call Usage.
+	verbose    bool
+	recur      bool
+	onConflict string // One of "fail", "skip", "overwrite", or "rename".
 }
 
 func (c *copyState) logf(format string, args ...interface{}) {
@@ -166,10 +183,13 @@ func (s *State) copyToDir(cs *copyState, src []cpFile, dir cpFile) {
 	for _, from := range src {
 		dstPath := path.Join(upspin.PathName(dir.path), filepath.Base(from.path))
 		if dir.isUpspin && from.isUpspin {
-			// Try a fast copy. It can fail but that's OK.
-			cs.logf("try fast copy to %s", dstPath)
-			if s.fastCopy(upspin.PathName(from.path), dstPath) == nil {
-				continue
+			// Try a fast copy if the destination is known not to exist.
+			// It can fail but that's OK.
+			if ok, err := s.exists(cpFile{path: string(dstPath), isUpspin: true}); err == nil && !ok {
+				cs.logf("try fast copy to %s", dstPath)
+				if s.fastCopy(upspin.PathName(from.path), dstPath) == nil {
+					continue
+				}
 			}
 		}
 		reader, err := s.open(from)
@@ -216,6 +236,11 @@ func (s *State) copyToDir(cs *copyState, src []cpFile, dir cpFile) {
 
 // copyToFile copies the source to the destination. The source file has already been opened.
 func (s *State) copyToFile(cs *copyState, reader io.ReadCloser, src, dst cpFile) {
+	dst, ok := cs.resolveConflict(dst)
+	if !ok {
+		reader.Close()
+		return
+	}
 	cs.logf("start cp %s %s", src.path, dst.path)
 	defer cs.logf("end cp %s %s", src.path, dst.path)
 	// If both are in Upspin, we can avoid touching the data by copying
@@ -236,6 +261,62 @@ func (s *State) copyToFile(cs *copyState, reader io.ReadCloser, src, dst cpFile)
 	cs.doCopy(reader, writer)
 }
 
+// resolveConflict applies the -on-conflict action if the destination
+// already exists. It returns the file to write, which may differ from
+// dst if the action is rename, and whether the copy should proceed.
+func (cs *copyState) resolveConflict(dst cpFile) (cpFile, bool) {
+	s := cs.state
+	ok, err := s.exists(dst)
+	if err != nil {
+		s.Fail(err)
+		return dst, false
+	}
+	if !ok {
+		return dst, true
+	}
+	switch cs.onConflict {
+	case "skip":
+		cs.logf("skipping %s: file exists", dst.path)
+		return dst, false
+	case "overwrite":
+		return dst, true
+	case "rename":
+		for i := 1; ; i++ {
+			renamed := dst
+			renamed.path = fmt.Sprintf("%s.%d", dst.path, i)
+			ok, err := s.exists(renamed)
+			if err != nil {
+				s.Fail(err)
+				return dst, false
+			}
+			if !ok {
+				cs.logf("copying to %s: %s exists", renamed.path, dst.path)
+				return renamed, true
+			}
+		}
+	}
+	s.Failf("%s already exists; use -on-conflict to skip, overwrite, or rename", dst.path)
+	return dst, false
+}
+
+// exists reports whether the file exists either in Upspin
+// or in the local file system. An error other than one saying
+// the file does not exist is returned, as the answer is unknown.
+func (s *State) exists(cf cpFile) (bool, error) {
+	if cf.isUpspin {
+		_, err := s.Client.Lookup(upspin.PathName(cf.path), false)
+		if errors.Match(errNotExist, err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	_, err := os.Lstat(cf.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
 // fastCopy copies the source to the destination using the references rather than the data.
 // If it fails, PutDuplicate failed because the file exists or the source is a directory.
 // (Any other error is unexpected and exits the copy command.)
@@ -0,0 +1,65 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestResolveConflict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"exists", "exists.1"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	missing := cpFile{path: filepath.Join(dir, "missing")}
+	exists := cpFile{path: filepath.Join(dir, "exists")}
+
+	type conflictTest struct {
+		onConflict string
+		dst        cpFile
+		wantPath   string
+		wantOK     bool
+		wantExit   int
+	}
+	tests := []conflictTest{
+		{"fail", missing, missing.path, true, 0},
+		{"fail", exists, exists.path, false, 1},
+		{"skip", exists, exists.path, false, 0},
+		{"overwrite", exists, exists.path, true, 0},
+		{"rename", exists, exists.path + ".2", true, 0},
+	}
+	if runtime.GOOS != "windows" {
+		// Whether a file within a regular file exists cannot be known.
+		// (On Windows, such a file is reported not to exist.)
+		unknown := cpFile{path: filepath.Join(dir, "exists", "file")}
+		tests = append(tests,
+			conflictTest{"overwrite", unknown, unknown.path, false, 1},
+			conflictTest{"rename", unknown, unknown.path, false, 1},
+		)
+	}
+	for _, test := range tests {
+		cs := &copyState{
+			state:      newState("cp"),
+			onConflict: test.onConflict,
+		}
+		got, ok := cs.resolveConflict(test.dst)
+		if got.path != test.wantPath || ok != test.wantOK {
+			t.Errorf("%s %s: got (%q, %t), want (%q, %t)", test.onConflict, test.dst.path, got.path, ok, test.wantPath, test.wantOK)
+		}
+		if cs.state.ExitCode != test.wantExit {
+			t.Errorf("%s %s: exit code %d, want %d", test.onConflict, test.dst.path, cs.state.ExitCode, test.wantExit)
+		}
+	}
+}
@@ -47,14 +47,13 @@ Usage of upspin:
 	upspin [globalflags] <command> [flags] <path>
 Upspin commands:
 	shell (Interactive mode)
+	completion
+	config
 	countersign
 	cp
 	deletestorage
-	deploy
-	deploy-gcp
 	get
 	getref
-	github
 	info
 	keygen
 	link
@@ -64,15 +63,16 @@ Upspin commands:
 	repack
 	rm
 	rotate
+	server
 	setupdomain
 	setupserver
 	setupstorage
-	setupstorage-gcp
 	setupwriters
 	share
 	signup
 	snapshot
 	tar
+	untar
 	user
 	watch
 	whichaccess
@@ -85,12 +85,83 @@ Global flags:
     	user's configuration file (default "/home/user/upspin/config")
   -log level
     	level of logging: debug, info, error, disabled (default info)
+  -no-key-cache
+    	disable the on-disk cache of key server lookups
   -prudent
     	protect against malicious directory server
   -writethrough
     	make storage cache writethrough
 
 
+Sub-command completion
+
+Usage: upspin completion bash|zsh|fish
+
+Completion writes to standard output a script that makes the named
+shell, which must be bash, zsh, or fish, complete the arguments of
+upspin commands: subcommand names, global flags, the flags of each
+subcommand, and Upspin path names that begin with a user name, such
+as ann@example.com/dir/file. Path names are completed by running
+upspin ls on the directory being typed.
+
+For instance, to enable completion in bash, add this line to .bashrc:
+
+	source <(upspin completion bash)
+
+For zsh, add the same line, with zsh in place of bash, to .zshrc.
+For fish, run
+
+	upspin completion fish > ~/.config/fish/completions/upspin.fish
+
+The flags of each subcommand are found by running it with -help,
+which requires a valid configuration; the global flags given to
+upspin completion are passed to those runs.
+
+Flags:
+  -help
+    	print more information about the command
+
+
+
+Sub-command config
+
+Usage: upspin config show | get key | check [-timeout=duration] | set [-force] key value
+
+Config displays, checks, or changes the configuration in the file named
+by the global -config flag. The operation is named by the first argument.
+
+Show prints the user name, packing, endpoints, and any other values in
+the configuration, one per line, as key: value pairs. The factotum line
+reports only whether keys are present.
+
+Get prints the value of the named key, as shown by show.
+
+Check verifies that the configuration is well formed and then contacts
+each server it names, printing a line for each reporting whether the
+server could be reached. The key server is asked to look up the user,
+the directory server to look up the user's root, and the store server
+to fetch a block; errors such as the user not being found still show
+that the server is reachable. Each server must respond within the time
+given by the -timeout flag. Check exits with non-zero status if any
+server cannot be reached.
+
+Set changes the value of the named key in the configuration file.
+Only the line holding the key is changed, or a line is added for it;
+comments, included files, and profiles are left as they are, and
+values from the environment are not written to the file. Set refuses to write a configuration that cannot be loaded,
+for instance because the key is unknown or the value is malformed,
+unless the -force flag is given.
+
+Flags:
+  -force
+    	write the configuration even if it cannot be loaded (set only)
+  -help
+    	print more information about the command
+  -timeout duration
+    	time to wait for each server to respond (check only) (default 5s)
+
+
+
 Sub-command countersign
 
 Usage: upspin countersign
@@ -127,10 +198,19 @@ When copying from one Upspin path to another Upspin path, cp can be
 very efficient, copying only the references to the data rather than
 the data itself.
 
+The -on-conflict flag controls what happens when a destination file
+already exists. By default (fail), cp reports an error for that file
+and exits with non-zero status after attempting the remaining copies.
+With skip, the file is not copied; with overwrite, the existing file
+is replaced; with rename, the copy is written to the first unused name
+formed by appending .1, .2, and so on to the destination name.
+
 Flags:
   -R	recursively copy directories
   -help
     	print more information about the command
+  -on-conflict action
+    	action when a destination file exists: fail, skip, overwrite, or rename (default "fail")
   -v	log each file as it is copied
 
 
@@ -384,6 +464,66 @@ Flags:
 
 
 
+Sub-command server
+
+Usage: upspin server migrate -from-config=file -to-config=file [-dry-run] [path...]
+       upspin server list-users -server=address [-since=duration] [-json]
+
+Server performs administrative operations on Upspin servers.
+The operation is named by the first argument: migrate or list-users.
+
+Migrate moves the directory trees rooted at the named paths from one
+server deployment to another. The source and destination are each
+described by a config file, given by the -from-config and -to-config
+flags; the directory and store servers named in those configs are
+used. If no paths are named, the root of the user in the source
+config is moved.
+
+Every directory entry in the trees is copied to the destination
+directory server, and every block it references is copied to the
+destination store server. Each copied block is read back from the
+destination and its hash is compared with that of the original.
+Access files are copied last, so they cannot prevent the copying
+of other entries. Links are copied as links; their targets are not
+followed. Directories that already exist on the destination are
+reused. Once every entry has been copied and verified, the entries
+are removed from the source directory server. The blocks are
+left on the source store servers, as they may be referenced from
+elsewhere, such as by snapshots; use deletestorage to remove them.
+
+Migrate refuses to start if any entry in the trees is incomplete,
+that is, if the user of the source config may list it but not read
+it, as its blocks could not be copied.
+
+With -dry-run, migrate just reports the number of entries and blocks
+and the amount of data that would be copied.
+
+List-users asks the server at the address given by the -server flag
+for the users who have made authenticated requests to it since it
+started, with the number of requests each has made and the time of the
+most recent one. Only the user running the server may ask. The -since
+flag restricts the list to users seen within the given duration, such
+as 12h or 7d. With -json, the list is printed as JSON.
+
+Flags:
+  -dry-run
+    	report what would be migrated without changing anything
+  -from-config file
+    	configuration file for the source servers
+  -help
+    	print more information about the command
+  -json
+    	print the users as JSON (list-users only)
+  -server address
+    	address of the server (list-users only)
+  -since duration
+    	list only users seen within this duration (list-users only)
+  -to-config file
+    	configuration file for the destination servers
+  -v	log each entry as it is migrated
+
+
+
 Sub-command setupdomain
 
 Usage: upspin setupdomain [-where=$HOME/upspin/deploy] [-cluster] -domain=<name>
@@ -614,6 +754,7 @@ Flags:
 Sub-command tar
 
 Usage: upspin tar [-extract [-match prefix -replace substitution] ] upspin_directory local_file
+              tar upspin_archive local_directory
 
 Tar archives an Upspin tree into a local tar file, or with the
 -extract flag, unpacks a a local tar file into an Upspin tree.
@@ -623,6 +764,15 @@ file to have any prefix that matches be replaced by substitute text.
 Whether or not these flags are used, the destination path must
 always be in Upspin.
 
+If the first argument is an Upspin file and the second is an existing
+local directory, tar instead packs the local directory into an archive
+stored in the Upspin file, without creating a local copy. The archive is
+built in memory and stored only once it is complete, so if packing fails
+an existing file of that name is left unchanged. The archive is compressed
+according to the suffix of the Upspin file name: .tar (no compression),
+.tar.gz or .tgz (gzip). Use upspin untar to unpack such an archive into
+a local directory.
+
 Flags:
   -extract
     	extract from archive
@@ -636,6 +786,28 @@ Flags:
 
 
 
+Sub-command untar
+
+Usage: upspin untar upspin_archive local_directory
+
+Untar fetches an archive stored in Upspin and unpacks it into a local
+directory, which is created if it does not exist. The archive is read
+directly from Upspin, without first creating a local copy.
+
+The archive is decompressed according to the suffix of its name:
+.tar (no compression), .tar.gz or .tgz (gzip), or .tar.bz2 (bzip2).
+
+Untar refuses to write outside the directory: it rejects entries whose
+names lead outside it, symbolic links whose targets are absolute or lie
+outside it, and entries that would be written through a symbolic link.
+
+Flags:
+  -help
+    	print more information about the command
+  -v	verbose output
+
+
+
 Sub-command user
 
 Usage: upspin user [username...]
@@ -0,0 +1,58 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// checkDoc compares the named documentation file with the generated
+// contents, ignoring differences in line endings. If they differ, it
+// returns an error showing the first line that does and the number of
+// lines in each.
+// It is used by gendoc -check.
+func checkDoc(file string, generated []byte) error {
+	old, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	oldLines := docLines(old)
+	newLines := docLines(generated)
+	line := func(lines []string, i int) string {
+		if i < len(lines) {
+			return lines[i]
+		}
+		return "(end of file)"
+	}
+	for i := 0; i < len(oldLines) || i < len(newLines); i++ {
+		o, g := line(oldLines, i), line(newLines, i)
+		if o == g && i < len(oldLines) && i < len(newLines) {
+			continue
+		}
+		return fmt.Errorf("%s is out of date; run 'go generate' to update it.\n"+
+			"First difference at line %d:\n-%s\n+%s\n"+
+			"%s has %d lines; the generated file has %d.",
+			file, i+1, o, g, file, len(oldLines), len(newLines))
+	}
+	return nil
+}
+
+// docLines splits the data into lines, normalizing line endings.
+func docLines(data []byte) []string {
+	data = bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1)
+	return toLines(string(data))
+}
+
+func toLines(data string) []string {
+	lines := strings.Split(data, "\n")
+	// Last line will be an empty slice after the final newline; delete it.
+	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		return lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,121 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDocUpToDate builds the upspin command with the gendoc tag, as
+// mkdoc.sh does for go generate, and checks that doc.go matches the
+// documentation it generates.
+func TestDocUpToDate(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping build of gendoc in short mode")
+	}
+	dir, err := ioutil.TempDir("", "upspin-gendoc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	gendoc := filepath.Join(dir, "upspin.gendoc")
+	build := func(args ...string) {
+		cmd := exec.Command("go", append([]string{"build"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go build %s: %v\n%s", strings.Join(args, " "), err, out)
+		}
+	}
+	build("-tags", "gendoc", "-o", gendoc, ".")
+	// The documentation of setupstorage comes from the separate command.
+	build("-o", filepath.Join(dir, "upspin-setupstorage"), "../upspin-setupstorage")
+
+	// Run in a fresh Upspin directory with a minimal config, and with
+	// only the commands just built in the path, so the output does not
+	// depend on the user's configuration or installed commands.
+	home := filepath.Join(dir, "upspin")
+	if err := os.Mkdir(home, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(home, "config"), []byte("secrets: none\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	env := []string{"PATH=" + dir, "UPSPIN_HOME=" + home}
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "PATH=") && !strings.HasPrefix(kv, "UPSPIN_HOME=") {
+			env = append(env, kv)
+		}
+	}
+	cmd := exec.Command(gendoc, "gendoc", "-check")
+	cmd.Env = env
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Errorf("gendoc -check: %v\n%s", err, out)
+	}
+}
+
+// TestCheckDoc exercises the comparison made by gendoc -check.
+func TestCheckDoc(t *testing.T) {
+	generated, err := ioutil.ReadFile("doc.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "upspin-doc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "doc.go")
+	write := func(data []byte) {
+		if err := ioutil.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(generated)
+	if err := checkDoc(file, generated); err != nil {
+		t.Errorf("unchanged doc.go: %v", err)
+	}
+
+	// Line endings do not matter.
+	write(bytes.Replace(generated, []byte("\n"), []byte("\r\n"), -1))
+	if err := checkDoc(file, generated); err != nil {
+		t.Errorf("doc.go with CRLF line endings: %v", err)
+	}
+
+	// A stale file is reported, without being changed.
+	stale := bytes.Replace(generated, []byte("Sub-command ls"), []byte("Sub-command lx"), 1)
+	write(stale)
+	err = checkDoc(file, generated)
+	if err == nil {
+		t.Fatal("stale doc.go: got no error")
+	}
+	if !strings.Contains(err.Error(), "-Sub-command lx\n+Sub-command ls") {
+		t.Errorf("stale doc.go: error does not show the difference: %v", err)
+	}
+	n := len(docLines(generated))
+	if want := fmt.Sprintf("has %d lines; the generated file has %d", n, n); !strings.Contains(err.Error(), want) {
+		t.Errorf("stale doc.go: error does not give the line counts: %v", err)
+	}
+	if data, _ := ioutil.ReadFile(file); !bytes.Equal(data, stale) {
+		t.Errorf("checkDoc modified the file")
+	}
+
+	// A truncated file is reported.
+	write(generated[:len(generated)/2])
+	if err := checkDoc(file, generated); err == nil {
+		t.Errorf("truncated doc.go: got no error")
+	}
+
+	write(generated)
+	if err := checkDoc(file, generated); err != nil {
+		t.Errorf("restored doc.go: %v", err)
+	}
+}
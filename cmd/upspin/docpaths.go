@@ -0,0 +1,56 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	osuser "os/user"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// anonymizePaths returns the line with the user's home directory, and any
+// path element naming the user, replaced by placeholders appropriate to
+// the operating system, so that generated documentation does not depend
+// on who generated it.
+func anonymizePaths(line, home string) string {
+	var username string
+	if u, err := osuser.Current(); err == nil {
+		username = u.Username
+		// On Windows the name may include the domain.
+		if i := strings.LastIndex(username, `\`); i >= 0 {
+			username = username[i+1:]
+		}
+	}
+	return anonymizePathsFor(runtime.GOOS, line, home, username)
+}
+
+// anonymizePathsFor implements anonymizePaths for the given
+// operating system and user name.
+func anonymizePathsFor(goos, line, home, username string) string {
+	placeholder := "/home/user"
+	switch goos {
+	case "windows":
+		placeholder = `C:\Users\user`
+	case "darwin":
+		placeholder = "/Users/user"
+	}
+	if home != "" {
+		line = strings.Replace(line, home, placeholder, -1)
+	}
+	if username != "" && username != "user" {
+		// Replace the name only where it is a complete path element.
+		re := regexp.MustCompile(`([/\\])` + regexp.QuoteMeta(username) + `([/\\]|$|[^\w.-])`)
+		// Matches may overlap at a separator, so repeat until done.
+		for {
+			l := re.ReplaceAllString(line, "${1}user${2}")
+			if l == line {
+				break
+			}
+			line = l
+		}
+	}
+	return line
+}
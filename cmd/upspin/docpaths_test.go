@@ -0,0 +1,54 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnonymizePaths(t *testing.T) {
+	tests := []struct {
+		goos, home, line, want string
+	}{
+		{
+			"linux", "/home/ann",
+			`directory (default "/home/ann/upspin/deploy")`,
+			`directory (default "/home/user/upspin/deploy")`,
+		},
+		{
+			"darwin", "/Users/ann",
+			`file (default "/Users/ann/upspin/config")`,
+			`file (default "/Users/user/upspin/config")`,
+		},
+		{
+			"windows", `C:\Users\ann`,
+			`file (default "C:\Users\ann\upspin\config")`,
+			`file (default "C:\Users\user\upspin\config")`,
+		},
+		{
+			// A home directory in a non-standard place, with
+			// the user name appearing elsewhere in a path.
+			"linux", "/export/ann",
+			`dir (default "/export/ann/upspin") cache "/var/cache/ann/upspin" or /tmp/ann`,
+			`dir (default "/home/user/upspin") cache "/var/cache/user/upspin" or /tmp/user`,
+		},
+		{
+			// The name is not replaced in ordinary text.
+			"linux", "/home/ann",
+			"planning: ann's annual plan",
+			"planning: ann's annual plan",
+		},
+	}
+	for _, test := range tests {
+		got := anonymizePathsFor(test.goos, test.line, test.home, "ann")
+		if got != test.want {
+			t.Errorf("%s: anonymizePaths(%q) = %q, want %q", test.goos, test.line, got, test.want)
+		}
+		if strings.Contains(got, test.home) {
+			t.Errorf("%s: output %q contains home directory %q", test.goos, got, test.home)
+		}
+	}
+}
@@ -8,14 +8,19 @@ package main
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
-	"go/format"
+	"go/parser"
+	"go/token"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"sort"
 	"strings"
+
+	"upspin.io/config"
 )
 
 // externalCommands lists the commands that are considered part of
@@ -27,6 +32,7 @@ var externalCommands = []string{
 
 func init() {
 	commands["gendoc"] = (*State).gendoc
+	hideCommand("gendoc")
 }
 
 const docHeader = `// Copyright 2017 The Upspin Authors. All rights reserved.
@@ -42,9 +48,23 @@ const docHeader = `// Copyright 2017 The Upspin Authors. All rights reserved.
 var flagDocs []string
 
 func (s *State) gendoc(args ...string) {
+	fs := flag.NewFlagSet("gendoc", flag.ExitOnError)
+	check := fs.Bool("check", false, "report whether the output file is up to date, without writing it")
+	outFormat := fs.String("format", "go", "output `format`: go (writes doc.go), markdown (writes COMMANDS.md), or man (writes man/man1/*.1)")
+	fs.Parse(args)
+	switch *outFormat {
+	case "go", "markdown":
+	case "man":
+		if *check {
+			s.Exitf("-check is not supported with -format=man")
+		}
+	default:
+		usageAndExit(fs)
+	}
+
 	var names []string
 	for name := range commands {
-		if name == "gendoc" {
+		if hiddenCommands[name] {
 			continue
 		}
 		names = append(names, name)
@@ -52,36 +72,63 @@ func (s *State) gendoc(args ...string) {
 	names = append(names, externalCommands...)
 	sort.Strings(names)
 
-	var b bytes.Buffer
-
-	fmt.Fprintln(&b, docHeader)
-
-	// Generate package doc followed by flags.
+	// Generate package doc.
 	upspin := os.Args[0]
-	s.helpDocs(&b, upspin)
+	var intro bytes.Buffer
+	s.helpDocs(&intro, upspin)
 
 	// Generate the flag output and also remember it for filtering subcommand help.
-	var tmp bytes.Buffer
-	s.helpDocs(&tmp, upspin, "-help")
-	b.Write(tmp.Bytes())
-	flagDocs = toLines(tmp.String())
+	var global bytes.Buffer
+	s.helpDocs(&global, upspin, "-help")
+	flagDocs = toLines(global.String())
 
 	// Generate subcommands.
+	docs := make(map[string]string)
 	for _, name := range names {
 		s.getCommand(name) // Make sure command exists; this will error and exit if not.
-		var docs bytes.Buffer
-		s.helpDocs(&docs, upspin, name, "-help")
+		var b bytes.Buffer
+		s.helpDocs(&b, upspin, name, "-help")
+		if !hasHelpText(b.String()) {
+			s.Exitf("command %q has no help text; write some before generating the documentation", name)
+		}
+		docs[name] = b.String()
+	}
 
-		fmt.Fprintf(&b, "\n\nSub-command %s\n\n", name)
-		fmt.Fprintf(&b, "%s\n", docs.Bytes())
+	var b bytes.Buffer
+	var out []byte
+	file := "doc.go"
+	switch *outFormat {
+	case "go":
+		fmt.Fprintln(&b, docHeader)
+		b.Write(intro.Bytes())
+		b.Write(global.Bytes())
+		for _, name := range names {
+			fmt.Fprintf(&b, "\n\nSub-command %s\n\n", name)
+			fmt.Fprintf(&b, "%s\n", docs[name])
+		}
+		fmt.Fprintln(&b, "*/\npackage main")
+		// Check that the output is valid Go, but do not gofmt it:
+		// gofmt's rewriting of doc comments varies between releases.
+		out = b.Bytes()
+		if _, err := parser.ParseFile(token.NewFileSet(), file, out, parser.PackageClauseOnly); err != nil {
+			s.Exit(err)
+		}
+	case "markdown":
+		file = "COMMANDS.md"
+		writeMarkdown(&b, names, intro.String(), global.String(), docs)
+		out = b.Bytes()
+	case "man":
+		s.writeManPages(names, intro.String(), global.String(), docs)
+		return
 	}
-	fmt.Fprintln(&b, "*/\npackage main")
 
-	out, err := format.Source(b.Bytes())
-	if err != nil {
-		s.Exit(err)
+	if *check {
+		if err := checkDoc(file, out); err != nil {
+			s.Exit(err)
+		}
+		return
 	}
-	err = ioutil.WriteFile("doc.go", out, 0644)
+	err := ioutil.WriteFile(file, out, 0644)
 	if err != nil {
 		s.Exit(err)
 	}
@@ -100,6 +147,11 @@ func (s *State) helpDocs(out io.Writer, command string, args ...string) {
 	// "upspin -help", saved above.
 	// This method isn't the cheapest, but it's easy.
 	home := os.Getenv("HOME")
+	if home == "" {
+		home, _ = config.Homedir()
+	}
+	// Defaults within $UPSPIN_HOME are shown as within $HOME/upspin.
+	upspinHome := os.Getenv("UPSPIN_HOME")
 	lines := toLines(b.String())
 Without:
 	for _, line := range lines {
@@ -112,16 +164,32 @@ Without:
 				continue Without
 			}
 		}
-		line = strings.Replace(line, home, "/home/user", -1)
+		if upspinHome != "" {
+			line = strings.Replace(line, upspinHome, filepath.Join(home, "upspin"), -1)
+		}
+		line = anonymizePaths(line, home)
 		fmt.Fprintf(out, "%s\n", line)
 	}
 }
 
-func toLines(data string) []string {
-	lines := strings.Split(data, "\n")
-	// Last line will be an empty slice after the final newline; delete it.
-	if len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
-		return lines[:len(lines)-1]
+// writeManPages writes the manual pages for the upspin command and
+// each of its subcommands into the directory man/man1.
+func (s *State) writeManPages(names []string, intro, global string, docs map[string]string) {
+	const dir = "man/man1"
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		s.Exit(err)
+	}
+	write := func(name, body string, flags []string) {
+		var b bytes.Buffer
+		writeManPage(&b, name, body, flags)
+		if err := ioutil.WriteFile(filepath.Join(dir, name+".1"), b.Bytes(), 0644); err != nil {
+			s.Exit(err)
+		}
+	}
+	_, flags := splitFlags(global)
+	write("upspin", intro, flags)
+	for _, name := range names {
+		body, flags := splitFlags(docs[name])
+		write("upspin-"+name, body, flags)
 	}
-	return lines
 }
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"sort"
 	"strings"
 
@@ -22,6 +23,7 @@ import (
 	"upspin.io/cmd/cacheserver/cacheutil"
 	"upspin.io/config"
 	"upspin.io/flags"
+	"upspin.io/key/usercache"
 	"upspin.io/metric"
 	"upspin.io/subcmd"
 
@@ -72,6 +74,7 @@ For a list of available subcommands and global flags, run
 `
 
 var commands = map[string]func(*State, ...string){
+	"config":        (*State).config,
 	"countersign":   (*State).countersign,
 	"cp":            (*State).cp,
 	"deletestorage": (*State).deletestorage,
@@ -85,6 +88,7 @@ var commands = map[string]func(*State, ...string){
 	"put":           (*State).put,
 	"repack":        (*State).repack,
 	"rotate":        (*State).rotate,
+	"server":        (*State).server,
 	"rm":            (*State).rm,
 	"setupdomain":   (*State).setupdomain,
 	"setupserver":   (*State).setupserver,
@@ -93,11 +97,24 @@ var commands = map[string]func(*State, ...string){
 	"signup":        (*State).signup,
 	"snapshot":      (*State).snapshot,
 	"tar":           (*State).tar,
+	"untar":         (*State).untar,
 	"user":          (*State).user,
 	"watch":         (*State).watch,
 	"whichaccess":   (*State).whichAccess,
 }
 
+// hiddenCommands holds the names of commands that are not shown in usage
+// messages, shell completions, or the generated documentation, such as
+// those used only in development or testing. Commands are added to it
+// by hideCommand.
+var hiddenCommands = map[string]bool{}
+
+// hideCommand hides the named command; see hiddenCommands.
+// It should be called from an init function.
+func hideCommand(name string) {
+	hiddenCommands[name] = true
+}
+
 type State struct {
 	*subcmd.State
 	sharer       *Sharer
@@ -108,7 +125,7 @@ func main() {
 	log.SetFlags(0)
 	log.SetPrefix("upspin: ")
 	flag.Usage = usage
-	flags.Parse(flags.Client)
+	flags.Parse(flags.Client, "no-key-cache")
 
 	if len(flag.Args()) < 1 {
 		fmt.Fprintln(os.Stderr, intro)
@@ -159,8 +176,8 @@ func printCommands() {
 	fmt.Fprintf(os.Stderr, "Upspin commands:\n")
 	var cmdStrs []string
 	for cmd := range commands {
-		if cmd == "gendoc" {
-			continue // never show this in usage
+		if hiddenCommands[cmd] {
+			continue // never show these in usage
 		}
 		cmdStrs = append(cmdStrs, cmd)
 	}
@@ -226,11 +243,19 @@ func newState(name string) *State {
 func (s *State) init() {
 	// signup is special since there is no user yet.
 	// keygen simply does not require a config or anything else.
-	if s.Name != "signup" && s.Name != "keygen" {
+	// config loads the config itself, so it can report on any problems.
+	// completion needs only the names of the commands and their flags.
+	if s.Name != "signup" && s.Name != "keygen" && s.Name != "config" && s.Name != "completion" {
 		cfg, err := config.FromFile(flags.Config)
 		if err != nil && err != config.ErrNoFactotum {
 			s.Exit(err)
 		}
+		if !flags.NoKeyCache {
+			err := usercache.EnableDiskCache(filepath.Join(flags.CacheDir, "keycache"))
+			if err != nil {
+				log.Printf("not using key cache: %v", err)
+			}
+		}
 		transports.Init(cfg)
 		s.State.Init(cfg)
 		s.sharer = newSharer(s)
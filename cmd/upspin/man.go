@@ -0,0 +1,143 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// splitFlags splits the help text of a command into the body, holding the
+// usage line and description, and the lines describing its flags, which
+// follow a line reading "Flags:" or "Usage of ...:".
+func splitFlags(text string) (body string, flags []string) {
+	lines := toLines(text)
+	for i, line := range lines {
+		if line == "Flags:" || strings.HasPrefix(line, "Usage of ") && strings.HasSuffix(line, ":") {
+			return strings.Join(lines[:i], "\n"), lines[i+1:]
+		}
+	}
+	return text, nil
+}
+
+// hasHelpText reports whether the help text of a command, as split by
+// splitFlags, describes the command, rather than holding just its usage
+// line.
+func hasHelpText(text string) bool {
+	body, _ := splitFlags(text)
+	for _, line := range toLines(body) {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "Usage: ") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeManPage writes to w a troff manual page, in section 1, for the named
+// command, such as "upspin-cp". The body is the help text of the command,
+// which may start with a line beginning "Usage: " that is used as the
+// synopsis; the first sentence of the rest is used as the summary in the
+// NAME section. The flags are the lines describing its flags, in the format
+// printed by the flag package, which become the OPTIONS section.
+func writeManPage(w io.Writer, name, body string, flags []string) {
+	var synopsis string
+	var desc []string
+	for _, line := range toLines(strings.TrimSpace(body) + "\n") {
+		if synopsis == "" && strings.HasPrefix(line, "Usage: ") {
+			synopsis = strings.TrimPrefix(line, "Usage: ")
+			continue
+		}
+		desc = append(desc, line)
+	}
+	for len(desc) > 0 && strings.TrimSpace(desc[0]) == "" {
+		desc = desc[1:]
+	}
+
+	fmt.Fprintf(w, ".TH %s 1 %q \"Upspin\" \"UPSPIN\"\n", strings.ToUpper(name), time.Now().Format("January 2006"))
+	fmt.Fprintf(w, ".SH NAME\n%s \\- %s\n", name, troffEscape(summary(desc)))
+	if synopsis != "" {
+		fmt.Fprintf(w, ".SH SYNOPSIS\n%s\n", troffEscape(synopsis))
+	}
+	fmt.Fprintf(w, ".SH DESCRIPTION\n")
+	// Blank lines separate paragraphs; indented lines are examples,
+	// printed as is.
+	literal, para := false, false
+	for _, line := range desc {
+		if strings.TrimSpace(line) == "" {
+			para = !literal
+			continue
+		}
+		indented := strings.HasPrefix(line, "\t")
+		switch {
+		case indented && !literal:
+			fmt.Fprintf(w, ".PP\n.RS\n.nf\n")
+			literal = true
+		case !indented && literal:
+			fmt.Fprintf(w, ".fi\n.RE\n.PP\n")
+			literal = false
+		case para:
+			fmt.Fprintf(w, ".PP\n")
+		}
+		para = false
+		fmt.Fprintf(w, "%s\n", troffEscape(strings.TrimPrefix(line, "\t")))
+	}
+	if literal {
+		fmt.Fprintf(w, ".fi\n.RE\n")
+	}
+
+	if len(flags) == 0 {
+		return
+	}
+	fmt.Fprintf(w, ".SH OPTIONS\n")
+	for _, line := range flags {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "  -") {
+			// A new flag: "  -name" or "  -name value", possibly
+			// followed by a tab and the description.
+			text := strings.TrimPrefix(line, "  ")
+			var usage string
+			if i := strings.Index(text, "\t"); i >= 0 {
+				text, usage = text[:i], text[i+1:]
+			}
+			fmt.Fprintf(w, ".TP\n.B %s\n", troffEscape(text))
+			if usage != "" {
+				fmt.Fprintf(w, "%s\n", troffEscape(usage))
+			}
+			continue
+		}
+		fmt.Fprintf(w, "%s\n", troffEscape(trimmed))
+	}
+}
+
+// summary returns the first sentence of the description.
+func summary(desc []string) string {
+	var para []string
+	for _, line := range desc {
+		if strings.TrimSpace(line) == "" {
+			break
+		}
+		para = append(para, strings.TrimSpace(line))
+	}
+	s := strings.Join(para, " ")
+	if i := strings.Index(s, ". "); i >= 0 {
+		s = s[:i+1]
+	}
+	return s
+}
+
+// troffEscape escapes the text for use as a line of troff input.
+func troffEscape(s string) string {
+	s = strings.Replace(s, `\`, `\e`, -1)
+	s = strings.Replace(s, "-", `\-`, -1)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
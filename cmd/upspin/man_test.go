@@ -0,0 +1,67 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const manHelp = `Usage: upspin cp [opts...] file... file or cp [opts...] file... directory
+
+Cp copies files into, out of, and within Upspin. If the final
+argument is a directory, the files are placed inside it.
+
+For example:
+	upspin cp -R dir ann@example.com/dir
+.dotted line must be escaped, as must \backslash.
+
+Flags:
+  -R	recursively copy directories
+  -log level
+    	level of logging: debug, info, error, disabled (default info)
+`
+
+func TestManPage(t *testing.T) {
+	body, flags := splitFlags(manHelp)
+	if strings.Contains(body, "Flags:") || len(flags) != 3 {
+		t.Fatalf("splitFlags: body %q, flags %q", body, flags)
+	}
+	var b bytes.Buffer
+	writeManPage(&b, "upspin-cp", body, flags)
+	out := b.String()
+	for _, want := range []string{
+		`.TH UPSPIN-CP 1 "`,
+		"\n.SH NAME\nupspin-cp \\- Cp copies files into, out of, and within Upspin.\n",
+		"\n.SH SYNOPSIS\nupspin cp [opts...] file... file or cp [opts...] file... directory\n",
+		"\n.SH DESCRIPTION\n",
+		"\n.RS\n.nf\nupspin cp \\-R dir ann@example.com/dir\n.fi\n.RE\n",
+		"\n\\&.dotted line must be escaped, as must \\ebackslash.\n",
+		"\n.SH OPTIONS\n.TP\n.B \\-R\nrecursively copy directories\n",
+		"\n.TP\n.B \\-log level\nlevel of logging: debug, info, error, disabled (default info)\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if !strings.Contains(out, `"UPSPIN"`) {
+		t.Errorf("output has no UPSPIN section header:\n%s", out)
+	}
+	// The output is troff, not Go; it must not be formatted as Go source.
+	if strings.Contains(out, "package main") || strings.Contains(out, "/*") {
+		t.Errorf("output contains Go source formatting:\n%s", out)
+	}
+}
+
+func TestHasHelpText(t *testing.T) {
+	if !hasHelpText(manHelp) {
+		t.Errorf("hasHelpText(manHelp) = false, want true")
+	}
+	const noHelp = "Usage: upspin cp file...\n\nFlags:\n  -R\trecursively copy directories\n"
+	if hasHelpText(noHelp) {
+		t.Errorf("hasHelpText(%q) = true, want false", noHelp)
+	}
+}
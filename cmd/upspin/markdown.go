@@ -0,0 +1,55 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// writeMarkdown writes to b the documentation for the upspin command in
+// Markdown format, as produced by gendoc -format=markdown. The intro is
+// the text of the package documentation, global is the description of
+// the global flags, and docs holds the help text for each of the named
+// subcommands.
+func writeMarkdown(b *bytes.Buffer, names []string, intro, global string, docs map[string]string) {
+	fmt.Fprintf(b, "<!-- Code generated by upspin gendoc. DO NOT EDIT. -->\n\n")
+	fmt.Fprintf(b, "## The upspin command\n\n")
+	writeMarkdownHelp(b, intro)
+	fmt.Fprintf(b, "## Global Flags\n\n")
+	writeMarkdownHelp(b, global)
+	fmt.Fprintf(b, "## Sub-commands\n\n")
+	for _, name := range names {
+		fmt.Fprintf(b, "### %s\n\n", name)
+		writeMarkdownHelp(b, docs[name])
+	}
+}
+
+// writeMarkdownHelp writes the help text of a command to b. Usage lines
+// are shown as code and the list of flags, which follows a line reading
+// "Flags:" or "Usage of ...:", is put in a fenced code block.
+func writeMarkdownHelp(b *bytes.Buffer, text string) {
+	inFlags := false
+	for _, line := range toLines(strings.TrimSpace(text) + "\n") {
+		switch {
+		case inFlags:
+			fmt.Fprintf(b, "%s\n", line)
+			continue
+		case line == "Flags:" || strings.HasPrefix(line, "Usage of ") && strings.HasSuffix(line, ":"):
+			fmt.Fprintf(b, "%s\n\n```\n", line)
+			inFlags = true
+			continue
+		case strings.HasPrefix(line, "Usage: "):
+			fmt.Fprintf(b, "Usage: `%s`\n", strings.TrimPrefix(line, "Usage: "))
+			continue
+		}
+		fmt.Fprintf(b, "%s\n", line)
+	}
+	if inFlags {
+		fmt.Fprintf(b, "```\n")
+	}
+	fmt.Fprintf(b, "\n")
+}
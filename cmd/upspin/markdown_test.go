@@ -0,0 +1,40 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteMarkdown(t *testing.T) {
+	names := []string{"cp", "ls"}
+	docs := map[string]string{
+		"cp": "Usage: upspin cp [opts] file... file\n\nCp copies files.\n\nFlags:\n  -R\trecursively copy directories\n",
+		"ls": "Usage: upspin ls [-l] [path...]\n\nLs lists the names and, if requested, other properties.\n\nFlags:\n  -l\tlong format\n",
+	}
+	const global = "Usage of upspin:\n  -config file\n    \tuser's configuration file\n"
+
+	var b bytes.Buffer
+	writeMarkdown(&b, names, "The upspin command provides utilities.\n", global, docs)
+	out := b.String()
+
+	for _, want := range []string{
+		"## Global Flags\n",
+		"### cp\n",
+		"### ls\n",
+		"Usage: `upspin cp [opts] file... file`\n",
+		"Flags:\n\n```\n  -R\trecursively copy directories\n```\n",
+		"Usage of upspin:\n\n```\n  -config file\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output does not contain %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "```")%2 != 0 {
+		t.Errorf("unbalanced code fences:\n%s", out)
+	}
+}
@@ -1,5 +1,12 @@
 #!/bin/bash -e
 
-go build -tags gendoc -o upspin.gendoc
-./upspin.gendoc gendoc
-rm upspin.gendoc
+# Run gendoc with only the commands built here in the path and a minimal
+# config, so the output does not depend on the user's installation.
+# TestDocUpToDate checks doc.go the same way.
+dir=$(mktemp -d)
+trap 'rm -rf "$dir"' EXIT
+go build -tags gendoc -o "$dir/upspin.gendoc"
+go build -o "$dir/upspin-setupstorage" ../upspin-setupstorage
+mkdir "$dir/upspin"
+echo "secrets: none" > "$dir/upspin/config"
+PATH="$dir" UPSPIN_HOME="$dir/upspin" "$dir/upspin.gendoc" gendoc "$@"
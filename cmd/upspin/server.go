@@ -0,0 +1,419 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"upspin.io/access"
+	"upspin.io/bind"
+	"upspin.io/config"
+	"upspin.io/errors"
+	"upspin.io/path"
+	"upspin.io/rpc"
+	"upspin.io/subcmd"
+	"upspin.io/transports"
+	"upspin.io/upspin"
+)
+
+func (s *State) server(args ...string) {
+	const help = `
+Server performs administrative operations on Upspin servers.
+The operation is named by the first argument: migrate or list-users.
+
+Migrate moves the directory trees rooted at the named paths from one
+server deployment to another. The source and destination are each
+described by a config file, given by the -from-config and -to-config
+flags; the directory and store servers named in those configs are
+used. If no paths are named, the root of the user in the source
+config is moved.
+
+Every directory entry in the trees is copied to the destination
+directory server, and every block it references is copied to the
+destination store server. Each copied block is read back from the
+destination and its hash is compared with that of the original.
+Access files are copied last, so they cannot prevent the copying
+of other entries. Links are copied as links; their targets are not
+followed. Directories that already exist on the destination are
+reused. Once every entry has been copied and verified, the entries
+are removed from the source directory server. The blocks are
+left on the source store servers, as they may be referenced from
+elsewhere, such as by snapshots; use deletestorage to remove them.
+
+Migrate refuses to start if any entry in the trees is incomplete,
+that is, if the user of the source config may list it but not read
+it, as its blocks could not be copied.
+
+With -dry-run, migrate just reports the number of entries and blocks
+and the amount of data that would be copied.
+
+List-users asks the server at the address given by the -server flag
+for the users who have made authenticated requests to it since it
+started, with the number of requests each has made and the time of the
+most recent one. Only the user running the server may ask. The -since
+flag restricts the list to users seen within the given duration, such
+as 12h or 7d. With -json, the list is printed as JSON.
+`
+	fs := flag.NewFlagSet("server", flag.ExitOnError)
+	from := fs.String("from-config", "", "configuration `file` for the source servers")
+	to := fs.String("to-config", "", "configuration `file` for the destination servers")
+	dryRun := fs.Bool("dry-run", false, "report what would be migrated without changing anything")
+	fs.Bool("v", false, "log each entry as it is migrated")
+	server := fs.String("server", "", "`address` of the server (list-users only)")
+	since := fs.String("since", "", "list only users seen within this `duration` (list-users only)")
+	jsonOut := fs.Bool("json", false, "print the users as JSON (list-users only)")
+	var op string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		op, args = args[0], args[1:]
+	}
+	s.ParseFlags(fs, args, help, "server migrate -from-config=file -to-config=file [-dry-run] [path...]\n       upspin server list-users -server=address [-since=duration] [-json]")
+	switch {
+	case op == "list-users" && *server != "" && fs.NArg() == 0:
+		s.listUsers(*server, *since, *jsonOut)
+		return
+	case op != "migrate" || *from == "" || *to == "":
+		usageAndExit(fs)
+	}
+
+	m := s.newMigrator(*from, *to, *dryRun, subcmd.BoolFlag(fs, "v"))
+	paths := fs.Args()
+	if len(paths) == 0 {
+		paths = []string{string(m.src.UserName()) + "/"}
+	}
+	for _, p := range paths {
+		parsed, err := path.Parse(s.AtSign(p))
+		if err != nil {
+			s.Exit(err)
+		}
+		if err := m.walk(parsed.Path()); err != nil {
+			s.Exit(err)
+		}
+	}
+	if *dryRun {
+		fmt.Printf("would migrate %d entries and %d blocks (%d bytes)\n", len(m.entries), m.blocks, m.bytes)
+		return
+	}
+	if err := m.migrate(); err != nil {
+		s.Exit(err)
+	}
+	fmt.Printf("migrated %d entries and %d blocks (%d bytes)\n", len(m.entries), m.blocks, m.bytes)
+}
+
+// migrator moves directory entries and their blocks between
+// two server deployments, each described by a config.
+type migrator struct {
+	src     upspin.Config
+	dst     upspin.Config
+	dryRun  bool
+	verbose bool
+
+	srcDir   upspin.DirServer
+	dstDir   upspin.DirServer
+	dstStore upspin.StoreServer
+
+	// srcStores holds the source store servers dialed so far,
+	// keyed by endpoint.
+	srcStores map[upspin.Endpoint]upspin.StoreServer
+
+	// entries holds the entries to migrate, in the order found by walk;
+	// a directory always precedes its contents.
+	entries []*upspin.DirEntry
+
+	// copied records the entries that have been copied and verified,
+	// by name. Only those are deleted from the source.
+	copied map[upspin.PathName]bool
+
+	// Statistics.
+	blocks int
+	bytes  int64
+}
+
+// newMigrator returns a migrator for the servers described by the
+// two named config files. It exits if they cannot be loaded.
+func (s *State) newMigrator(from, to string, dryRun, verbose bool) *migrator {
+	m := &migrator{
+		src:       s.loadConfig(from),
+		dst:       s.loadConfig(to),
+		dryRun:    dryRun,
+		verbose:   verbose,
+		srcStores: make(map[upspin.Endpoint]upspin.StoreServer),
+		copied:    make(map[upspin.PathName]bool),
+	}
+	var err error
+	m.srcDir, err = bind.DirServer(m.src, m.src.DirEndpoint())
+	if err != nil {
+		s.Exit(err)
+	}
+	if dryRun {
+		return m
+	}
+	m.dstDir, err = bind.DirServer(m.dst, m.dst.DirEndpoint())
+	if err != nil {
+		s.Exit(err)
+	}
+	m.dstStore, err = bind.StoreServer(m.dst, m.dst.StoreEndpoint())
+	if err != nil {
+		s.Exit(err)
+	}
+	return m
+}
+
+// loadConfig loads the named config file and initializes its transports.
+func (s *State) loadConfig(file string) upspin.Config {
+	cfg, err := config.FromFile(file)
+	if err != nil {
+		s.Exit(err)
+	}
+	transports.Init(cfg)
+	return cfg
+}
+
+// walk records in m.entries the entry for name and,
+// if it is a directory, all entries below it.
+// A link is recorded but not followed. Walk fails if
+// any entry is incomplete, as its blocks cannot be copied.
+func (m *migrator) walk(name upspin.PathName) error {
+	entry, err := m.srcDir.Lookup(name)
+	if err == upspin.ErrFollowLink {
+		// The entry is the link itself, which is what we copy.
+		err = nil
+	}
+	if err != nil {
+		return err
+	}
+	if entry.IsIncomplete() {
+		return errors.E(entry.Name, errors.Permission, errors.Str("entry is incomplete; read access is needed to migrate it"))
+	}
+	m.entries = append(m.entries, entry)
+	if !entry.IsDir() {
+		for _, b := range entry.Blocks {
+			m.blocks++
+			m.bytes += b.Size
+		}
+		return nil
+	}
+	entries, err := m.srcDir.Glob(upspin.AllFilesGlob(entry.Name))
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := m.walk(e.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrate copies the recorded entries and their blocks to the
+// destination servers and then deletes the entries from the source.
+func (m *migrator) migrate() error {
+	// Put the Access files last, to avoid being locked out
+	// of the tree while it is being copied.
+	var accessFiles []*upspin.DirEntry
+	for _, e := range m.entries {
+		if access.IsAccessFile(e.Name) {
+			accessFiles = append(accessFiles, e)
+			continue
+		}
+		if err := m.copyEntry(e); err != nil {
+			return err
+		}
+	}
+	for _, e := range accessFiles {
+		if err := m.copyEntry(e); err != nil {
+			return err
+		}
+	}
+
+	// Everything has been copied, so delete the source entries,
+	// deepest first so that directories are empty when deleted.
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		name := m.entries[i].Name
+		if !m.copied[name] {
+			return errors.E(name, errors.Internal, errors.Str("entry was not copied; not removing it from source"))
+		}
+		m.logf("removing %s from source", name)
+		if _, err := m.srcDir.Delete(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyEntry copies the blocks of the entry to the destination store,
+// verifies them, and puts the updated entry to the destination directory.
+// A directory that already exists on the destination is left as it is.
+func (m *migrator) copyEntry(entry *upspin.DirEntry) error {
+	m.logf("migrating %s", entry.Name)
+	if entry.IsIncomplete() {
+		return errors.E(entry.Name, errors.Permission, errors.Str("entry is incomplete"))
+	}
+	e := *entry
+	e.Sequence = upspin.SeqIgnore
+	// The blocks of a directory are maintained by the directory server.
+	e.Blocks = nil
+	if !entry.IsDir() {
+		e.Blocks = make([]upspin.DirBlock, len(entry.Blocks))
+		for i, b := range entry.Blocks {
+			loc, err := m.copyBlock(b.Location)
+			if err != nil {
+				return errors.E(entry.Name, err)
+			}
+			b.Location = loc
+			e.Blocks[i] = b
+		}
+	}
+	_, err := m.dstDir.Put(&e)
+	if err != nil && entry.IsDir() && errors.Match(errors.E(errors.Exist), err) {
+		existing, lerr := m.dstDir.Lookup(entry.Name)
+		if lerr == nil && existing.IsDir() {
+			err = nil
+		}
+	}
+	if err != nil {
+		return errors.E(entry.Name, err)
+	}
+	m.copied[entry.Name] = true
+	return nil
+}
+
+// copyBlock copies the block at the given location to the destination
+// store and checks that the copy can be read back intact.
+// It returns the location of the copy.
+func (m *migrator) copyBlock(loc upspin.Location) (upspin.Location, error) {
+	store, err := m.srcStore(loc.Endpoint)
+	if err != nil {
+		return loc, err
+	}
+	data, _, locs, err := store.Get(loc.Reference)
+	if err != nil {
+		return loc, err
+	}
+	if len(locs) > 0 {
+		// The block has moved; follow the first new location.
+		return m.copyBlock(locs[0])
+	}
+	refdata, err := m.dstStore.Put(data)
+	if err != nil {
+		return loc, err
+	}
+	copied, _, _, err := m.dstStore.Get(refdata.Reference)
+	if err != nil {
+		return loc, err
+	}
+	want := sha256.Sum256(data)
+	got := sha256.Sum256(copied)
+	if !bytes.Equal(want[:], got[:]) {
+		return loc, errors.E(errors.IO, errors.Errorf("hash mismatch for copy of block %s", loc.Reference))
+	}
+	return upspin.Location{
+		Endpoint:  m.dst.StoreEndpoint(),
+		Reference: refdata.Reference,
+	}, nil
+}
+
+// srcStore returns the source store server for the endpoint.
+func (m *migrator) srcStore(e upspin.Endpoint) (upspin.StoreServer, error) {
+	if store, ok := m.srcStores[e]; ok {
+		return store, nil
+	}
+	store, err := bind.StoreServer(m.src, e)
+	if err != nil {
+		return nil, err
+	}
+	m.srcStores[e] = store
+	return store, nil
+}
+
+func (m *migrator) logf(format string, args ...interface{}) {
+	if m.verbose {
+		fmt.Printf(format+"\n", args...)
+	}
+}
+
+// listUsers prints the users recorded by the server at addr.
+func (s *State) listUsers(addr, since string, jsonOut bool) {
+	var t time.Time
+	if since != "" {
+		d, err := parseSince(since)
+		if err != nil {
+			s.Exit(err)
+		}
+		t = time.Now().Add(-d)
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr += ":443"
+	}
+	c, err := rpc.NewClient(s.Config, upspin.NetAddr(addr), rpc.Secure, upspin.Endpoint{})
+	if err != nil {
+		s.Exit(err)
+	}
+	defer c.Close()
+	// The statistics cover the whole server, so ask whichever
+	// service it provides.
+	var users []rpc.UserStats
+	for _, service := range []string{"Dir", "Store", "Key"} {
+		users, err = rpc.ListUsers(c, service, t)
+		if !errors.Match(errors.E(errors.NotExist), err) {
+			break
+		}
+	}
+	if err != nil {
+		s.Exit(err)
+	}
+	if err := printUsers(os.Stdout, users, jsonOut); err != nil {
+		s.Exit(err)
+	}
+}
+
+// printUsers writes the users to w, one per line or as JSON.
+func printUsers(w io.Writer, users []rpc.UserStats, jsonOut bool) error {
+	if jsonOut {
+		if users == nil {
+			users = []rpc.UserStats{}
+		}
+		b, err := json.MarshalIndent(users, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", b)
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "USER\tREQUESTS\tLAST SEEN\n")
+	for _, u := range users {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", u.User, u.Requests, u.LastSeen.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// parseSince parses a duration for the -since flag. As well as the
+// units accepted by time.ParseDuration, it accepts a whole number of
+// days, such as "7d".
+func parseSince(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || n < 0 {
+			return 0, errors.E(errors.Invalid, errors.Errorf("invalid duration %q", s))
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, errors.E(errors.Invalid, errors.Errorf("invalid duration %q", s))
+	}
+	return d, nil
+}
@@ -0,0 +1,249 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"upspin.io/config"
+	"upspin.io/errors"
+	"upspin.io/factotum"
+	"upspin.io/rpc"
+	"upspin.io/upspin"
+
+	dirinprocess "upspin.io/dir/inprocess"
+	storeinprocess "upspin.io/store/inprocess"
+)
+
+const migrateUser = "user1@google.com"
+
+// migrateEnv is a directory server and store server, both in process,
+// and a config for migrateUser that names them.
+type migrateEnv struct {
+	cfg   upspin.Config
+	dir   upspin.DirServer
+	store upspin.StoreServer
+}
+
+func newMigrateEnv(t *testing.T, storeAddr upspin.NetAddr) *migrateEnv {
+	secrets, err := filepath.Abs("../../key/testdata/user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := factotum.NewFromDir(secrets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.SetUserName(config.New(), migrateUser)
+	cfg = config.SetFactotum(cfg, f)
+	cfg = config.SetPacking(cfg, upspin.PlainPack)
+	cfg = config.SetKeyEndpoint(cfg, upspin.Endpoint{Transport: upspin.InProcess})
+	cfg = config.SetDirEndpoint(cfg, upspin.Endpoint{Transport: upspin.InProcess})
+	// The store endpoint is used only in the locations of file blocks.
+	// The directory server keeps its own blocks in the registered
+	// in-process store, whatever the address.
+	cfg = config.SetStoreEndpoint(cfg, upspin.Endpoint{Transport: upspin.InProcess, NetAddr: storeAddr})
+	e := &migrateEnv{
+		cfg:   cfg,
+		dir:   dirinprocess.New(cfg),
+		store: storeinprocess.New(),
+	}
+	root := upspin.PathName(migrateUser + "/")
+	e.put(t, &upspin.DirEntry{Name: root, Attr: upspin.AttrDirectory})
+	return e
+}
+
+// put puts the entry to the directory server,
+// filling in the fields common to all entries.
+func (e *migrateEnv) put(t *testing.T, entry *upspin.DirEntry) {
+	entry.SignedName = entry.Name
+	entry.Writer = migrateUser
+	entry.Packing = upspin.PlainPack
+	entry.Time = upspin.TimeFromGo(time.Now())
+	if _, err := e.dir.Put(entry); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// putFile stores the data as a single block and puts an entry for it.
+func (e *migrateEnv) putFile(t *testing.T, name upspin.PathName, data string) {
+	ref, err := e.store.Put([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.put(t, &upspin.DirEntry{
+		Name: name,
+		Blocks: []upspin.DirBlock{{
+			Location: upspin.Location{Endpoint: e.cfg.StoreEndpoint(), Reference: ref.Reference},
+			Size:     int64(len(data)),
+		}},
+	})
+}
+
+// newTestMigrator returns a migrator from a source holding a file,
+// a directory with a file in it, and a link, to an empty destination.
+func newTestMigrator(t *testing.T) (m *migrator, src, dst *migrateEnv) {
+	src = newMigrateEnv(t, "src-store")
+	src.putFile(t, migrateUser+"/file", "file")
+	src.put(t, &upspin.DirEntry{Name: migrateUser + "/dir", Attr: upspin.AttrDirectory})
+	src.putFile(t, migrateUser+"/dir/sub", "sub")
+	src.put(t, &upspin.DirEntry{Name: migrateUser + "/link", Attr: upspin.AttrLink, Link: migrateUser + "/dir/sub"})
+	dst = newMigrateEnv(t, "dst-store")
+
+	m = &migrator{
+		src:       src.cfg,
+		dst:       dst.cfg,
+		srcDir:    src.dir,
+		dstDir:    dst.dir,
+		dstStore:  dst.store,
+		srcStores: map[upspin.Endpoint]upspin.StoreServer{src.cfg.StoreEndpoint(): src.store},
+		copied:    make(map[upspin.PathName]bool),
+	}
+	return m, src, dst
+}
+
+func TestMigrate(t *testing.T) {
+	m, src, dst := newTestMigrator(t)
+	if err := m.walk(migrateUser + "/"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.migrate(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The files are in the destination, with blocks in its store.
+	for name, want := range map[upspin.PathName]string{
+		migrateUser + "/file":    "file",
+		migrateUser + "/dir/sub": "sub",
+	} {
+		entry, err := dst.dir.Lookup(name)
+		if err != nil {
+			t.Errorf("Lookup(%q): %v", name, err)
+			continue
+		}
+		if len(entry.Blocks) != 1 {
+			t.Errorf("%s: %d blocks, want 1", name, len(entry.Blocks))
+			continue
+		}
+		loc := entry.Blocks[0].Location
+		if loc.Endpoint != dst.cfg.StoreEndpoint() {
+			t.Errorf("%s: block endpoint %v, want %v", name, loc.Endpoint, dst.cfg.StoreEndpoint())
+		}
+		got, _, _, err := dst.store.Get(loc.Reference)
+		if err != nil {
+			t.Errorf("%s: Get block: %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s: block holds %q, want %q", name, got, want)
+		}
+	}
+	entry, err := dst.dir.Lookup(migrateUser + "/link")
+	if err != upspin.ErrFollowLink {
+		t.Fatalf("Lookup(link): err = %v, want ErrFollowLink", err)
+	}
+	if entry.Link != migrateUser+"/dir/sub" {
+		t.Errorf("link target = %q, want %q", entry.Link, migrateUser+"/dir/sub")
+	}
+	if entry, err := dst.dir.Lookup(migrateUser + "/dir"); err != nil || !entry.IsDir() {
+		t.Errorf("Lookup(dir) = %v, %v; want directory", entry, err)
+	}
+
+	// The source entries are gone.
+	for _, name := range []upspin.PathName{migrateUser + "/file", migrateUser + "/dir", migrateUser + "/link"} {
+		if _, err := src.dir.Lookup(name); !errors.Match(errors.E(errors.NotExist), err) {
+			t.Errorf("source Lookup(%q): err = %v, want NotExist", name, err)
+		}
+	}
+}
+
+// incompleteDir is a DirServer that reports the named entry
+// as incomplete, as a server does for a user who may list it
+// but not read it.
+type incompleteDir struct {
+	upspin.DirServer
+	name upspin.PathName
+}
+
+func (d incompleteDir) Lookup(name upspin.PathName) (*upspin.DirEntry, error) {
+	entry, err := d.DirServer.Lookup(name)
+	if err == nil && name == d.name {
+		e := *entry
+		e.Attr |= upspin.AttrIncomplete
+		e.Blocks = nil
+		entry = &e
+	}
+	return entry, err
+}
+
+func TestMigrateIncomplete(t *testing.T) {
+	m, src, dst := newTestMigrator(t)
+	m.srcDir = incompleteDir{DirServer: src.dir, name: migrateUser + "/dir/sub"}
+	if err := m.walk(migrateUser + "/"); !errors.Match(errors.E(errors.Permission), err) {
+		t.Fatalf("walk: err = %v, want Permission error", err)
+	}
+
+	// Nothing was copied or deleted.
+	for _, name := range []upspin.PathName{migrateUser + "/file", migrateUser + "/dir/sub"} {
+		if _, err := src.dir.Lookup(name); err != nil {
+			t.Errorf("source Lookup(%q): %v", name, err)
+		}
+		if _, err := dst.dir.Lookup(name); err == nil {
+			t.Errorf("destination Lookup(%q) succeeded", name)
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want time.Duration
+		ok   bool
+	}{
+		{"12h", 12 * time.Hour, true},
+		{"90m", 90 * time.Minute, true},
+		{"7d", 7 * 24 * time.Hour, true},
+		{"0d", 0, true},
+		{"d", 0, false},
+		{"-1d", 0, false},
+		{"-1h", 0, false},
+		{"week", 0, false},
+	} {
+		got, err := parseSince(test.in)
+		if (err == nil) != test.ok {
+			t.Errorf("parseSince(%q): err = %v, want ok=%t", test.in, err, test.ok)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseSince(%q) = %v, want %v", test.in, got, test.want)
+		}
+	}
+}
+
+func TestPrintUsers(t *testing.T) {
+	seen := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+	users := []rpc.UserStats{{User: "ann@example.com", Requests: 3, LastSeen: seen}}
+
+	var buf bytes.Buffer
+	if err := printUsers(&buf, users, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "USER             REQUESTS  LAST SEEN\n" +
+		"ann@example.com  3         2017-06-01T12:00:00Z\n"
+	if buf.String() != want {
+		t.Errorf("table:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := printUsers(&buf, nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[]\n" {
+		t.Errorf("empty JSON = %q, want %q", buf.String(), "[]\n")
+	}
+}
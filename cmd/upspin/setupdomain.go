@@ -45,7 +45,7 @@ If any state exists at the given location (-where) then the command aborts.
 `
 	)
 	fs := flag.NewFlagSet("setupdomain", flag.ExitOnError)
-	whereFlag := fs.String("where", filepath.Join(config.Home(), "upspin", "deploy"), "`directory` to store private configuration files")
+	whereFlag := fs.String("where", defaultDeployDir(), "`directory` to store private configuration files")
 	domain := fs.String("domain", "", "domain `name` for this Upspin installation")
 	project := fs.String("project", "", "GCP `project` name")
 	curveName := fs.String("curve", "p256", "cryptographic curve `name`: p256, p384, or p521")
@@ -210,6 +210,12 @@ type setupDomainData struct {
 	Proquint string
 }
 
+// defaultDeployDir returns the default value of the -where flag of the
+// setup commands: the deploy subdirectory of the Upspin directory.
+func defaultDeployDir() string {
+	return filepath.Join(config.UpspinDir(), "deploy")
+}
+
 var setupDomainTemplate = template.Must(template.New("setupdomain").Parse(`
 Keys and config files for the users
 	upspin-dir@{{.Domain}}
@@ -0,0 +1,20 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultDeployDir(t *testing.T) {
+	defer os.Setenv("UPSPIN_HOME", os.Getenv("UPSPIN_HOME"))
+	home := filepath.Join(os.TempDir(), "upspinhome")
+	os.Setenv("UPSPIN_HOME", home)
+	if got, want := defaultDeployDir(), filepath.Join(home, "deploy"); got != want {
+		t.Errorf("defaultDeployDir() = %q, want %q", got, want)
+	}
+}
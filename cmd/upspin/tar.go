@@ -12,10 +12,13 @@ package main
 
 import (
 	"archive/tar"
+	"compress/bzip2"
+	"compress/gzip"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"flag"
@@ -36,23 +39,71 @@ When extracting, the -match and -replace flags cause the extracted
 file to have any prefix that matches be replaced by substitute text.
 Whether or not these flags are used, the destination path must
 always be in Upspin.
+
+If the first argument is an Upspin file and the second is an existing
+local directory, tar instead packs the local directory into an archive
+stored in the Upspin file, without creating a local copy. The archive is
+built in memory and stored only once it is complete, so if packing fails
+an existing file of that name is left unchanged. The archive is compressed
+according to the suffix of the Upspin file name: .tar (no compression),
+.tar.gz or .tgz (gzip). Use upspin untar to unpack such an archive into
+a local directory.
 `
 	fs := flag.NewFlagSet("tar", flag.ExitOnError)
 	extract := fs.Bool("extract", false, "extract from archive")
 	match := fs.String("match", "", "extract from the archive only those pathnames that match the `prefix`")
 	replace := fs.String("replace", "", "replace -match prefix with the replacement `text`")
 	fs.Bool("v", false, "verbose output")
-	s.ParseFlags(fs, args, help, "tar [-extract [-match prefix -replace substitution] ] upspin_directory local_file")
+	s.ParseFlags(fs, args, help, "tar [-extract [-match prefix -replace substitution] ] upspin_directory local_file\n              tar upspin_archive local_directory")
 	if !*extract {
 		if *match != "" || *replace != "" {
 			usageAndExit(fs)
 		}
+		if fs.NArg() == 2 && isLocalDir(fs.Arg(1)) {
+			s.tarLocalCommand(fs)
+			return
+		}
 		s.tarCommand(fs)
 		return
 	}
 	s.untarCommand(fs)
 }
 
+func (s *State) untar(args ...string) {
+	const help = `
+Untar fetches an archive stored in Upspin and unpacks it into a local
+directory, which is created if it does not exist. The archive is read
+directly from Upspin, without first creating a local copy.
+
+The archive is decompressed according to the suffix of its name:
+.tar (no compression), .tar.gz or .tgz (gzip), or .tar.bz2 (bzip2).
+
+Untar refuses to write outside the directory: it rejects entries whose
+names lead outside it, symbolic links whose targets are absolute or lie
+outside it, and entries that would be written through a symbolic link.
+`
+	fs := flag.NewFlagSet("untar", flag.ExitOnError)
+	fs.Bool("v", false, "verbose output")
+	s.ParseFlags(fs, args, help, "untar upspin_archive local_directory")
+	if fs.NArg() != 2 {
+		usageAndExit(fs)
+	}
+	a, err := s.newArchiver(subcmd.BoolFlag(fs, "v"))
+	if err != nil {
+		s.Exit(err)
+	}
+	name := s.GlobOneUpspinPath(fs.Arg(0))
+	dir := s.GlobOneLocal(fs.Arg(1))
+	src, err := s.Client.Open(name)
+	if err != nil {
+		s.Exit(err)
+	}
+	err = a.unarchiveLocal(name, src, dir)
+	if err != nil {
+		s.Exit(err)
+	}
+}
+
 // archiver implements archiving and unarchiving to/from Upspin tree and a local
 // file system.
 type archiver struct {
@@ -99,6 +150,28 @@ func (s *State) untarCommand(fs *flag.FlagSet) {
 	}
 }
 
+func (s *State) tarLocalCommand(fs *flag.FlagSet) {
+	a, err := s.newArchiver(subcmd.BoolFlag(fs, "v"))
+	if err != nil {
+		s.Exit(err)
+	}
+	name := s.AtSign(fs.Arg(0))
+	if _, err := path.Parse(name); err != nil {
+		s.Exit(err)
+	}
+	dir := s.GlobOneLocal(fs.Arg(1))
+	err = a.tarLocal(dir, name)
+	if err != nil {
+		s.Exit(err)
+	}
+}
+
+// isLocalDir reports whether the argument names an existing local directory.
+func isLocalDir(name string) bool {
+	info, err := os.Stat(subcmd.Tilde(name))
+	return err == nil && info.IsDir()
+}
+
 func (s *State) newArchiver(verbose bool) (*archiver, error) {
 	return &archiver{
 		client:  s.Client,
@@ -261,3 +334,225 @@ func (a *archiver) unarchive(src io.ReadCloser) error {
 
 	return nil
 }
+
+// tarLocal archives the local directory dir into the Upspin file name.
+// The file is written only if the whole archive is built successfully.
+func (a *archiver) tarLocal(dir string, name upspin.PathName) error {
+	if err := checkCompressor(name); err != nil {
+		return err
+	}
+	dst, err := a.client.Create(name)
+	if err != nil {
+		return err
+	}
+	return a.archiveLocal(dir, name, dst)
+}
+
+// archiveLocal walks the local directory dir and writes its contents as an
+// archive to dst, compressed according to the suffix of name. It closes
+// dst only if the archive is complete; an Upspin file is stored when it is
+// closed, so on failure the file is left as it was.
+func (a *archiver) archiveLocal(dir string, name upspin.PathName, dst io.WriteCloser) error {
+	cw, err := compressor(name, dst)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(cw)
+	err = filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err = os.Readlink(file)
+			if err != nil {
+				return err
+			}
+		}
+		hdr, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+		if a.verbose {
+			fmt.Fprintf(os.Stderr, "Archiving %q\n", file)
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if cw != dst {
+		if err := cw.Close(); err != nil {
+			return err
+		}
+	}
+	return dst.Close()
+}
+
+// unarchiveLocal reads an archive from src, decompressing it according to
+// the suffix of name, and restores its contents below the local directory dir.
+func (a *archiver) unarchiveLocal(name upspin.PathName, src io.ReadCloser, dir string) error {
+	defer src.Close()
+	r, err := decompressor(name, src)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Refuse to write outside the destination directory,
+		// either directly or through a symbolic link.
+		rel := filepath.Clean(filepath.FromSlash(hdr.Name))
+		if isOutside(rel) {
+			return errors.E(errors.Invalid, errors.Errorf("archive entry %q is outside destination directory", hdr.Name))
+		}
+		if err := checkNoSymlinks(dir, rel); err != nil {
+			return err
+		}
+		file := filepath.Join(dir, rel)
+		if a.verbose {
+			fmt.Fprintf(os.Stderr, "Extracting %q into %q\n", hdr.Name, file)
+		}
+		mode := hdr.FileInfo().Mode().Perm()
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(file, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			target := filepath.FromSlash(hdr.Linkname)
+			if filepath.IsAbs(target) || isOutside(filepath.Join(filepath.Dir(rel), target)) {
+				return errors.E(errors.Invalid, errors.Errorf("archive link %q -> %q points outside destination directory", hdr.Name, hdr.Linkname))
+			}
+			if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+				return err
+			}
+			if err := os.Symlink(target, file); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// isOutside reports whether the cleaned relative path rel
+// names a file outside the directory it is relative to.
+func isOutside(rel string) bool {
+	return filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// checkNoSymlinks returns an error if the relative path rel below dir
+// passes through, or names, an existing symbolic link, so that
+// extracting an entry cannot write outside dir by way of a link
+// created by an earlier entry.
+func checkNoSymlinks(dir, rel string) error {
+	p := dir
+	for _, elem := range strings.Split(rel, string(filepath.Separator)) {
+		p = filepath.Join(p, elem)
+		info, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return errors.E(errors.Invalid, errors.Errorf("archive entry %q would be written through symbolic link %q", rel, p))
+		}
+	}
+	return nil
+}
+
+// compressor returns a writer that compresses its input into w
+// according to the suffix of the archive name.
+// If the archive is not compressed, it returns w itself.
+func compressor(name upspin.PathName, w io.WriteCloser) (io.WriteCloser, error) {
+	if err := checkCompressor(name); err != nil {
+		return nil, err
+	}
+	if archiveSuffix(name) == ".tar" {
+		return w, nil
+	}
+	return gzip.NewWriter(w), nil
+}
+
+// checkCompressor reports an error if compressor does not support
+// writing an archive with the suffix of name.
+func checkCompressor(name upspin.PathName) error {
+	switch archiveSuffix(name) {
+	case ".tar", ".tar.gz", ".tgz":
+		return nil
+	}
+	return errors.E(name, errors.Invalid, errors.Str("unsupported archive compression for writing"))
+}
+
+// decompressor returns a reader that decompresses r according to
+// the suffix of the archive name.
+func decompressor(name upspin.PathName, r io.Reader) (io.Reader, error) {
+	switch archiveSuffix(name) {
+	case ".tar":
+		return r, nil
+	case ".tar.gz", ".tgz":
+		return gzip.NewReader(r)
+	case ".tar.bz2":
+		return bzip2.NewReader(r), nil
+	}
+	return nil, errors.E(name, errors.Invalid, errors.Str("unsupported archive compression for reading"))
+}
+
+// archiveSuffix returns the archive suffix of name, such as ".tar.gz",
+// or the empty string if the name has no recognized suffix.
+func archiveSuffix(name upspin.PathName) string {
+	for _, suffix := range []string{".tar", ".tar.gz", ".tgz", ".tar.bz2"} {
+		if strings.HasSuffix(string(name), suffix) {
+			return suffix
+		}
+	}
+	return ""
+}
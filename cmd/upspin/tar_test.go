@@ -0,0 +1,273 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"upspin.io/bind"
+	"upspin.io/client"
+	"upspin.io/config"
+	"upspin.io/transports"
+	"upspin.io/upspin"
+)
+
+// bufferCloser is a bytes.Buffer that implements io.WriteCloser and io.ReadCloser.
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (*bufferCloser) Close() error { return nil }
+
+func TestArchiveLocal(t *testing.T) {
+	src, err := ioutil.TempDir("", "tar-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	files := map[string]string{
+		"a":         "file a",
+		"dir/b":     "file b in dir",
+		"dir/sub/c": "file c in sub",
+	}
+	for name, data := range files {
+		file := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []upspin.PathName{"u@x.com/a.tar", "u@x.com/a.tar.gz", "u@x.com/a.tgz"} {
+		dst, err := ioutil.TempDir("", "tar-dst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dst)
+
+		a := &archiver{}
+		var buf bufferCloser
+		if err := a.archiveLocal(src, name, &buf); err != nil {
+			t.Fatalf("%s: archiving: %v", name, err)
+		}
+		if err := a.unarchiveLocal(name, &buf, dst); err != nil {
+			t.Fatalf("%s: unarchiving: %v", name, err)
+		}
+		for file, want := range files {
+			got, err := ioutil.ReadFile(filepath.Join(dst, filepath.FromSlash(file)))
+			if err != nil {
+				t.Errorf("%s: %v", name, err)
+				continue
+			}
+			if string(got) != want {
+				t.Errorf("%s: %s: got %q, want %q", name, file, got, want)
+			}
+		}
+	}
+}
+
+func TestArchiveLocalUnsupported(t *testing.T) {
+	a := &archiver{}
+	for _, name := range []upspin.PathName{"u@x.com/a.zip", "u@x.com/a.tar.xz", "u@x.com/a.tar.zst", "u@x.com/a.tar.bz2"} {
+		var buf bufferCloser
+		if err := a.archiveLocal(".", name, &buf); err == nil {
+			t.Errorf("%s: expected error archiving", name)
+		}
+	}
+}
+
+func TestTarLocalFailureKeepsFile(t *testing.T) {
+	secrets, err := filepath.Abs("../../key/testdata/user1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const user = "tar@example.com"
+	cfg, err := config.InitConfig(strings.NewReader("username: " + user + "\nsecrets: " + secrets + "\npacking: plain\nkeyserver: inprocess\ndirserver: inprocess\nstoreserver: inprocess\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	transports.Init(cfg)
+	key, err := bind.KeyServer(cfg, cfg.KeyEndpoint())
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = key.Put(&upspin.User{
+		Name:      user,
+		Dirs:      []upspin.Endpoint{cfg.DirEndpoint()},
+		Stores:    []upspin.Endpoint{cfg.StoreEndpoint()},
+		PublicKey: cfg.Factotum().PublicKey(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := client.New(cfg)
+	if _, err := c.MakeDirectory(user + "/"); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := ioutil.TempDir("", "tar-src")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(src)
+	if err := ioutil.WriteFile(filepath.Join(src, "a"), []byte("file a"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	const old = "old contents"
+	a := &archiver{client: c}
+	for _, tc := range []struct {
+		name upspin.PathName
+		dir  string
+	}{
+		// Unsupported compression is rejected before the file is created.
+		{user + "/archive.tar.bz2", src},
+		// Packing fails part way through because the directory is missing.
+		{user + "/archive.tar", filepath.Join(src, "missing")},
+	} {
+		if _, err := c.Put(tc.name, []byte(old)); err != nil {
+			t.Fatal(err)
+		}
+		if err := a.tarLocal(tc.dir, tc.name); err == nil {
+			t.Errorf("tar %s into %s: expected error", tc.dir, tc.name)
+		}
+		data, err := c.Get(tc.name)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if string(data) != old {
+			t.Errorf("%s: got %q after failed tar, want %q", tc.name, data, old)
+		}
+	}
+}
+
+func TestUnarchiveLocalOutsideDir(t *testing.T) {
+	var buf bufferCloser
+	tw := tar.NewWriter(&buf)
+	data := []byte("escape")
+	hdr := &tar.Header{
+		Name:     "../escape",
+		Mode:     0600,
+		Size:     int64(len(data)),
+		Typeflag: tar.TypeReg,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := ioutil.TempDir("", "tar-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	a := &archiver{}
+	if err := a.unarchiveLocal("u@x.com/a.tar", &buf, dst); err == nil {
+		t.Fatal("expected error extracting entry outside destination")
+	}
+}
+
+// tarEntry describes an entry for makeTar: a regular file holding data,
+// or, if link is set, a symbolic link to it.
+type tarEntry struct {
+	name, data, link string
+}
+
+func makeTar(t *testing.T, entries ...tarEntry) *bufferCloser {
+	var buf bufferCloser
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name:     e.name,
+			Mode:     0600,
+			Size:     int64(len(e.data)),
+			Typeflag: tar.TypeReg,
+		}
+		if e.link != "" {
+			hdr.Typeflag = tar.TypeSymlink
+			hdr.Linkname = e.link
+			hdr.Size = 0
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(e.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestUnarchiveLocalSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on Windows")
+	}
+	outside, err := ioutil.TempDir("", "tar-outside")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+
+	tests := []struct {
+		name    string
+		entries []tarEntry
+		ok      bool
+	}{
+		{"link within", []tarEntry{{name: "dir/f", data: "f"}, {name: "l", link: "dir/f"}}, true},
+		{"absolute link", []tarEntry{{name: "l", link: outside}}, false},
+		{"link outside", []tarEntry{{name: "dir/l", link: "../../x"}}, false},
+		{"write through link", []tarEntry{{name: "dir/f", data: "f"}, {name: "l", link: "dir"}, {name: "l/g", data: "g"}}, false},
+		{"overwrite link", []tarEntry{{name: "f", data: "f"}, {name: "l", link: "f"}, {name: "l", data: "x"}}, false},
+	}
+	for _, test := range tests {
+		dst, err := ioutil.TempDir("", "tar-dst")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dst)
+		a := &archiver{}
+		err = a.unarchiveLocal("u@x.com/a.tar", makeTar(t, test.entries...), dst)
+		if test.ok && err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+
+	// A link already present in the destination is not followed.
+	dst, err := ioutil.TempDir("", "tar-dst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	if err := os.Symlink(outside, filepath.Join(dst, "l")); err != nil {
+		t.Fatal(err)
+	}
+	a := &archiver{}
+	if err := a.unarchiveLocal("u@x.com/a.tar", makeTar(t, tarEntry{name: "l/passwd", data: "x"}), dst); err == nil {
+		t.Errorf("write through existing link: expected error")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "passwd")); err == nil {
+		t.Errorf("file written outside destination")
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// Keys configuring the cache server.
+const (
+	cacheMaxSize = "cache_maxsize"
+	cacheTTL     = "cache_ttl"
+)
+
+// cacheKeys lists the known keys that configure the cache server.
+var cacheKeys = []string{cacheMaxSize, cacheTTL}
+
+const (
+	// DefaultCacheMaxSize is the number of bytes of disk used by the
+	// cache server when the config does not set cache_maxsize.
+	DefaultCacheMaxSize = 5e9
+
+	// DefaultCacheTTL is how long the cache server keeps an entry
+	// when the config does not set cache_ttl.
+	DefaultCacheTTL = 24 * time.Hour
+)
+
+// CacheMaxSize returns the maximum number of bytes of disk to be used
+// by the cache server, as given by the cache_maxsize key in the config,
+// or DefaultCacheMaxSize if that is not set.
+func CacheMaxSize(cfg upspin.Config) int64 {
+	n, err := parseSize(cfg.Value(cacheMaxSize))
+	if err != nil || n <= 0 {
+		return DefaultCacheMaxSize
+	}
+	return n
+}
+
+// CacheTTL returns how long the cache server should keep an entry,
+// as given by the cache_ttl key in the config, or DefaultCacheTTL
+// if that is not set.
+func CacheTTL(cfg upspin.Config) time.Duration {
+	d, err := time.ParseDuration(cfg.Value(cacheTTL))
+	if err != nil || d <= 0 {
+		return DefaultCacheTTL
+	}
+	return d
+}
+
+// checkCacheValue reports whether v is a valid value for the cache key k.
+func checkCacheValue(k, v string) error {
+	switch k {
+	case cacheMaxSize:
+		if n, err := parseSize(v); err != nil || n <= 0 {
+			return errors.Errorf("%s: invalid size %q", k, v)
+		}
+	case cacheTTL:
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			return errors.Errorf("%s: invalid duration %q", k, v)
+		}
+	}
+	return nil
+}
+
+// sizeSuffixes maps the SI suffixes accepted by parseSize to their values.
+var sizeSuffixes = []struct {
+	suffix string
+	mult   float64
+}{
+	// Longest first, so "B" does not match before "KB".
+	{"KB", 1e3},
+	{"MB", 1e6},
+	{"GB", 1e9},
+	{"TB", 1e12},
+	{"B", 1},
+}
+
+// parseSize parses a number of bytes, such as "1000", "500MB", or "1.5GB".
+// The suffixes KB, MB, GB, and TB are powers of 1000 and may be in
+// either case.
+func parseSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	mult := 1.0
+	upper := strings.ToUpper(s)
+	for _, x := range sizeSuffixes {
+		if strings.HasSuffix(upper, x.suffix) {
+			s = strings.TrimSpace(s[:len(s)-len(x.suffix)])
+			mult = x.mult
+			break
+		}
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n * int64(mult), nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid size %q", s)
+	}
+	return int64(f * mult), nil
+}
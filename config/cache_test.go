@@ -0,0 +1,70 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"1000", 1000},
+		{"100B", 100},
+		{"10KB", 10e3},
+		{"500MB", 500e6},
+		{"10GB", 10e9},
+		{"10gb", 10e9},
+		{"2 TB", 2e12},
+		{"1.5GB", 1.5e9},
+	}
+	for _, test := range tests {
+		got, err := parseSize(test.in)
+		if err != nil {
+			t.Errorf("parseSize(%q): %v", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("parseSize(%q) = %d, want %d", test.in, got, test.want)
+		}
+	}
+	for _, bad := range []string{"", "GB", "ten", "10XB", "10GiB"} {
+		if _, err := parseSize(bad); err == nil {
+			t.Errorf("parseSize(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestCacheKeys(t *testing.T) {
+	cfg := New()
+	if got, want := CacheMaxSize(cfg), int64(DefaultCacheMaxSize); got != want {
+		t.Errorf("default CacheMaxSize = %d, want %d", got, want)
+	}
+	if got, want := CacheTTL(cfg), DefaultCacheTTL; got != want {
+		t.Errorf("default CacheTTL = %v, want %v", got, want)
+	}
+
+	cfg, err := InitConfig(strings.NewReader("cache_maxsize: 10GB\ncache_ttl: 1h\nsecrets: none\n"))
+	if err != ErrNoFactotum {
+		t.Fatal(err)
+	}
+	if got, want := CacheMaxSize(cfg), int64(10e9); got != want {
+		t.Errorf("CacheMaxSize = %d, want %d", got, want)
+	}
+	if got, want := CacheTTL(cfg), time.Hour; got != want {
+		t.Errorf("CacheTTL = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"cache_maxsize: lots", "cache_maxsize: -1GB", "cache_ttl: forever", "cache_ttl: 0s"} {
+		_, err := InitConfig(strings.NewReader(bad + "\nsecrets: none\n"))
+		if err == nil || err == ErrNoFactotum {
+			t.Errorf("InitConfig(%q) = %v, want error", bad, err)
+		}
+	}
+}
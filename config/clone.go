@@ -0,0 +1,31 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import "upspin.io/upspin"
+
+// Clone returns a copy of the config that holds all its values directly,
+// rather than as a chain of configs derived by the Set functions of this
+// package, so that holding the copy does not keep that chain alive.
+// The copy is immutable; the Set functions derive new configs from it as
+// from any other. Command flags and the values of keys set by SetValue
+// are copied; the Factotum and certificate pool, which are never modified,
+// are shared with the original. The copy is a Snapshot; see NewSnapshot.
+// The copy of a frozen config is not frozen; see Freeze.
+func Clone(cfg upspin.Config) upspin.Config {
+	return NewSnapshot(cfg)
+}
+
+// copyFlags returns a copy of the flags for a command.
+func copyFlags(flags map[string]string) map[string]string {
+	if flags == nil {
+		return nil
+	}
+	m := make(map[string]string, len(flags))
+	for k, v := range flags {
+		m[k] = v
+	}
+	return m
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"upspin.io/upspin"
+)
+
+func TestClone(t *testing.T) {
+	certsDir, err := filepath.Abs("../rpc/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := InitConfig(strings.NewReader(`
+username: ann@example.com
+dirserver: dir.example.com
+storeservers: [store1.example.com, store2.example.com]
+dirserver_timeout: 1m
+tlscerts: ` + certsDir + `
+secrets: ` + secretsDir + `
+cmdflags:
+ upspinfs:
+  cachedir: /tmp
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig = SetValue(orig, "extra", "1")
+
+	clone := Clone(orig)
+	if _, ok := clone.(Snapshot); !ok {
+		t.Fatalf("Clone returned %T, want Snapshot", clone)
+	}
+	if !Equal(orig, clone) {
+		t.Fatalf("Equal(orig, Clone(orig)) = false; differences: %q", Diff(orig, clone))
+	}
+	if clone.Factotum() != orig.Factotum() {
+		t.Errorf("clone does not share the Factotum")
+	}
+	if clone.CertPool() != orig.CertPool() {
+		t.Errorf("clone does not share the certificate pool")
+	}
+	if got, want := TLSCerts(clone), certsDir; got != want {
+		t.Errorf("TLSCerts(clone) = %q, want %q", got, want)
+	}
+	if got, want := StoreEndpoints(clone), StoreEndpoints(orig); !reflect.DeepEqual(got, want) {
+		t.Errorf("StoreEndpoints(clone) = %v, want %v", got, want)
+	}
+	testRoundTrip(t, clone, nil)
+	if !Equal(Clone(clone), clone) {
+		t.Errorf("Equal(Clone(clone), clone) = false, want true")
+	}
+
+	// Changes derived from the original do not affect the clone.
+	changed := SetUserName(orig, "bob@example.com")
+	changed = SetValue(changed, "extra", "2")
+	changed = SetStoreEndpoint(changed, upspin.Endpoint{Transport: upspin.InProcess})
+	orig.Flags("upspinfs")["cachedir"] = "/var/tmp"
+	if Equal(changed, clone) {
+		t.Errorf("Equal(changed, clone) = true, want false")
+	}
+	if got := clone.UserName(); got != "ann@example.com" {
+		t.Errorf("clone UserName = %q after changing original", got)
+	}
+	if got := clone.Value("extra"); got != "1" {
+		t.Errorf("clone Value(extra) = %q after changing original", got)
+	}
+	if got := clone.Flags("upspinfs")["cachedir"]; got != "/tmp" {
+		t.Errorf("clone cachedir flag = %q after changing original", got)
+	}
+
+	// Nor can the clone be changed through the maps it returns.
+	clone.Flags("upspinfs")["cachedir"] = "/elsewhere"
+	if got := clone.Flags("upspinfs")["cachedir"]; got != "/tmp" {
+		t.Errorf("clone cachedir flag = %q after changing returned map", got)
+	}
+}
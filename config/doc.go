@@ -0,0 +1,114 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+/*
+Package config creates a client configuration from various sources.
+
+Configuration files
+
+A configuration file should be of the format
+  # lines that begin with a hash are ignored
+  key: value
+where key may be one of the keys described below. The file may also
+define named profiles that override these values; see WithProfile.
+The include key is supported only for files read by FromFile;
+InitConfig cannot resolve included files and reports an error.
+The version key gives the version of the file format, by default 0.
+Files of older versions are migrated to CurrentVersion as they are
+read; see RegisterMigration.
+
+The default configuration file location is $HOME/upspin/config or,
+if that does not exist, $XDG_CONFIG_HOME/upspin/config, unless the
+environment variable UPSPIN_HOME names another directory to use in
+place of $HOME/upspin; see DefaultConfigPath.
+
+Environment variables
+
+Environment variables named "UPSPIN_KEY", where "KEY" is a recognized
+configuration key in upper case, provide values for keys that are not
+set in the config file. Environment variables named "upspinkey", where
+"key" is a recognized configuration key, may override configuration
+values in the config file. Thus the order of precedence is: "upspinkey"
+variables, the config file, "UPSPIN_KEY" variables, and then the defaults.
+
+Endpoints
+
+Any endpoints (keyserver, dirserver, storeserver) not set in the data for
+the config will be set to the "unassigned" transport and an empty network
+address, except keyserver which defaults to "remote,key.upspin.io:443".
+If an endpoint is specified without a transport it is assumed to be
+the address component of a remote endpoint.
+If a remote endpoint is specified without a port in its address component
+the port is assumed to be 443; see WithDefaultPort.
+
+The storeservers key specifies a list of store servers to be tried in
+order, the first being the config's StoreEndpoint; see StoreEndpoints.
+If the storeserver key is also set, its endpoint comes first.
+
+The keys keyserver_timeout, dirserver_timeout, storeserver_timeout,
+and cache_timeout specify how long to wait when connecting to the
+corresponding server, as a duration such as "30s" or "2m"; see
+EndpointTimeout.
+
+The keys keyserver_retry, dirserver_retry, storeserver_retry, and
+cache_retry specify how requests to the corresponding server are
+retried, as a map such as
+	{max_attempts: 3, initial_backoff: 1s, max_backoff: 30s}
+By default requests are not retried; see GetRetryPolicy.
+
+The keys keyserver_tls_name, dirserver_tls_name, and storeserver_tls_name
+give the host name expected in the TLS certificate of the corresponding
+server, for when it differs from the host in the server's address, as
+behind a TLS-terminating proxy; see TLSServerName.
+
+The proxy key specifies the URL of an HTTP proxy, such as
+"http://proxy.example.com:8080", through which to connect to
+servers; see ProxyURL.
+
+The credentials_file key names a file, in the format of .netrc, holding
+the user names and passwords to present to servers that require HTTP
+authentication; see Credentials.
+
+Secrets
+
+The default value for secrets is "$HOME/.ssh" or, if an Upspin home
+directory is set by the upspin_home key or the UPSPIN_HOME environment
+variable, the .ssh subdirectory of that directory. The key takes
+precedence over the variable. As the config file has already been found
+when the upspin_home key is read, the key affects only this default.
+
+The special value "none" indicates there are no secrets to load;
+in this case, the returned config will not include a Factotum
+and the returned error is ErrNoFactotum. If the secrets directory
+holds no valid keys, the error wraps a NoFactotumError.
+The special value "env" indicates that the private key is held in the
+environment variable UPSPIN_PRIVATE_KEY, as PEM data or as PEM data
+encoded in base64. The variable is removed from the environment once
+read; later configs in the same process reuse the key.
+The special value "keychain" indicates that the private key is held in
+the operating system's keychain, in an item labeled with the user name;
+see factotum.NewFromKeychain.
+
+The tlscerts key specifies a directory containing PEM certificates define
+the certificate pool used for verifying client TLS connections,
+replacing the root certificate list provided by the operating system.
+Files without the suffix ".pem" are ignored.
+The default value for tlscerts is the empty string,
+in which case just the system roots are used.
+
+Relative secrets and tlscerts directories, and relative upspin_home and
+credentials_file names, are interpreted relative to the directory
+holding the config file or, for InitConfig, the current directory;
+see FromReader.
+
+Other keys
+
+The default value for packing is "ee".
+
+The keys cache_maxsize and cache_ttl configure the cache server: the
+disk space it may use, as a number of bytes with an optional suffix
+KB, MB, GB, or TB, such as "10GB"; and how long it keeps an entry,
+as a duration. See CacheMaxSize and CacheTTL.
+*/
+package config // import "upspin.io/config"
@@ -0,0 +1,28 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"upspin.io/upspin"
+	"upspin.io/user"
+)
+
+// upspinDomain is the domain served by the default key server.
+const upspinDomain = "upspin.io"
+
+// DomainMismatch reports whether the domain of the config's user name
+// seems not to match its key server: either the user is in the upspin.io
+// domain and the key server is not the default, or the user is in some
+// other domain and the key server is the default, key.upspin.io:443.
+// Either may be intentional, so the result is advice, not an error.
+// If the user name cannot be parsed, DomainMismatch returns false.
+func DomainMismatch(cfg upspin.Config) bool {
+	_, _, domain, err := user.Parse(cfg.UserName())
+	if err != nil {
+		return false
+	}
+	isDefault := cfg.KeyEndpoint() == defaultKeyEndpoint
+	return (domain == upspinDomain) != isDefault
+}
@@ -0,0 +1,36 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"testing"
+
+	"upspin.io/upspin"
+)
+
+func TestDomainMismatch(t *testing.T) {
+	custom := upspin.Endpoint{Transport: upspin.Remote, NetAddr: "key.example.com:443"}
+	tests := []struct {
+		user upspin.UserName
+		key  upspin.Endpoint
+		want bool
+	}{
+		{"ann@upspin.io", defaultKeyEndpoint, false},
+		{"ann@upspin.io", custom, true},
+		{"ann@example.com", defaultKeyEndpoint, true},
+		{"ann@example.com", custom, false},
+	}
+	for _, test := range tests {
+		cfg := SetKeyEndpoint(SetUserName(New(), test.user), test.key)
+		if got := DomainMismatch(cfg); got != test.want {
+			t.Errorf("DomainMismatch(%s, %s) = %v, want %v", test.user, test.key, got, test.want)
+		}
+	}
+
+	// An unparsable user name is not a mismatch.
+	if DomainMismatch(SetUserName(New(), "bogus")) {
+		t.Error("DomainMismatch with bad user name = true, want false")
+	}
+}
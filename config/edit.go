@@ -0,0 +1,267 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// EditFile reads the named YAML config file, calls fn with the config it
+// describes, and rewrites the file to describe the config fn returns.
+// Unlike writing the result of MarshalConfig, EditFile changes only the
+// lines holding values that differ, so comments, blank lines, and the
+// order of the keys are preserved. A value that is no longer set is
+// removed and a newly set value is added after the last key in the file.
+// If fn returns an error, the file is not changed and the error is
+// returned. The file is replaced atomically, as by WriteFile.
+//
+// The values compared are those written by MarshalConfig, so a change
+// made by fn that MarshalConfig cannot express, such as to the Factotum's
+// keys, is not recorded. TOML files are not supported.
+func EditFile(path string, fn func(upspin.Config) (upspin.Config, error)) error {
+	const op = "config.EditFile"
+	if isTOML(path) {
+		return errors.E(op, errors.Invalid, errors.Errorf("cannot edit TOML file %q", path))
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.E(op, errors.IO, err)
+	}
+	cfg, err := FromFile(path)
+	if err != nil && err != ErrNoFactotum {
+		return errors.E(op, err)
+	}
+	newCfg, err := fn(cfg)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	oldVals, err := marshaledValues(cfg)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	newVals, err := marshaledValues(newCfg)
+	if err != nil {
+		return errors.E(op, err)
+	}
+
+	e := newLineEditor(string(data))
+	for _, item := range newVals {
+		key := item.Key.(string)
+		old, ok := lookupItem(oldVals, key)
+		if ok && reflect.DeepEqual(old, item.Value) {
+			continue
+		}
+		if err := e.set(key, item.Value); err != nil {
+			return errors.E(op, err)
+		}
+	}
+	for _, item := range oldVals {
+		key := item.Key.(string)
+		if _, ok := lookupItem(newVals, key); !ok {
+			e.remove(key)
+		}
+	}
+	if err := writeFileAtomic(path, []byte(e.String())); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// SetFileValue sets the top-level key in the named YAML config file to
+// the value, leaving every other line of the file as it is. Only the
+// text of the file is edited, so values that come from an included
+// file, a profile, or the environment are not written to it.
+// If check is true, the edited file is loaded, as by FromFile, before
+// it replaces the original; if it cannot be loaded, the file is not
+// changed and the error is returned. A config that loads without a
+// Factotum passes the check. The file is replaced atomically, as by
+// WriteFile. TOML files are not supported.
+func SetFileValue(path, key, value string, check bool) error {
+	const op = "config.SetFileValue"
+	if isTOML(path) {
+		return errors.E(op, errors.Invalid, errors.Errorf("cannot edit TOML file %q", path))
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.E(op, errors.IO, err)
+	}
+	e := newLineEditor(string(data))
+	if err := e.set(key, value); err != nil {
+		return errors.E(op, err)
+	}
+	data = []byte(e.String())
+	if check {
+		if err := checkFile(path, data); err != nil {
+			return errors.E(op, errors.Invalid, errors.Errorf("setting %s: %v", key, err))
+		}
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// checkFile loads the config that the named file would describe if it
+// held data. The data is written to a temporary file in the same
+// directory, so that relative names in it resolve as they would in
+// the original.
+func checkFile(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".check")
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	if _, err := FromFile(tmp.Name()); err != nil && err != ErrNoFactotum {
+		return err
+	}
+	return nil
+}
+
+// marshaledValues returns the top-level values of the config as written
+// by MarshalConfig.
+func marshaledValues(cfg upspin.Config) (yaml.MapSlice, error) {
+	data, err := MarshalConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var m yaml.MapSlice
+	if err := yaml.Unmarshal(data, &m); err != nil {
+		return nil, errors.E(errors.Invalid, err)
+	}
+	return m, nil
+}
+
+// lookupItem returns the value of the key in m.
+func lookupItem(m yaml.MapSlice, key string) (interface{}, bool) {
+	for _, item := range m {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// lineEditor edits the top-level keys of a YAML file line by line,
+// leaving all other lines, including comments, as they are.
+type lineEditor struct {
+	lines []string
+}
+
+func newLineEditor(text string) *lineEditor {
+	text = strings.TrimSuffix(text, "\n")
+	if text == "" {
+		return &lineEditor{}
+	}
+	return &lineEditor{lines: strings.Split(text, "\n")}
+}
+
+func (e *lineEditor) String() string {
+	if len(e.lines) == 0 {
+		return ""
+	}
+	return strings.Join(e.lines, "\n") + "\n"
+}
+
+// topKeyRE matches a line that starts a top-level key.
+var topKeyRE = regexp.MustCompile(`^([A-Za-z0-9_]+)[ \t]*:`)
+
+// commentRE matches a comment at the end of a line.
+var commentRE = regexp.MustCompile(`[ \t]+#.*$`)
+
+// find returns the range of lines [start, end) holding the key and its
+// value, which may continue on indented lines or list items.
+// If the key is not present, start is -1.
+func (e *lineEditor) find(key string) (start, end int) {
+	for i, line := range e.lines {
+		m := topKeyRE.FindStringSubmatch(line)
+		if m == nil || m[1] != key {
+			continue
+		}
+		end = i + 1
+		for end < len(e.lines) && isContinuation(e.lines[end]) {
+			end++
+		}
+		return i, end
+	}
+	return -1, -1
+}
+
+// isContinuation reports whether the line continues the value of the
+// key on a previous line.
+func isContinuation(line string) bool {
+	return strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "-")
+}
+
+// set sets the value of the key, replacing the lines that hold its
+// current value or, if it is not present, adding it after the last key.
+// A comment at the end of a one-line value is kept.
+func (e *lineEditor) set(key string, val interface{}) error {
+	data, err := yaml.Marshal(yaml.MapSlice{{Key: key, Value: val}})
+	if err != nil {
+		return errors.E(errors.Invalid, err)
+	}
+	repl := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	start, end := e.find(key)
+	if start < 0 {
+		start = e.endOfKeys()
+		end = start
+	} else if end == start+1 && len(repl) == 1 {
+		repl[0] += commentRE.FindString(e.lines[start])
+	}
+	e.replace(start, end, repl)
+	return nil
+}
+
+// remove deletes the key and its value.
+func (e *lineEditor) remove(key string) {
+	if start, end := e.find(key); start >= 0 {
+		e.replace(start, end, nil)
+	}
+}
+
+// endOfKeys returns the index of the line after the value of the last
+// top-level key, or after the last line if there is no key.
+func (e *lineEditor) endOfKeys() int {
+	last := -1
+	for i, line := range e.lines {
+		if topKeyRE.MatchString(line) {
+			last = i
+		}
+	}
+	if last < 0 {
+		return len(e.lines)
+	}
+	end := last + 1
+	for end < len(e.lines) && isContinuation(e.lines[end]) {
+		end++
+	}
+	return end
+}
+
+// replace replaces lines [start, end) with repl.
+func (e *lineEditor) replace(start, end int, repl []string) {
+	lines := make([]string, 0, len(e.lines)-(end-start)+len(repl))
+	lines = append(lines, e.lines[:start]...)
+	lines = append(lines, repl...)
+	lines = append(lines, e.lines[end:]...)
+	e.lines = lines
+}
@@ -0,0 +1,198 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+const editConfig = `# My Upspin config.
+# Keep this in sync with the laptop.
+
+username: ann@example.com # The account I use for work.
+dirserver: remote,dir.example.com:443 # Old server.
+
+# Store servers.
+storeserver: remote,store.example.com:443
+dirserver_retry:
+  max_attempts: 3
+secrets: none
+`
+
+func TestEditFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config")
+
+	tests := []struct {
+		name string
+		fn   func(upspin.Config) upspin.Config
+		want string
+	}{
+		{
+			"change",
+			func(cfg upspin.Config) upspin.Config {
+				return SetDirEndpoint(cfg, upspin.Endpoint{Transport: upspin.Remote, NetAddr: "newdir.example.com:443"})
+			},
+			`# My Upspin config.
+# Keep this in sync with the laptop.
+
+username: ann@example.com # The account I use for work.
+dirserver: remote,newdir.example.com:443 # Old server.
+
+# Store servers.
+storeserver: remote,store.example.com:443
+dirserver_retry:
+  max_attempts: 3
+secrets: none
+`,
+		},
+		{
+			"add and remove",
+			func(cfg upspin.Config) upspin.Config {
+				cfg = SetStoreEndpoint(cfg, upspin.Endpoint{})
+				cfg = SetValue(cfg, "dirserver_timeout", "1m0s")
+				return SetRetryPolicy(cfg, "dirserver", RetryPolicy{MaxAttempts: 5})
+			},
+			`# My Upspin config.
+# Keep this in sync with the laptop.
+
+username: ann@example.com # The account I use for work.
+dirserver: remote,dir.example.com:443 # Old server.
+
+# Store servers.
+dirserver_retry:
+  max_attempts: 5
+  initial_backoff: 0s
+  max_backoff: 0s
+secrets: none
+dirserver_timeout: 1m0s
+`,
+		},
+		{
+			"no change",
+			func(cfg upspin.Config) upspin.Config { return cfg },
+			editConfig,
+		},
+	}
+	for _, test := range tests {
+		if err := ioutil.WriteFile(path, []byte(editConfig), 0600); err != nil {
+			t.Fatal(err)
+		}
+		err := EditFile(path, func(cfg upspin.Config) (upspin.Config, error) {
+			return test.fn(cfg), nil
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(data); got != test.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestEditFileError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(path, []byte(editConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fail := errors.Str("failed")
+	err = EditFile(path, func(cfg upspin.Config) (upspin.Config, error) {
+		return SetUserName(cfg, "bob@example.com"), fail
+	})
+	if err == nil {
+		t.Fatal("EditFile succeeded; want error")
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != editConfig {
+		t.Errorf("file changed after error:\n%s", data)
+	}
+}
+
+func TestSetFileValue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config")
+	const base = "cache: yes\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "base"), []byte(base), 0600); err != nil {
+		t.Fatal(err)
+	}
+	const orig = "include: base # Shared settings.\n" + editConfig
+	if err := ioutil.WriteFile(path, []byte(orig), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := os.LookupEnv("UPSPIN_PACKING"); ok {
+		defer os.Setenv("UPSPIN_PACKING", v)
+	} else {
+		defer os.Unsetenv("UPSPIN_PACKING")
+	}
+	os.Setenv("UPSPIN_PACKING", "plain")
+	load := func() string {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// Only the key's line changes; the included file and the
+	// environment contribute nothing to the file.
+	if err := SetFileValue(path, "dirserver", "newdir.example.com", true); err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Replace(orig, "remote,dir.example.com:443", "newdir.example.com", 1)
+	if got := load(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+
+	// A value that cannot be loaded is rejected unless check is false.
+	if err := SetFileValue(path, "packing", "nonesuch", true); !errors.Match(errors.E(errors.Invalid), err) {
+		t.Errorf("set bad packing: err = %v, want Invalid error", err)
+	}
+	if got := load(); got != want {
+		t.Errorf("file changed after error:\n%s", got)
+	}
+	if err := SetFileValue(path, "packing", "nonesuch", false); err != nil {
+		t.Fatal(err)
+	}
+	if got := load(); got != want+"packing: nonesuch\n" {
+		t.Errorf("unchecked set: got\n%s", got)
+	}
+
+	// No temporary files are left behind.
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fis) != 2 {
+		t.Errorf("directory holds %d files, want 2", len(fis))
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"upspin.io/upspin"
+)
+
+// Keys returns, in sorted order, the keys that have been given
+// values in the config by SetValue.
+func Keys(cfg upspin.Config) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for ; cfg != nil; cfg = parent(cfg) {
+		switch c := cfg.(type) {
+		case cfgValue:
+			if !seen[c.key] {
+				seen[c.key] = true
+				keys = append(keys, c.key)
+			}
+		case Snapshot:
+			for k := range c.values {
+				if !seen[k] {
+					seen[k] = true
+					keys = append(keys, k)
+				}
+			}
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ListValueKeys returns, in sorted order and without duplicates, the keys
+// for which the config's Value method returns a non-empty string. Like Keys,
+// it reports only keys given values by SetValue, never the built-in keys
+// such as username and keyserver; unlike Keys, it omits keys set to "".
+func ListValueKeys(cfg upspin.Config) []string {
+	var keys []string
+	for _, k := range Keys(cfg) {
+		if cfg.Value(k) != "" {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Equal reports whether the two configs hold the same user name,
+// packing, endpoints, list of store endpoints, command flags, and values for the keys returned
+// by Keys, regardless of the order in which those were set.
+func Equal(a, b upspin.Config) bool {
+	if a.UserName() != b.UserName() ||
+		a.Packing() != b.Packing() ||
+		a.KeyEndpoint() != b.KeyEndpoint() ||
+		a.DirEndpoint() != b.DirEndpoint() ||
+		a.StoreEndpoint() != b.StoreEndpoint() ||
+		a.CacheEndpoint() != b.CacheEndpoint() {
+		return false
+	}
+	if !reflect.DeepEqual(StoreEndpoints(a), StoreEndpoints(b)) {
+		return false
+	}
+	if !reflect.DeepEqual(allFlags(a), allFlags(b)) {
+		return false
+	}
+	keys := Keys(a)
+	if !reflect.DeepEqual(keys, Keys(b)) {
+		return false
+	}
+	for _, k := range keys {
+		if a.Value(k) != b.Value(k) {
+			return false
+		}
+	}
+	return true
+}
+
+// Diff returns a description of each difference between the configs a
+// and b, one per line in a stable format suitable for logging, such as
+//	StoreEndpoint changed from remote,old.example.com:443 to remote,new.example.com:443
+// It compares the user name, endpoints, list of store endpoints, packing,
+// presence of a Factotum, command flags, and the values of all keys
+// returned by Keys for either config. If the configs do not differ in
+// those respects, Diff returns nil.
+func Diff(a, b upspin.Config) []string {
+	var diffs []string
+	changed := func(what string, x, y interface{}) {
+		diffs = append(diffs, fmt.Sprintf("%s changed from %v to %v", what, x, y))
+	}
+	if x, y := a.UserName(), b.UserName(); x != y {
+		changed("UserName", x, y)
+	}
+	endpoints := []struct {
+		name string
+		x, y upspin.Endpoint
+	}{
+		{"KeyEndpoint", a.KeyEndpoint(), b.KeyEndpoint()},
+		{"DirEndpoint", a.DirEndpoint(), b.DirEndpoint()},
+		{"StoreEndpoint", a.StoreEndpoint(), b.StoreEndpoint()},
+		{"CacheEndpoint", a.CacheEndpoint(), b.CacheEndpoint()},
+	}
+	for _, e := range endpoints {
+		if e.x != e.y {
+			changed(e.name, e.x, e.y)
+		}
+	}
+	// A change to a single store endpoint is reported above.
+	if x, y := StoreEndpoints(a), StoreEndpoints(b); (len(x) > 1 || len(y) > 1) && !reflect.DeepEqual(x, y) {
+		changed("StoreEndpoints", x, y)
+	}
+	if x, y := a.Packing(), b.Packing(); x != y {
+		changed("Packing", x, y)
+	}
+	switch x, y := a.Factotum() != nil, b.Factotum() != nil; {
+	case x && !y:
+		diffs = append(diffs, "Factotum removed")
+	case !x && y:
+		diffs = append(diffs, "Factotum added")
+	}
+	if x, y := allFlags(a), allFlags(b); !reflect.DeepEqual(x, y) {
+		changed("cmdflags", x, y)
+	}
+	seen := make(map[string]bool)
+	for _, k := range append(Keys(a), Keys(b)...) {
+		seen[k] = true
+	}
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if x, y := a.Value(k), b.Value(k); x != y {
+			changed(fmt.Sprintf("value of %q", k), fmt.Sprintf("%q", x), fmt.Sprintf("%q", y))
+		}
+	}
+	return diffs
+}
+
+// ToMap returns the contents of the config as a map, for debugging.
+// It holds the user name, packing, and endpoints under the names of
+// the corresponding config keys, with endpoints in the form accepted
+// by upspin.ParseEndpoint; if there is more than one store endpoint,
+// all of them, separated by spaces, under "storeservers"; "present"
+// or "none" under "factotum", according to whether the config has a
+// Factotum; the tlscerts directory, if known; and the value of each
+// key returned by Keys.
+func ToMap(cfg upspin.Config) map[string]string {
+	m := map[string]string{
+		username:    string(cfg.UserName()),
+		packing:     cfg.Packing().String(),
+		keyserver:   cfg.KeyEndpoint().String(),
+		dirserver:   cfg.DirEndpoint().String(),
+		storeserver: cfg.StoreEndpoint().String(),
+		cache:       cfg.CacheEndpoint().String(),
+		"factotum":  "none",
+	}
+	if cfg.Factotum() != nil {
+		m["factotum"] = "present"
+	}
+	if eps := StoreEndpoints(cfg); len(eps) > 1 {
+		var list []string
+		for _, e := range eps {
+			list = append(list, e.String())
+		}
+		m[storeservers] = strings.Join(list, " ")
+	}
+	if dir := TLSCerts(cfg); dir != "" {
+		m[tlscerts] = dir
+	}
+	for _, k := range Keys(cfg) {
+		m[k] = cfg.Value(k)
+	}
+	return m
+}
+
+// allFlags returns the command flags held by the config,
+// or nil if there are none.
+func allFlags(cfg upspin.Config) map[string]map[string]string {
+	var flags map[string]map[string]string
+	switch c := find(cfg, isFlags).(type) {
+	case cfgFlags:
+		flags = c.flags
+	case Snapshot:
+		flags = c.flags
+	}
+	if len(flags) == 0 {
+		return nil
+	}
+	return flags
+}
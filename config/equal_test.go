@@ -0,0 +1,185 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"reflect"
+	"testing"
+
+	"upspin.io/upspin"
+)
+
+func TestEqual(t *testing.T) {
+	dir := upspin.Endpoint{Transport: upspin.Remote, NetAddr: "dir.example.com:443"}
+	store := upspin.Endpoint{Transport: upspin.Remote, NetAddr: "store.example.com:443"}
+
+	a := SetUserName(New(), "ann@example.com")
+	a = SetDirEndpoint(a, dir)
+	a = SetStoreEndpoint(a, store)
+	a = SetValue(a, "b", "2")
+	a = SetValue(a, "a", "1")
+
+	b := SetValue(New(), "a", "0")
+	b = SetValue(b, "b", "2")
+	b = SetStoreEndpoint(b, store)
+	b = SetDirEndpoint(b, dir)
+	b = SetUserName(b, "ann@example.com")
+	b = SetValue(b, "a", "1")
+
+	if got, want := Keys(a), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys(a) = %q, want %q", got, want)
+	}
+	if !Equal(a, b) {
+		t.Errorf("Equal(a, b) = false, want true")
+	}
+
+	tests := []struct {
+		name string
+		cfg  upspin.Config
+	}{
+		{"username", SetUserName(b, "bob@example.com")},
+		{"packing", SetPacking(b, upspin.PlainPack)},
+		{"keyserver", SetKeyEndpoint(b, dir)},
+		{"dirserver", SetDirEndpoint(b, store)},
+		{"storeserver", SetStoreEndpoint(b, dir)},
+		{"cache", SetCacheEndpoint(b, dir)},
+		{"value", SetValue(b, "b", "3")},
+		{"new key", SetValue(b, "c", "")},
+		{"cmdflags", SetFlags(b, map[string]map[string]string{"upspin": {"log": "debug"}})},
+	}
+	for _, test := range tests {
+		if Equal(a, test.cfg) {
+			t.Errorf("%s: Equal = true, want false", test.name)
+		}
+	}
+}
+
+func TestListValueKeys(t *testing.T) {
+	cfg := SetUserName(New(), "ann@example.com")
+	cfg = SetDirEndpoint(cfg, upspin.Endpoint{Transport: upspin.InProcess})
+	if got := ListValueKeys(cfg); got != nil {
+		t.Errorf("ListValueKeys with no values = %q, want nil", got)
+	}
+
+	cfg = SetValue(cfg, "zeta", "1")
+	cfg = SetValue(cfg, "alpha", "2")
+	cfg = SetValue(cfg, "empty", "")
+	cfg = SetValue(cfg, "mid", "")
+	cfg = SetPacking(cfg, upspin.PlainPack)
+	cfg = SetValue(cfg, "zeta", "3") // Overrides the earlier value.
+	cfg = SetValue(cfg, "mid", "4")  // Overrides the earlier empty value.
+	got := ListValueKeys(cfg)
+	want := []string{"alpha", "mid", "zeta"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListValueKeys = %q, want %q", got, want)
+	}
+	for _, k := range got {
+		if cfg.Value(k) == "" {
+			t.Errorf("Value(%q) is empty", k)
+		}
+	}
+
+	// Setting a key to the empty string removes it.
+	cfg = SetValue(cfg, "alpha", "")
+	want = []string{"mid", "zeta"}
+	if got := ListValueKeys(cfg); !reflect.DeepEqual(got, want) {
+		t.Errorf("ListValueKeys after clearing alpha = %q, want %q", got, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	a := SetUserName(New(), "ann@example.com")
+	a = SetValue(a, "dirserver_timeout", "1m")
+	if diff := Diff(a, SetPacking(a, a.Packing())); diff != nil {
+		t.Errorf("Diff of equivalent configs = %q, want nil", diff)
+	}
+
+	store := upspin.Endpoint{Transport: upspin.Remote, NetAddr: "store.example.com:443"}
+	tests := []struct {
+		cfg  upspin.Config
+		want []string
+	}{
+		{SetUserName(a, "bob@example.com"), []string{"UserName changed from ann@example.com to bob@example.com"}},
+		{SetKeyEndpoint(a, upspin.Endpoint{}), []string{"KeyEndpoint changed from remote,key.upspin.io:443 to unassigned"}},
+		{SetDirEndpoint(a, store), []string{"DirEndpoint changed from unassigned to remote,store.example.com:443"}},
+		{SetStoreEndpoint(a, store), []string{"StoreEndpoint changed from unassigned to remote,store.example.com:443"}},
+		{SetCacheEndpoint(a, store), []string{"CacheEndpoint changed from unassigned to remote,store.example.com:443"}},
+		{SetPacking(a, upspin.PlainPack), []string{"Packing changed from ee to plain"}},
+		{SetFactotum(a, stubFactotum{}), []string{"Factotum added"}},
+		{SetValue(a, "dirserver_timeout", "2m"), []string{`value of "dirserver_timeout" changed from "1m" to "2m"`}},
+		{SetValue(a, "keyserver_timeout", "5s"), []string{`value of "keyserver_timeout" changed from "" to "5s"`}},
+		{
+			SetStoreEndpoint(SetUserName(a, "bob@example.com"), store),
+			[]string{
+				"UserName changed from ann@example.com to bob@example.com",
+				"StoreEndpoint changed from unassigned to remote,store.example.com:443",
+			},
+		},
+	}
+	for _, test := range tests {
+		if got := Diff(a, test.cfg); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Diff = %q, want %q", got, test.want)
+		}
+	}
+	if got, want := Diff(SetFactotum(a, stubFactotum{}), a), []string{"Factotum removed"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff = %q, want %q", got, want)
+	}
+
+	// A key set to the empty value in one config is reported once.
+	empty := SetValue(a, "keyserver_timeout", "")
+	want := []string{`value of "keyserver_timeout" changed from "" to "5s"`}
+	if got := Diff(empty, SetValue(a, "keyserver_timeout", "5s")); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff = %q, want %q", got, want)
+	}
+}
+
+// stubFactotum is a non-nil upspin.Factotum for tests that
+// only check its presence.
+type stubFactotum struct {
+	upspin.Factotum
+}
+
+func TestToMap(t *testing.T) {
+	dir := upspin.Endpoint{Transport: upspin.Remote, NetAddr: "dir.example.com:443"}
+	cfg := SetUserName(New(), "ann@example.com")
+	cfg = SetDirEndpoint(cfg, dir)
+	cfg = SetStoreEndpoint(cfg, upspin.Endpoint{Transport: upspin.InProcess})
+	cfg = SetValue(cfg, "dirserver_timeout", "1m")
+
+	m := ToMap(cfg)
+	want := map[string]string{
+		"username":          "ann@example.com",
+		"packing":           "ee",
+		"keyserver":         "remote,key.upspin.io:443",
+		"dirserver":         "remote,dir.example.com:443",
+		"storeserver":       "inprocess",
+		"cache":             "unassigned",
+		"factotum":          "none",
+		"dirserver_timeout": "1m",
+	}
+	if !reflect.DeepEqual(m, want) {
+		t.Errorf("ToMap = %v, want %v", m, want)
+	}
+	endpoints := map[string]upspin.Endpoint{
+		"keyserver":   cfg.KeyEndpoint(),
+		"dirserver":   cfg.DirEndpoint(),
+		"storeserver": cfg.StoreEndpoint(),
+		"cache":       cfg.CacheEndpoint(),
+	}
+	for k, ep := range endpoints {
+		got, err := upspin.ParseEndpoint(m[k])
+		if err != nil {
+			t.Errorf("%s: %v", k, err)
+			continue
+		}
+		if *got != ep {
+			t.Errorf("%s: parsed %v, want %v", k, *got, ep)
+		}
+	}
+
+	if got := ToMap(SetFactotum(cfg, stubFactotum{}))["factotum"]; got != "present" {
+		t.Errorf("factotum = %q, want present", got)
+	}
+}
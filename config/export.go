@@ -0,0 +1,91 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"strings"
+
+	"upspin.io/upspin"
+)
+
+// Export returns the config as a list of environment variables of the
+// form "UPSPIN_KEY=value", suitable for the Env field of an exec.Cmd.
+// A process started with those variables, and no config file, can
+// recreate the config by calling FromEnvironment.
+//
+// The Factotum's keys are never exported. Instead, if the config has a
+// Factotum, UPSPIN_SECRETS names the directory from which it was loaded,
+// if that is known; if the config has no Factotum, UPSPIN_SECRETS is
+// "none". A Factotum loaded from the environment is not exported.
+// Command flags cannot be expressed as environment variables and are
+// also omitted.
+func Export(cfg upspin.Config) []string {
+	var env []string
+	add := func(key, val string) {
+		env = append(env, defaultEnvPrefix+strings.ToUpper(key)+"="+val)
+	}
+
+	add(username, string(cfg.UserName()))
+	add(packing, cfg.Packing().String())
+
+	// The key server is always exported, as its default is not unassigned.
+	add(keyserver, cfg.KeyEndpoint().String())
+	if e := cfg.DirEndpoint(); e.Transport != upspin.Unassigned {
+		add(dirserver, e.String())
+	}
+	if e := cfg.StoreEndpoint(); e.Transport != upspin.Unassigned {
+		add(storeserver, e.String())
+	}
+	if eps := StoreEndpoints(cfg); len(eps) > 1 {
+		var list []string
+		for _, e := range eps {
+			list = append(list, e.String())
+		}
+		add(storeservers, strings.Join(list, " "))
+	}
+	if e := cfg.CacheEndpoint(); e.Transport != upspin.Unassigned {
+		add(cache, e.String())
+	}
+
+	for _, k := range timeoutKeys {
+		if v := cfg.Value(k); v != "" {
+			add(k, v)
+		}
+	}
+	for _, k := range retryKeys {
+		if v := cfg.Value(k); v != "" {
+			add(k, v)
+		}
+	}
+	if v := cfg.Value(proxy); v != "" {
+		add(proxy, v)
+	}
+	if v := cfg.Value(upspinHome); v != "" {
+		add(upspinHome, v)
+	}
+	if v := cfg.Value(credentialsFile); v != "" {
+		add(credentialsFile, v)
+	}
+	for _, k := range tlsNameKeys {
+		if v := cfg.Value(k); v != "" {
+			add(k, v)
+		}
+	}
+	for _, k := range cacheKeys {
+		if v := cfg.Value(k); v != "" {
+			add(k, v)
+		}
+	}
+
+	if cfg.Factotum() == nil {
+		add(secrets, "none")
+	} else if dir := factotumDir(cfg); dir != "" && dir != "env" {
+		add(secrets, dir)
+	}
+	if dir := TLSCerts(cfg); dir != "" {
+		add(tlscerts, dir)
+	}
+	return env
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"upspin.io/upspin"
+)
+
+func TestExport(t *testing.T) {
+	certsDir, err := filepath.Abs("../rpc/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configs := []string{
+		`
+username: ann@example.com
+packing: plain
+keyserver: inprocess
+dirserver: remote,dir.example.com
+storeservers: ["store.example.com:8080", "backup.example.com"]
+cache: remote,cache.example.com:5580
+dirserver_timeout: 1m30s
+storeserver_retry: {max_attempts: 3, initial_backoff: 1s, max_backoff: 30s}
+proxy: http://proxy.example.com:3128
+tlscerts: ` + certsDir + `
+secrets: ` + secretsDir + `
+`,
+		`
+username: bob@example.com
+storeserver: store.example.com
+secrets: none
+`,
+	}
+	for _, c := range configs {
+		cfg, err := InitConfig(strings.NewReader(c))
+		if err != nil && err != ErrNoFactotum {
+			t.Fatalf("InitConfig(%q): %v", c, err)
+		}
+		env := Export(cfg)
+		got, err := fromEnv(env)
+		if err != nil && err != ErrNoFactotum {
+			t.Fatalf("FromEnvironment with %q: %v", env, err)
+		}
+		if diff := Diff(cfg, got); diff != nil {
+			t.Errorf("config from %q differs:\n%s", env, strings.Join(diff, "\n"))
+		}
+		if TLSCerts(got) != TLSCerts(cfg) {
+			t.Errorf("TLSCerts() = %q, want %q", TLSCerts(got), TLSCerts(cfg))
+		}
+		if f := cfg.Factotum(); f != nil && got.Factotum().PublicKey() != f.PublicKey() {
+			t.Errorf("Factotum().PublicKey() = %q, want %q", got.Factotum().PublicKey(), f.PublicKey())
+		}
+	}
+
+	// A Factotum installed without a directory is not exported.
+	cfg, err := InitConfig(strings.NewReader("secrets: " + secretsDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg = SetFactotum(cfg, cfg.Factotum())
+	for _, v := range Export(cfg) {
+		if strings.HasPrefix(v, "UPSPIN_SECRETS=") {
+			t.Errorf("Export included %q", v)
+		}
+	}
+}
+
+// fromEnv calls FromEnvironment with the given variables set,
+// restoring the environment before it returns.
+func fromEnv(env []string) (upspin.Config, error) {
+	for _, kv := range env {
+		i := strings.Index(kv, "=")
+		k := kv[:i]
+		if old, ok := os.LookupEnv(k); ok {
+			defer os.Setenv(k, old)
+		} else {
+			defer os.Unsetenv(k)
+		}
+		os.Setenv(k, kv[i+1:])
+	}
+	return FromEnvironment()
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"runtime"
+
+	"upspin.io/upspin"
+)
+
+// frozen is implemented by configs that must not be the base of
+// a config derived by the Set functions of this package.
+type frozen interface {
+	isFrozen() bool
+}
+
+// frozenConfig is a config returned by Freeze.
+type frozenConfig struct {
+	upspin.Config
+}
+
+func (frozenConfig) isFrozen() bool { return true }
+
+// Freeze returns a config with the same values as cfg that cannot be
+// used as the base of a new config: passing it to any of the Set
+// functions of this package, such as SetUserName or SetValue, panics.
+// It lets a program hand its config to library code without the risk
+// that the library quietly derives a config that shadows its values.
+// A copy that may be modified is made by Clone.
+func Freeze(cfg upspin.Config) upspin.Config {
+	if f, ok := cfg.(frozen); ok && f.isFrozen() {
+		return cfg
+	}
+	return frozenConfig{Config: cfg}
+}
+
+// checkFrozen panics if cfg is frozen. It is called at the start of
+// the Set function named fn, and the panic reports that function's caller.
+func checkFrozen(cfg upspin.Config, fn string) {
+	f, ok := cfg.(frozen)
+	if !ok || !f.isFrozen() {
+		return
+	}
+	where := "unknown location"
+	if _, file, line, ok := runtime.Caller(2); ok {
+		where = fmt.Sprintf("%s:%d", file, line)
+	}
+	panic(fmt.Sprintf("config.%s called on a frozen config at %s", fn, where))
+}
+
+// unfreeze returns the config wrapped by Freeze, or cfg if it is not frozen.
+func unfreeze(cfg upspin.Config) upspin.Config {
+	if f, ok := cfg.(frozenConfig); ok {
+		return f.Config
+	}
+	return cfg
+}
@@ -0,0 +1,94 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"upspin.io/upspin"
+)
+
+func TestFreeze(t *testing.T) {
+	cfg, err := InitConfig(strings.NewReader(`
+username: ann@example.com
+dirserver: dir.example.com
+storeservers: [store1.example.com, store2.example.com]
+dirserver_timeout: 1m
+secrets: ` + secretsDir + `
+cmdflags:
+ upspinfs:
+  cachedir: /tmp
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frozen := Freeze(cfg)
+
+	// Reads see the values of the original.
+	if !Equal(frozen, cfg) {
+		t.Fatalf("Freeze changed the config: %q", Diff(frozen, cfg))
+	}
+	if frozen.Factotum() != cfg.Factotum() {
+		t.Errorf("Freeze changed the Factotum")
+	}
+	if got, want := len(StoreEndpoints(frozen)), 2; got != want {
+		t.Errorf("len(StoreEndpoints) = %d, want %d", got, want)
+	}
+	if got, want := frozen.Value("dirserver_timeout"), "1m"; got != want {
+		t.Errorf("Value(dirserver_timeout) = %q, want %q", got, want)
+	}
+	if _, ok := Freeze(frozen).(frozenConfig).Config.(frozenConfig); ok {
+		t.Errorf("Freeze of a frozen config wraps it again")
+	}
+
+	// Every Set function panics, reporting the caller.
+	sets := map[string]func(upspin.Config){
+		"SetUserName":       func(c upspin.Config) { SetUserName(c, "bob@example.com") },
+		"SetFactotum":       func(c upspin.Config) { SetFactotum(c, nil) },
+		"SetPacking":        func(c upspin.Config) { SetPacking(c, upspin.PlainPack) },
+		"SetKeyEndpoint":    func(c upspin.Config) { SetKeyEndpoint(c, upspin.Endpoint{}) },
+		"SetStoreEndpoint":  func(c upspin.Config) { SetStoreEndpoint(c, upspin.Endpoint{}) },
+		"SetStoreEndpoints": func(c upspin.Config) { SetStoreEndpoints(c, nil) },
+		"SetCacheEndpoint":  func(c upspin.Config) { SetCacheEndpoint(c, upspin.Endpoint{}) },
+		"SetDirEndpoint":    func(c upspin.Config) { SetDirEndpoint(c, upspin.Endpoint{}) },
+		"SetCertPool":       func(c upspin.Config) { SetCertPool(c, nil) },
+		"SetTLSCerts":       func(c upspin.Config) { SetTLSCerts(c, "") },
+		"SetFlags":          func(c upspin.Config) { SetFlags(c, nil) },
+		"SetValue":          func(c upspin.Config) { SetValue(c, "k", "v") },
+		"SetRetryPolicy":    func(c upspin.Config) { SetRetryPolicy(c, "dirserver", DefaultRetryPolicy) },
+	}
+	for name, set := range sets {
+		msg := panicMessage(func() { set(frozen) })
+		if !strings.Contains(msg, "config."+name) || !strings.Contains(msg, "freeze_test.go:") {
+			t.Errorf("%s: panic %q, want one naming the function and caller", name, msg)
+		}
+		if msg := panicMessage(func() { set(cfg) }); msg != "" {
+			t.Errorf("%s: unfrozen config: panic %q", name, msg)
+		}
+	}
+
+	// A clone is not frozen.
+	clone := Clone(frozen)
+	if !Equal(clone, cfg) {
+		t.Errorf("Clone of frozen config differs: %q", Diff(clone, cfg))
+	}
+	if msg := panicMessage(func() { SetUserName(clone, "bob@example.com") }); msg != "" {
+		t.Errorf("SetUserName of clone: panic %q", msg)
+	}
+}
+
+// panicMessage calls fn and returns the value with which it panicked,
+// formatted as a string, or the empty string if it did not panic.
+func panicMessage(fn func()) (msg string) {
+	defer func() {
+		if r := recover(); r != nil {
+			msg = fmt.Sprint(r)
+		}
+	}()
+	fn()
+	return ""
+}
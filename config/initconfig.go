@@ -2,19 +2,24 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// Package config creates a client configuration from various sources.
-package config // import "upspin.io/config"
+package config
 
 import (
+	"bytes"
 	"crypto/x509"
+	"encoding/base64"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	osuser "os/user"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 
@@ -45,12 +50,22 @@ func (base) StoreEndpoint() upspin.Endpoint { return upspin.Endpoint{} }
 func (base) CacheEndpoint() upspin.Endpoint { return upspin.Endpoint{} }
 func (base) CertPool() *x509.CertPool       { return nil }
 func (base) Flags(string) map[string]string { return nil }
+func (base) Value(string) string            { return "" }
 
 // New returns a config with all fields set as defaults.
 func New() upspin.Config {
 	return base{}
 }
 
+// MakeDefault returns a config holding only the safe defaults:
+// the user name is empty, all endpoints except the key server are
+// unassigned, and the packing is "ee". Unlike New, it does not
+// provide a placeholder user name, so a config derived from it
+// makes clear which values were never set.
+func MakeDefault() upspin.Config {
+	return SetUserName(New(), "")
+}
+
 var (
 	defaultUserName    = upspin.UserName("noone@nowhere.org")
 	defaultPacking     = upspin.EEPack
@@ -62,42 +77,285 @@ var (
 
 // Known keys. All others are treated as errors.
 const (
-	username    = "username"
-	keyserver   = "keyserver"
-	dirserver   = "dirserver"
-	storeserver = "storeserver"
-	cache       = "cache"
-	packing     = "packing"
-	secrets     = "secrets"
-	tlscerts    = "tlscerts"
+	username     = "username"
+	keyserver    = "keyserver"
+	dirserver    = "dirserver"
+	storeserver  = "storeserver"
+	storeservers = "storeservers"
+	cache        = "cache"
+	packing      = "packing"
+	secrets      = "secrets"
+	tlscerts     = "tlscerts"
+	proxy        = "proxy"
+	upspinHome   = "upspin_home"
 )
 
+// timeoutSuffix is appended to the name of a server key (keyserver,
+// dirserver, storeserver, or cache) to form the key holding the dial
+// timeout for that server.
+const timeoutSuffix = "_timeout"
+
+// timeoutKeys lists the known keys that hold dial timeouts.
+var timeoutKeys = []string{
+	keyserver + timeoutSuffix,
+	dirserver + timeoutSuffix,
+	storeserver + timeoutSuffix,
+	cache + timeoutSuffix,
+}
+
+// tlsNameSuffix is appended to the name of a server key (keyserver,
+// dirserver, or storeserver) to form the key holding the name expected
+// in that server's TLS certificate.
+const tlsNameSuffix = "_tls_name"
+
+// tlsNameKeys lists the known keys that hold TLS server names.
+var tlsNameKeys = []string{
+	keyserver + tlsNameSuffix,
+	dirserver + tlsNameSuffix,
+	storeserver + tlsNameSuffix,
+}
+
+// DefaultDialTimeout is the time allowed to connect to a server
+// for which the config specifies no timeout.
+const DefaultDialTimeout = 30 * time.Second
+
+// profilesKey is the key holding the named profiles in a config file.
+const profilesKey = "profiles"
+
+// include is the key naming a config file to be included by FromFile.
+const include = "include"
+
 // ErrNoFactotum indicates that the returned config contains no Factotum, and
 // that the user requested this by setting secrets=none in the configuration.
 var ErrNoFactotum = errors.Str("factotum not initialized: no secrets provided")
 
+// NoFactotumError reports why the keys in a secrets directory could not
+// be loaded. The Reason is "missing" if the directory holds no keys, or
+// "invalid" if its keys could not be parsed. In either case InitConfig
+// returns no config and an *errors.Error wrapping the NoFactotumError.
+// A config whose secrets key is "none" instead yields ErrNoFactotum itself.
+type NoFactotumError struct {
+	Reason     string
+	SecretsDir string
+
+	err error // The error that caused the failure, if any.
+}
+
+func (e *NoFactotumError) Error() string {
+	if e.Reason == "missing" {
+		return fmt.Sprintf("factotum not initialized: no keys in %s: %v", e.SecretsDir, e.err)
+	}
+	return fmt.Sprintf("factotum not initialized: invalid keys in %s: %v", e.SecretsDir, e.err)
+}
+
+// An InitOption modifies the behavior of InitConfig, FromFile, and ConfigDir.
+type InitOption func(*initOptions)
+
+// initOptions holds the settings made by a list of InitOptions.
+type initOptions struct {
+	readOnly    bool   // Do not create the config directory.
+	profile     string // Name of the profile to apply, if any.
+	defaultPort string // Port for remote endpoints without one; empty requires a port.
+}
+
+// WithReadOnly returns an InitOption that stops ConfigDir and ConfigFile
+// creating the Upspin configuration directory; a missing directory is
+// reported as an error instead. It is intended for sandboxed programs
+// and read-only file systems. The functions that load a config, such as
+// InitConfig and FromFile, never write to the file system, so they accept
+// the option but are not affected by it.
+func WithReadOnly() InitOption {
+	return func(o *initOptions) {
+		o.readOnly = true
+	}
+}
+
+// WithProfile returns an InitOption that applies the named profile.
+// A config file may hold a profiles key mapping profile names to sets
+// of keys and values. The values in the named profile override those
+// at the top level of the file, for example:
+//	username: ann@example.com
+//	secrets: /home/ann/.ssh
+//	profiles:
+//	  work:
+//	    username: ann@work.example.com
+//	    dirserver: dir.work.example.com
+//	  test:
+//	    secrets: none
+// An empty name selects no profile, so only the top-level values are used.
+func WithProfile(name string) InitOption {
+	return func(o *initOptions) {
+		o.profile = name
+	}
+}
+
+// WithDefaultPort returns an InitOption that sets the port assumed for
+// remote endpoints whose address has none. By default it is "443".
+// If port is empty, such endpoints are an error, which is useful when
+// servers listen on non-standard ports and a forgotten port would
+// otherwise lead to a confusing connection failure.
+func WithDefaultPort(port string) InitOption {
+	return func(o *initOptions) {
+		o.defaultPort = port
+	}
+}
+
+// makeInitOptions returns the settings made by the given options.
+func makeInitOptions(opts []InitOption) *initOptions {
+	o := &initOptions{defaultPort: defaultPort}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
 // FromFile initializes a config using the given file. If the file cannot
-// be opened but the name can be found in $HOME/upspin, that file is used.
+// be opened but the name can be found in $HOME/upspin or, failing that,
+// in $XDG_CONFIG_HOME/upspin, that file is used.
+//
+// The file may contain an include key naming another config file, whose
+// keys are read first and then overridden by those in the including file.
+// The included file may include another in turn, but not circularly.
+// A relative name is interpreted relative to the directory of the
+// including file, as are relative secrets and tlscerts directories and
+// other file names given in the included file.
+// Unlike FromFile, InitConfig does not support include.
+// If the name is an HTTP or HTTPS URL, the config is fetched using FromURL.
 // As with InitConfig, environment variables may override the
-// values in the config file.
-func FromFile(name string) (upspin.Config, error) {
+// values in the config file. Relative secrets and tlscerts directories
+// are interpreted relative to the directory holding the file.
+// A file whose name has the extension ".toml" is read as TOML rather
+// than YAML; see InitConfigTOML. Either kind may include the other.
+func FromFile(name string, opts ...InitOption) (upspin.Config, error) {
+	if isURL(name) {
+		return FromURL(name, nil, opts...)
+	}
 	f, err := os.Open(name)
 	if err != nil && !filepath.IsAbs(name) && os.IsNotExist(err) {
 		// It's a local name, so, try adding $HOME/upspin
-		home, errHome := Homedir()
-		if errHome == nil {
-			f, err = os.Open(filepath.Join(home, "upspin", name))
+		// and then $XDG_CONFIG_HOME/upspin.
+		for _, dir := range configDirs() {
+			f, err = os.Open(filepath.Join(dir, name))
+			if err == nil || !os.IsNotExist(err) {
+				break
+			}
 		}
 	}
+	const op = "config.FromFile"
 	if err != nil {
-		const op = "config.FromFile"
 		if os.IsNotExist(err) {
 			return nil, errors.E(op, errors.NotExist, err)
 		}
 		return nil, errors.E(op, err)
 	}
-	defer f.Close()
-	return InitConfig(f)
+	name = f.Name()
+	f.Close()
+	data, err := readConfigFile(name, make(map[string]bool))
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	return FromReader(bytes.NewReader(data), filepath.Dir(name), opts...)
+}
+
+// readConfigFile returns the contents of the named config file with any
+// include directive expanded: the keys of the file override those of the
+// included file, which may itself include another. A relative include
+// path is interpreted relative to the directory of the including file.
+// Relative file and directory names in an included file are made
+// absolute, so they remain relative to the file that names them.
+// The seen map records the files already read, to detect circular includes.
+func readConfigFile(name string, seen map[string]bool) ([]byte, error) {
+	name, err := filepath.Abs(name)
+	if err != nil {
+		return nil, errors.E(errors.IO, err)
+	}
+	if seen[name] {
+		return nil, errors.E(errors.Invalid, errors.Errorf("circular include of %q", name))
+	}
+	seen[name] = true
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, errors.E(errors.IO, err)
+	}
+	if isTOML(name) {
+		data, err = tomlToYAML(data)
+		if err != nil {
+			return nil, errors.E(errors.Invalid, errors.Errorf("parsing TOML file %q: %v", name, err))
+		}
+	}
+	vals := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, vals); err != nil {
+		return nil, errors.E(errors.Invalid, errors.Errorf("parsing YAML file %q: %v", name, err))
+	}
+	v, ok := vals[include]
+	if !ok {
+		return data, nil
+	}
+	incl, err := asString(v)
+	if err != nil {
+		return nil, errors.E(errors.Invalid, errors.Errorf("%q: include: %v", name, err))
+	}
+	if !filepath.IsAbs(incl) {
+		incl = filepath.Join(filepath.Dir(name), incl)
+	}
+	inclData, err := readConfigFile(incl, seen)
+	if err != nil {
+		return nil, err
+	}
+	merged := map[string]interface{}{}
+	if err := yaml.Unmarshal(inclData, merged); err != nil {
+		return nil, errors.E(errors.Invalid, errors.Errorf("parsing YAML file %q: %v", incl, err))
+	}
+	resolvePaths(merged, filepath.Dir(incl))
+	for k, v := range vals {
+		if k != include {
+			merged[k] = v
+		}
+	}
+	data, err = yaml.Marshal(merged)
+	if err != nil {
+		return nil, errors.E(errors.Invalid, err)
+	}
+	return data, nil
+}
+
+// FromFileWithProfile is like FromFile but applies the named profile
+// from the file; see WithProfile.
+func FromFileWithProfile(name, profile string) (upspin.Config, error) {
+	return FromFile(name, WithProfile(profile))
+}
+
+// ParseProfiles reads a config file and returns the config for each
+// profile defined in it, keyed by profile name; see WithProfile.
+// A profile whose secrets key is "none" yields a config without a
+// Factotum, as with InitConfig, but this is not reported as an error.
+func ParseProfiles(r io.Reader) (map[string]upspin.Config, error) {
+	const op = "config.ParseProfiles"
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	names, err := profileNames(data)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	cfgs := make(map[string]upspin.Config)
+	for _, name := range names {
+		cfg, err := InitConfig(bytes.NewReader(data), WithProfile(name))
+		if err != nil && err != ErrNoFactotum {
+			return nil, errors.E(op, errors.Errorf("profile %q: %v", name, err))
+		}
+		cfgs[name] = cfg
+	}
+	return cfgs, nil
+}
+
+// FromEnvironment returns a config generated from environment variables
+// alone, without reading a config file. It is equivalent to calling
+// InitConfig with an empty config file; see InitConfig for the names
+// of the variables.
+func FromEnvironment(opts ...InitOption) (upspin.Config, error) {
+	return InitConfig(strings.NewReader(""), opts...)
 }
 
 // InitConfig returns a config generated from a configuration file and/or
@@ -105,58 +363,76 @@ func FromFile(name string) (upspin.Config, error) {
 //
 // A configuration file should be of the format
 //   # lines that begin with a hash are ignored
-//   key = value
+//   key: value
 // where key may be one of username, keyserver, dirserver, storeserver,
-// packing, secrets, or tlscerts.
+// packing, secrets, tlscerts, or one of the other keys described in
+// the package documentation, which also gives their defaults.
 //
-// The default configuration file location is $HOME/upspin/config.
+// The default configuration file location is $HOME/upspin/config;
+// see DefaultConfigPath.
 // If passed a non-nil io.Reader, that is used instead of the default file.
 //
-// Environment variables named "upspinkey", where "key" is a recognized
-// configuration key, may override configuration values in the config file.
-//
-// Any endpoints (keyserver, dirserver, storeserver) not set in the data for
-// the config will be set to the "unassigned" transport and an empty network
-// address, except keyserver which defaults to "remote,key.upspin.io:443".
-// If an endpoint is specified without a transport it is assumed to be
-// the address component of a remote endpoint.
-// If a remote endpoint is specified without a port in its address component
-// the port is assumed to be 443.
+// Environment variables named "UPSPIN_KEY" supply values for keys not set
+// in the config file, and variables named "upspinkey", where "key" is a
+// recognized configuration key, override them.
 //
-// The default value for packing is "ee".
-//
-// The default value for secrets is "$HOME/.ssh".
-// The special value "none" indicates there are no secrets to load;
-// in this case, the returned config will not include a Factotum
+// If secrets is "none", the returned config will not include a Factotum
 // and the returned error is ErrNoFactotum.
 //
-// The tlscerts key specifies a directory containing PEM certificates define
-// the certificate pool used for verifying client TLS connections,
-// replacing the root certificate list provided by the operating system.
-// Files without the suffix ".pem" are ignored.
-// The default value for tlscerts is the empty string,
-// in which case just the system roots are used.
-func InitConfig(r io.Reader) (upspin.Config, error) {
-	const op = "config.InitConfig"
+// The provided InitOptions, if any, modify how the config is loaded.
+func InitConfig(r io.Reader, opts ...InitOption) (upspin.Config, error) {
+	return initConfig("config.InitConfig", r, "", opts)
+}
+
+// FromReader is like InitConfig, but relative secrets and tlscerts
+// directories given in the YAML read from r are interpreted relative
+// to baseDir, typically the directory holding the config file.
+// If baseDir is empty, they are relative to the current directory.
+func FromReader(r io.Reader, baseDir string, opts ...InitOption) (upspin.Config, error) {
+	return initConfig("config.FromReader", r, baseDir, opts)
+}
+
+// initConfig implements InitConfig and FromReader,
+// using op to identify errors.
+func initConfig(op string, r io.Reader, baseDir string, opts []InitOption) (upspin.Config, error) {
+	o := makeInitOptions(opts)
 	vals := map[string]string{
-		username:    string(defaultUserName),
-		packing:     defaultPacking.String(),
-		keyserver:   defaultKeyEndpoint.String(),
-		dirserver:   "",
-		storeserver: "",
-		cache:       "no",
-		secrets:     "",
-		tlscerts:    "",
+		username:     string(defaultUserName),
+		packing:      defaultPacking.String(),
+		keyserver:    defaultKeyEndpoint.String(),
+		dirserver:    "",
+		storeserver:  "",
+		storeservers: "",
+		cache:        "no",
+		secrets:      "",
+		tlscerts:     "",
+		proxy:        "",
+		upspinHome:   "",
+
+		credentialsFile: "",
+	}
+	for _, k := range timeoutKeys {
+		vals[k] = ""
+	}
+	for _, k := range retryKeys {
+		vals[k] = ""
+	}
+	for _, k := range cacheKeys {
+		vals[k] = ""
+	}
+	for _, k := range tlsNameKeys {
+		vals[k] = ""
 	}
 	cmdFlagVals := make(map[string]map[string]string)
 
-	// If the provided reader is nil, try $HOME/upspin/config.
+	// If the provided reader is nil, try $UPSPIN_HOME/config or
+	// $HOME/upspin/config and then $XDG_CONFIG_HOME/upspin/config.
 	if r == nil {
-		home, err := Homedir()
-		if err != nil {
-			return nil, errors.E(op, err)
+		name := DefaultConfigPath()
+		if name == "" {
+			return nil, errors.E(op, errors.NotExist, errors.Str("cannot find home directory"))
 		}
-		f, err := os.Open(filepath.Join(home, "upspin/config"))
+		f, err := os.Open(name)
 		if err != nil {
 			return nil, errors.E(op, err)
 		}
@@ -164,14 +440,28 @@ func InitConfig(r io.Reader) (upspin.Config, error) {
 		defer f.Close()
 	}
 
+	// Environment variables such as UPSPIN_USERNAME supply
+	// values for keys absent from the YAML file.
+	valsFromDefaultEnvironment(vals)
+
 	// First source of truth is the YAML file.
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
 		return nil, errors.E(op, err)
 	}
-	if err := valsFromYAML(vals, cmdFlagVals, data); err != nil {
+	dirs := make(map[string]string)
+	for _, k := range pathKeys {
+		dirs[k] = vals[k]
+	}
+	if err := valsFromYAML(vals, cmdFlagVals, data, o.profile); err != nil {
 		return nil, errors.E(op, err)
 	}
+	for k, prev := range dirs {
+		// Resolve directories and files named in the YAML against baseDir.
+		if dir := vals[k]; dir != prev {
+			vals[k] = resolveDir(baseDir, dir)
+		}
+	}
 
 	// Then override with environment variables.
 	if err := valsFromEnvironment(vals); err != nil {
@@ -194,33 +484,67 @@ func InitConfig(r io.Reader) (upspin.Config, error) {
 	}
 	cfg = SetPacking(cfg, packer.Packing())
 
+	if v := vals[proxy]; v != "" {
+		if _, err := parseProxyURL(v); err != nil {
+			return nil, errors.E(op, errors.Invalid, errors.Errorf("%s: %v", proxy, err))
+		}
+		cfg = SetValue(cfg, proxy, v)
+	}
+	if v := vals[credentialsFile]; v != "" {
+		cfg = SetValue(cfg, credentialsFile, v)
+	}
+	if v := vals[upspinHome]; v != "" {
+		cfg = SetValue(cfg, upspinHome, v)
+	}
+	for _, k := range cacheKeys {
+		v := vals[k]
+		if v == "" {
+			continue
+		}
+		if err := checkCacheValue(k, v); err != nil {
+			return nil, errors.E(op, errors.Invalid, err)
+		}
+		cfg = SetValue(cfg, k, v)
+	}
+
 	if dir := vals[tlscerts]; dir != "" {
-		pool, err := certPoolFromDir(dir)
+		cfg, err = setTLSCerts(cfg, dir)
 		if err != nil {
 			return nil, errors.E(op, err)
 		}
-		if pool != nil {
-			cfg = SetCertPool(cfg, pool)
-		} else {
-			log.Info.Printf("config: no PEM certificates found in %q", dir)
-		}
 	}
 
 	dir := vals[secrets]
 	if dir == "" {
-		dir, err = sshdir()
+		dir, err = sshdir(vals[upspinHome])
 		if err != nil {
 			return nil, errors.E(op, errors.Errorf("cannot find .ssh directory: %v", err))
 		}
 	}
-	if dir == "none" {
+	switch dir {
+	case "none":
 		err = ErrNoFactotum
-	} else {
-		f, err := factotum.NewFromDir(dir)
+	case "env":
+		f, err := factotumFromEnvironment()
 		if err != nil {
 			return nil, errors.E(op, err)
 		}
-		cfg = SetFactotum(cfg, f)
+		cfg = cfgFactotum{Config: cfg, factotum: f, secrets: dir}
+	case "keychain":
+		f, err := factotum.NewFromKeychain(username)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		cfg = cfgFactotum{Config: cfg, factotum: f, secrets: dir}
+	default:
+		f, err := factotum.NewFromDir(dir)
+		if errors.Match(errors.E(errors.NotExist), err) {
+			return nil, errors.E(op, errors.NotExist, &NoFactotumError{Reason: "missing", SecretsDir: dir, err: err})
+		}
+		if err != nil {
+			return nil, errors.E(op, errors.Invalid, &NoFactotumError{Reason: "invalid", SecretsDir: dir, err: err})
+		}
+		cfg = cfgFactotum{Config: cfg, factotum: f, secrets: dir}
 		// This must be done before bind so that keys are ready for authenticating to servers.
 	}
 
@@ -228,9 +552,65 @@ func InitConfig(r io.Reader) (upspin.Config, error) {
 		cfg = SetFlags(cfg, cmdFlagVals)
 	}
 
-	cfg = SetKeyEndpoint(cfg, parseEndpoint(op, vals, keyserver, &err))
-	cfg = SetStoreEndpoint(cfg, parseEndpoint(op, vals, storeserver, &err))
-	cfg = SetDirEndpoint(cfg, parseEndpoint(op, vals, dirserver, &err))
+	for _, k := range timeoutKeys {
+		v := vals[k]
+		if v == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(v); err != nil || d <= 0 {
+			return nil, errors.E(op, errors.Invalid, errors.Errorf("%s: invalid duration %q", k, v))
+		}
+		cfg = SetValue(cfg, k, v)
+	}
+	for _, k := range tlsNameKeys {
+		v := vals[k]
+		if v == "" {
+			continue
+		}
+		if strings.ContainsAny(v, ":/ \t") {
+			return nil, errors.E(op, errors.Invalid, errors.Errorf("%s: invalid host name %q", k, v))
+		}
+		cfg = SetValue(cfg, k, v)
+	}
+	for _, k := range retryKeys {
+		v := vals[k]
+		if v == "" {
+			continue
+		}
+		p, err := parseRetryPolicy(v)
+		if err != nil {
+			return nil, errors.E(op, errors.Invalid, errors.Errorf("%s: %v", k, err))
+		}
+		cfg = SetRetryPolicy(cfg, strings.TrimSuffix(k, retrySuffix), p)
+	}
+
+	cfg = SetKeyEndpoint(cfg, parseEndpoint(op, vals, keyserver, o.defaultPort, &err))
+	if cfg.UserName() != defaultUserName && DomainMismatch(cfg) {
+		log.Info.Printf("config: key server %s may not serve the domain of user %s", cfg.KeyEndpoint(), cfg.UserName())
+	}
+	cfg = SetStoreEndpoint(cfg, parseEndpoint(op, vals, storeserver, o.defaultPort, &err))
+	if list := vals[storeservers]; list != "" {
+		// The storeserver key, if set, gives the first endpoint.
+		var eps []upspin.Endpoint
+		if e := cfg.StoreEndpoint(); e.Transport != upspin.Unassigned {
+			eps = append(eps, e)
+		}
+	Fields:
+		for _, text := range strings.Fields(list) {
+			e := parseEndpoint(op, map[string]string{storeservers: text}, storeservers, o.defaultPort, &err)
+			if e.Transport == upspin.Unassigned {
+				continue
+			}
+			for _, prev := range eps {
+				if e == prev {
+					continue Fields
+				}
+			}
+			eps = append(eps, e)
+		}
+		cfg = SetStoreEndpoints(cfg, eps)
+	}
+	cfg = SetDirEndpoint(cfg, parseEndpoint(op, vals, dirserver, o.defaultPort, &err))
 
 	// A shorthand for the default local address.
 	// TODO(p): phase out the ability to specify an address, yes or no should suffice.
@@ -240,18 +620,159 @@ func InitConfig(r io.Reader) (upspin.Config, error) {
 	case "n", "no", "false":
 		vals[cache] = ""
 	}
-	cfg = SetCacheEndpoint(cfg, parseEndpoint(op, vals, cache, &err))
+	cfg = SetCacheEndpoint(cfg, parseEndpoint(op, vals, cache, o.defaultPort, &err))
 
-	return cfg, err
+	return cfgLoadTime{Config: cfg, loaded: time.Now()}, err
+}
+
+// pathKeys lists the keys whose values name files or directories,
+// which are interpreted relative to the directory of the config file.
+var pathKeys = []string{secrets, tlscerts, credentialsFile, upspinHome}
+
+// resolvePaths resolves the relative file and directory names in the
+// parsed YAML vals, including those in profiles, against baseDir.
+func resolvePaths(vals map[string]interface{}, baseDir string) {
+	for _, k := range pathKeys {
+		if dir, ok := vals[k].(string); ok {
+			vals[k] = resolveDir(baseDir, dir)
+		}
+	}
+	profiles, _ := vals[profilesKey].(map[interface{}]interface{})
+	for _, p := range profiles {
+		pvals, _ := p.(map[interface{}]interface{})
+		for _, k := range pathKeys {
+			if dir, ok := pvals[k].(string); ok {
+				pvals[k] = resolveDir(baseDir, dir)
+			}
+		}
+	}
+}
+
+// resolveDir returns the directory named by the value of a secrets or
+// tlscerts key, interpreting a relative path relative to baseDir.
+// Special values such as "none" are returned unchanged.
+func resolveDir(baseDir, dir string) string {
+	switch {
+	case baseDir == "", dir == "", dir == "none", dir == "env", dir == "keychain", filepath.IsAbs(dir):
+		return dir
+	}
+	return filepath.Join(baseDir, dir)
 }
 
 // valsFromYAML parses YAML from the given map and puts the values
 // into the provided map. Unrecognized keys generate an error.
-func valsFromYAML(vals map[string]string, cmdFlagVals map[string]map[string]string, data []byte) error {
+// If the YAML is of an older version of the format, it is first
+// migrated to the current version.
+// If profile is not empty, the values of the named profile
+// then override those at the top level.
+func valsFromYAML(vals map[string]string, cmdFlagVals map[string]map[string]string, data []byte, profile string) error {
 	newVals := map[string]interface{}{}
 	if err := yaml.Unmarshal(data, newVals); err != nil {
 		return errors.E(errors.Invalid, errors.Errorf("parsing YAML file: %v", err))
 	}
+	version, err := fileVersion(newVals)
+	if err != nil {
+		return err
+	}
+	profiles := newVals[profilesKey]
+	delete(newVals, profilesKey)
+	if err := migrate(newVals, version); err != nil {
+		return err
+	}
+	if err := setVals(vals, cmdFlagVals, newVals); err != nil {
+		return err
+	}
+	if profile == "" {
+		return nil
+	}
+	profileVals, err := asProfile(profiles, profile)
+	if err != nil {
+		return err
+	}
+	if err := migrate(profileVals, version); err != nil {
+		return err
+	}
+	return setVals(vals, cmdFlagVals, profileVals)
+}
+
+// profileNames returns the names of the profiles defined in the YAML data.
+func profileNames(data []byte) ([]string, error) {
+	newVals := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, newVals); err != nil {
+		return nil, errors.E(errors.Invalid, errors.Errorf("parsing YAML file: %v", err))
+	}
+	profiles, ok := newVals[profilesKey]
+	if !ok {
+		return nil, nil
+	}
+	m, ok := profiles.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.E(errors.Invalid, errors.Errorf("unrecognized profiles %v", profiles))
+	}
+	var names []string
+	for k := range m {
+		name, err := asString(k)
+		if err != nil {
+			return nil, errors.E(errors.Invalid, errors.Errorf("bad profile name %v: %v", k, err))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// asProfile returns the values of the named profile
+// from the value of the profiles key.
+func asProfile(v interface{}, name string) (map[string]interface{}, error) {
+	if v == nil {
+		return nil, errors.E(errors.NotExist, errors.Errorf("no profile %q", name))
+	}
+	profiles, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.E(errors.Invalid, errors.Errorf("unrecognized profiles %v", v))
+	}
+	p, ok := profiles[name]
+	if !ok {
+		return nil, errors.E(errors.NotExist, errors.Errorf("no profile %q", name))
+	}
+	if p == nil {
+		// A profile with no overrides.
+		return nil, nil
+	}
+	pm, ok := p.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.E(errors.Invalid, errors.Errorf("profile %q has bad value: %v", name, p))
+	}
+	vals := make(map[string]interface{})
+	for k, v := range pm {
+		key, err := asString(k)
+		if err != nil {
+			return nil, errors.E(errors.Invalid, errors.Errorf("profile %q has bad key: %v", name, err))
+		}
+		vals[key] = v
+	}
+	return vals, nil
+}
+
+// setVals puts the values parsed from YAML into the provided maps.
+// Unrecognized keys generate an error.
+func setVals(vals map[string]string, cmdFlagVals map[string]map[string]string, newVals map[string]interface{}) error {
+	// Report all unrecognized keys, so that typos can be fixed at once.
+	var unknown []string
+	for k := range newVals {
+		if k == include {
+			return errors.E(errors.Invalid, errors.Str("include is only supported in files read by FromFile"))
+		}
+		if _, ok := vals[k]; !ok && k != "cmdflags" {
+			unknown = append(unknown, fmt.Sprintf("%q", k))
+		}
+	}
+	if len(unknown) == 1 {
+		return errors.E(errors.Invalid, errors.Errorf("unrecognized key %s", unknown[0]))
+	}
+	if len(unknown) > 1 {
+		sort.Strings(unknown)
+		return errors.E(errors.Invalid, errors.Errorf("unrecognized keys %s", strings.Join(unknown, ", ")))
+	}
 	for k, v := range newVals {
 		if k == "cmdflags" {
 			if err := asFlags(v, cmdFlagVals); err != nil {
@@ -259,8 +780,21 @@ func valsFromYAML(vals map[string]string, cmdFlagVals map[string]map[string]stri
 			}
 			continue
 		}
-		if _, ok := vals[k]; !ok {
-			return errors.E(errors.Invalid, errors.Errorf("unrecognized key %q", k))
+		if k == storeservers {
+			s, err := asEndpointList(v)
+			if err != nil {
+				return fmt.Errorf("%q: %v", k, err)
+			}
+			vals[k] = s
+			continue
+		}
+		if strings.HasSuffix(k, retrySuffix) {
+			s, err := asRetryPolicy(v)
+			if err != nil {
+				return fmt.Errorf("%q: %v", k, err)
+			}
+			vals[k] = s
+			continue
 		}
 		if s, err := asString(v); err != nil {
 			return fmt.Errorf("%q: %v", k, err)
@@ -283,29 +817,57 @@ func asString(v interface{}) (string, error) {
 	return "", errors.E(errors.Invalid, errors.Errorf("unrecognized value %T", v))
 }
 
+// asEndpointList converts a YAML sequence of endpoints into a single string
+// holding the endpoints separated by spaces. A string value is returned as is.
+func asEndpointList(v interface{}) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	list, ok := v.([]interface{})
+	if !ok {
+		return "", errors.E(errors.Invalid, errors.Errorf("unrecognized endpoint list %v", v))
+	}
+	var eps []string
+	for _, v := range list {
+		s, err := asString(v)
+		if err != nil {
+			return "", err
+		}
+		eps = append(eps, s)
+	}
+	return strings.Join(eps, " "), nil
+}
+
+// asFlags puts the command flags held in the value of the cmdflags key
+// into m. The value must map command names to maps from flag names to
+// scalar values; any other shape, such as a deeper nesting, is an error.
 func asFlags(v interface{}, m map[string]map[string]string) error {
 	cmds, ok := v.(map[interface{}]interface{})
 	if !ok {
-		return errors.E(errors.Invalid, errors.Errorf("unrecognized cmdflags %v", v))
+		return errors.E(errors.Invalid, errors.Errorf("cmdflags must map command names to flags, not %v", v))
 	}
 	for k, v := range cmds {
 		cmd, err := asString(k)
 		if err != nil {
-			return errors.E(errors.Invalid, errors.Errorf("bad command %q %v", v, err))
+			return errors.E(errors.Invalid, errors.Errorf("cmdflags: bad command %v: %v", k, err))
 		}
 		flags, ok := v.(map[interface{}]interface{})
 		if !ok {
-			return errors.E(errors.Invalid, errors.Errorf("cmd %q has bad value: %v", cmd, v))
+			return errors.E(errors.Invalid, errors.Errorf("cmdflags: command %q must map flag names to values, not %v", cmd, v))
 		}
 		fm := make(map[string]string)
 		for k, v := range flags {
 			flag, err := asString(k)
 			if err != nil {
-				return errors.E(errors.Invalid, errors.Errorf("cmd %q has bad flag: %s", cmd, err))
+				return errors.E(errors.Invalid, errors.Errorf("cmdflags: command %q has bad flag: %s", cmd, err))
+			}
+			switch v.(type) {
+			case map[interface{}]interface{}, []interface{}:
+				return errors.E(errors.Invalid, errors.Errorf("cmdflags: command %q flag %q has nested value %v; values must be scalars", cmd, flag, v))
 			}
 			val, err := asString(v)
 			if err != nil {
-				return errors.E(errors.Invalid, errors.Errorf("cmd %q flag %q has bad value: %s", cmd, flag, err))
+				return errors.E(errors.Invalid, errors.Errorf("cmdflags: command %q flag %q has bad value: %s", cmd, flag, err))
 			}
 			fm[flag] = val
 		}
@@ -348,6 +910,77 @@ func valsFromEnvironment(vals map[string]string) error {
 	return nil
 }
 
+// defaultEnvPrefix is the prefix of the environment variables
+// that provide values for keys absent from the config file.
+const defaultEnvPrefix = "UPSPIN_"
+
+// upspinHomeEnv names the environment variable holding the Upspin home
+// directory, which replaces $HOME/upspin as the location of the default
+// config file and $HOME/.ssh as the default secrets directory. Being
+// needed to find the config file, it is not named like the variables
+// that supply config keys.
+const upspinHomeEnv = defaultEnvPrefix + "HOME"
+
+// valsFromDefaultEnvironment sets each key in the provided map from the
+// environment variable named by defaultEnvPrefix and the key in upper case,
+// if that variable is set and not empty.
+func valsFromDefaultEnvironment(vals map[string]string) {
+	for k := range vals {
+		if v := os.Getenv(defaultEnvPrefix + strings.ToUpper(k)); v != "" {
+			vals[k] = v
+		}
+	}
+}
+
+// privateKeyEnv names the environment variable holding the user's
+// private key when the secrets key is "env". Its value is either PEM
+// data for an EC private key or, as is more convenient in many
+// environments, that data encoded in standard base64.
+// It is distinct from UPSPIN_SECRETS, which names the secrets
+// directory when the config file has no secrets key.
+// The variable is removed from the environment once it has been read,
+// so that it is not inherited by child processes.
+const privateKeyEnv = defaultEnvPrefix + "PRIVATE_KEY"
+
+// envFactotum holds the Factotum most recently loaded from
+// privateKeyEnv, so that configs loaded after the variable has been
+// cleared, such as on a reload, can still use the key.
+var envFactotum struct {
+	sync.Mutex
+	f upspin.Factotum
+}
+
+// factotumFromEnvironment returns a Factotum for the private key
+// held in the privateKeyEnv environment variable, and clears the
+// variable. If the variable is not set, it returns the Factotum it
+// loaded previously, if any.
+func factotumFromEnvironment() (upspin.Factotum, error) {
+	envFactotum.Lock()
+	defer envFactotum.Unlock()
+	data := os.Getenv(privateKeyEnv)
+	if data == "" {
+		if envFactotum.f != nil {
+			return envFactotum.f, nil
+		}
+		return nil, errors.E(errors.NotExist, errors.Errorf("secrets is env but %s is not set", privateKeyEnv))
+	}
+	os.Unsetenv(privateKeyEnv)
+	pemData := []byte(data)
+	if !strings.HasPrefix(strings.TrimSpace(data), "-----BEGIN") {
+		var err error
+		pemData, err = base64.StdEncoding.DecodeString(strings.TrimSpace(data))
+		if err != nil {
+			return nil, errors.E(errors.Invalid, errors.Errorf("decoding %s: %v", privateKeyEnv, err))
+		}
+	}
+	f, err := factotum.NewFromPEM(pemData)
+	if err != nil {
+		return nil, err
+	}
+	envFactotum.f = f
+	return f, nil
+}
+
 // certPoolFromDir parses any PEM files in the provided directory
 // and returns the resulting pool.
 func certPoolFromDir(dir string) (*x509.CertPool, error) {
@@ -373,7 +1006,17 @@ func certPoolFromDir(dir string) (*x509.CertPool, error) {
 	return pool, nil
 }
 
-func parseEndpoint(op string, vals map[string]string, key string, errorp *error) upspin.Endpoint {
+// defaultPort is the port assumed by default for remote endpoints
+// whose address has none.
+const defaultPort = "443"
+
+// parseEndpoint parses the endpoint held in vals under key. If the endpoint
+// is remote and its address has no port, defaultPort is appended, or, if
+// defaultPort is empty, an error is recorded; addresses of host-local
+// services, whose ports are ignored, always receive the standard port.
+// The first error seen is stored in *errorp and the unassigned endpoint
+// is returned.
+func parseEndpoint(op string, vals map[string]string, key, defaultPort string, errorp *error) upspin.Endpoint {
 	text, ok := vals[key]
 	if !ok || text == "" {
 		return upspin.Endpoint{}
@@ -387,21 +1030,26 @@ func parseEndpoint(op string, vals map[string]string, key string, errorp *error)
 			err = nil
 		}
 	}
+	if err == nil && ep.Transport == upspin.Remote && !strings.Contains(string(ep.NetAddr), ":") {
+		// The address does not include a port.
+		switch {
+		case local.IsLocal(string(ep.NetAddr)):
+			ep.NetAddr += ":443"
+		case defaultPort != "":
+			ep.NetAddr += upspin.NetAddr(":" + defaultPort)
+		default:
+			err = errors.Str("endpoint missing port: add ':port' or ':443'")
+		}
+	}
 	if err != nil {
 		err = errors.E(op, errors.Errorf("cannot parse service %q: %v", text, err))
 		log.Error.Print(err)
-		if *errorp == nil {
+		// A malformed endpoint is a worse problem than a missing Factotum.
+		if *errorp == nil || *errorp == ErrNoFactotum {
 			*errorp = err
 		}
 		return upspin.Endpoint{}
 	}
-
-	// If it's a remote and the provided address does not include a port,
-	// assume port 443.
-	if ep.Transport == upspin.Remote && !strings.Contains(string(ep.NetAddr), ":") {
-		ep.NetAddr += ":443"
-	}
-
 	return *ep
 }
 
@@ -417,6 +1065,7 @@ func (cfg cfgUserName) UserName() upspin.UserName {
 // SetUserName returns a config derived from the given config
 // with the given user name.
 func SetUserName(cfg upspin.Config, u upspin.UserName) upspin.Config {
+	checkFrozen(cfg, "SetUserName")
 	return cfgUserName{
 		Config:   cfg,
 		userName: u,
@@ -426,6 +1075,7 @@ func SetUserName(cfg upspin.Config, u upspin.UserName) upspin.Config {
 type cfgFactotum struct {
 	upspin.Config
 	factotum upspin.Factotum
+	secrets  string // Directory the factotum was loaded from, if known.
 }
 
 func (cfg cfgFactotum) Factotum() upspin.Factotum {
@@ -435,6 +1085,7 @@ func (cfg cfgFactotum) Factotum() upspin.Factotum {
 // SetFactotum returns a config derived from the given config
 // with the given factotum.
 func SetFactotum(cfg upspin.Config, f upspin.Factotum) upspin.Config {
+	checkFrozen(cfg, "SetFactotum")
 	return cfgFactotum{
 		Config:   cfg,
 		factotum: f,
@@ -453,6 +1104,7 @@ func (cfg cfgPacking) Packing() upspin.Packing {
 // SetPacking returns a config derived from the given config
 // with the given packing.
 func SetPacking(cfg upspin.Config, p upspin.Packing) upspin.Config {
+	checkFrozen(cfg, "SetPacking")
 	return cfgPacking{
 		Config:  cfg,
 		packing: p,
@@ -471,6 +1123,7 @@ func (cfg cfgKeyEndpoint) KeyEndpoint() upspin.Endpoint {
 // SetKeyEndpoint returns a config derived from the given config
 // with the given key endpoint.
 func SetKeyEndpoint(cfg upspin.Config, e upspin.Endpoint) upspin.Config {
+	checkFrozen(cfg, "SetKeyEndpoint")
 	return cfgKeyEndpoint{
 		Config:      cfg,
 		keyEndpoint: e,
@@ -489,12 +1142,67 @@ func (cfg cfgStoreEndpoint) StoreEndpoint() upspin.Endpoint {
 // SetStoreEndpoint returns a config derived from the given config
 // with the given store endpoint.
 func SetStoreEndpoint(cfg upspin.Config, e upspin.Endpoint) upspin.Config {
+	checkFrozen(cfg, "SetStoreEndpoint")
 	return cfgStoreEndpoint{
 		Config:        cfg,
 		storeEndpoint: e,
 	}
 }
 
+type cfgStoreEndpoints struct {
+	upspin.Config
+	storeEndpoints []upspin.Endpoint
+}
+
+func (cfg cfgStoreEndpoints) StoreEndpoint() upspin.Endpoint {
+	return cfg.storeEndpoints[0]
+}
+
+// SetStoreEndpoints returns a config derived from the given config
+// with the given store endpoints, to be tried in order. The first
+// is the config's StoreEndpoint. If the list is empty, the config
+// is returned unchanged.
+func SetStoreEndpoints(cfg upspin.Config, eps []upspin.Endpoint) upspin.Config {
+	checkFrozen(cfg, "SetStoreEndpoints")
+	if len(eps) == 0 {
+		return cfg
+	}
+	return cfgStoreEndpoints{
+		Config:         cfg,
+		storeEndpoints: append([]upspin.Endpoint(nil), eps...),
+	}
+}
+
+// StoreEndpoints returns the store endpoints of the config in the order
+// in which they should be tried, as set by the storeservers key or
+// SetStoreEndpoints. If the config has a single store endpoint, it is
+// the only element; if it has none, StoreEndpoints returns nil.
+func StoreEndpoints(cfg upspin.Config) []upspin.Endpoint {
+	for c := cfg; c != nil; c = parent(c) {
+		switch c := c.(type) {
+		case cfgStoreEndpoints:
+			return append([]upspin.Endpoint(nil), c.storeEndpoints...)
+		case cfgStoreEndpoint:
+			// Set more recently than any list.
+			return singleEndpoint(c.storeEndpoint)
+		case Snapshot:
+			if c.storeEndpoints != nil {
+				return append([]upspin.Endpoint(nil), c.storeEndpoints...)
+			}
+			return singleEndpoint(c.storeEndpoint)
+		}
+	}
+	return singleEndpoint(cfg.StoreEndpoint())
+}
+
+// singleEndpoint returns a list holding e, or nil if e is unassigned.
+func singleEndpoint(e upspin.Endpoint) []upspin.Endpoint {
+	if e.Transport == upspin.Unassigned {
+		return nil
+	}
+	return []upspin.Endpoint{e}
+}
+
 type cfgCacheEndpoint struct {
 	upspin.Config
 	cacheEndpoint upspin.Endpoint
@@ -507,6 +1215,7 @@ func (cfg cfgCacheEndpoint) CacheEndpoint() upspin.Endpoint {
 // SetCacheEndpoint returns a config derived from the given config
 // with the given cache endpoint.
 func SetCacheEndpoint(cfg upspin.Config, e upspin.Endpoint) upspin.Config {
+	checkFrozen(cfg, "SetCacheEndpoint")
 	return cfgCacheEndpoint{
 		Config:        cfg,
 		cacheEndpoint: e,
@@ -525,6 +1234,7 @@ func (cfg cfgDirEndpoint) DirEndpoint() upspin.Endpoint {
 // SetDirEndpoint returns a config derived from the given config
 // with the given dir endpoint.
 func SetDirEndpoint(cfg upspin.Config, e upspin.Endpoint) upspin.Config {
+	checkFrozen(cfg, "SetDirEndpoint")
 	return cfgDirEndpoint{
 		Config:      cfg,
 		dirEndpoint: e,
@@ -541,12 +1251,77 @@ func (cfg cfgCertPool) CertPool() *x509.CertPool {
 }
 
 func SetCertPool(cfg upspin.Config, pool *x509.CertPool) upspin.Config {
+	checkFrozen(cfg, "SetCertPool")
 	return cfgCertPool{
 		Config: cfg,
 		pool:   pool,
 	}
 }
 
+type cfgTLSCerts struct {
+	upspin.Config
+	dir  string
+	pool *x509.CertPool
+}
+
+func (cfg cfgTLSCerts) CertPool() *x509.CertPool {
+	return cfg.pool
+}
+
+// SetTLSCerts returns a config derived from the given config whose
+// certificate pool holds the PEM certificates in the given directory,
+// as for the tlscerts key of InitConfig. If the directory is empty or
+// holds no certificates, the system roots are used. If the certificates
+// cannot be read, the error is logged and the pool is left empty, so
+// that no TLS connection can be verified.
+func SetTLSCerts(cfg upspin.Config, dir string) upspin.Config {
+	checkFrozen(cfg, "SetTLSCerts")
+	c, err := setTLSCerts(cfg, dir)
+	if err != nil {
+		log.Error.Printf("config.SetTLSCerts: %v", err)
+		return cfgTLSCerts{
+			Config: cfg,
+			dir:    dir,
+			pool:   x509.NewCertPool(),
+		}
+	}
+	return c
+}
+
+// setTLSCerts is SetTLSCerts but returns an error if the
+// certificates cannot be read.
+func setTLSCerts(cfg upspin.Config, dir string) (upspin.Config, error) {
+	var pool *x509.CertPool
+	if dir != "" {
+		var err error
+		pool, err = certPoolFromDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		if pool == nil {
+			log.Info.Printf("config: no PEM certificates found in %q", dir)
+		}
+	}
+	return cfgTLSCerts{
+		Config: cfg,
+		dir:    dir,
+		pool:   pool,
+	}, nil
+}
+
+// TLSCerts returns the directory from which the certificate pool of the
+// config was loaded by SetTLSCerts or InitConfig. It returns the empty
+// string if the config uses the system roots or a pool set by SetCertPool.
+func TLSCerts(cfg upspin.Config) string {
+	switch c := find(cfg, isCertPool).(type) {
+	case cfgTLSCerts:
+		return c.dir
+	case Snapshot:
+		return c.tlsCerts
+	}
+	return ""
+}
+
 type cfgFlags struct {
 	upspin.Config
 	flags map[string]map[string]string
@@ -557,36 +1332,264 @@ func (cfg cfgFlags) Flags(cmd string) map[string]string {
 }
 
 func SetFlags(cfg upspin.Config, flags map[string]map[string]string) upspin.Config {
+	checkFrozen(cfg, "SetFlags")
 	return cfgFlags{
 		Config: cfg,
 		flags:  flags,
 	}
 }
 
+type cfgValue struct {
+	upspin.Config
+	key, value string
+}
+
+func (cfg cfgValue) Value(key string) string {
+	if key == cfg.key {
+		return cfg.value
+	}
+	return cfg.Config.Value(key)
+}
+
+// SetValue returns a config derived from the given config
+// with the given key set to the given value.
+func SetValue(cfg upspin.Config, key, value string) upspin.Config {
+	checkFrozen(cfg, "SetValue")
+	return cfgValue{
+		Config: cfg,
+		key:    key,
+		value:  value,
+	}
+}
+
 // SetFlagValues updates any flag that is still at its default value. It will
-// apply all the flags possible and return the last error seen.
+// apply all the flags possible and return an error describing every flag
+// that is unknown or whose value could not be set.
 func SetFlagValues(cfg upspin.Config, cmd string) error {
-	const op = "config.SetFlagValues"
+	_, err := SetFlagValuesFS(cfg, cmd, flag.CommandLine)
+	return err
+}
+
+// ApplyFlagValues is like SetFlagValues but also returns, in sorted order,
+// the names of the flags it changed. Flags that were not at their default
+// value, or that could not be set, are not included.
+func ApplyFlagValues(cfg upspin.Config, cmd string) (changed []string, err error) {
+	return SetFlagValuesFS(cfg, cmd, flag.CommandLine)
+}
+
+// SetFlagValuesFS is like ApplyFlagValues but sets the flags defined
+// in fs rather than those of the default flag set, flag.CommandLine.
+func SetFlagValuesFS(cfg upspin.Config, cmd string, fs *flag.FlagSet) (changed []string, err error) {
+	const op = "config.SetFlagValuesFS"
 	flags := cfg.Flags(cmd)
 	if flags == nil {
-		return nil
+		return nil, nil
+	}
+	names := make([]string, 0, len(flags))
+	for k := range flags {
+		names = append(names, k)
 	}
-	var lasterr error
-	for k, v := range flags {
-		f := flag.Lookup(k)
+	sort.Strings(names)
+	var problems []string
+	for _, k := range names {
+		f := fs.Lookup(k)
 		if f == nil {
-			lasterr = errors.E(op, errors.Invalid, errors.Errorf("unknown flag %q", k))
+			problems = append(problems, fmt.Sprintf("unknown flag %q", k))
 			continue
 		}
 		if f.Value.String() != f.DefValue {
 			continue
 		}
-		if err := flag.Set(k, v); err != nil {
-			lasterr = errors.E(op, err)
+		if err := fs.Set(k, flags[k]); err != nil {
+			problems = append(problems, fmt.Sprintf("flag %q: bad value %q: %v", k, flags[k], err))
+			// Some flag types store a zero value when Set fails.
+			f.Value.Set(f.DefValue)
 			continue
 		}
+		changed = append(changed, k)
+	}
+	if len(problems) > 0 {
+		err = errors.E(op, errors.Invalid, errors.Errorf("cmdflags for %s: %s", cmd, strings.Join(problems, "; ")))
 	}
-	return lasterr
+	return changed, err
+}
+
+// DefaultConfigPath returns the path name of the default config file:
+// $HOME/upspin/config if it exists, otherwise $XDG_CONFIG_HOME/upspin/config
+// (where $XDG_CONFIG_HOME defaults to $HOME/.config) if that exists.
+// If neither exists, it returns the first, the traditional location.
+// It returns the empty string if the home directory cannot be found.
+// If the environment variable UPSPIN_HOME is set, it names the directory
+// to use instead of either, and DefaultConfigPath returns $UPSPIN_HOME/config.
+func DefaultConfigPath() string {
+	dirs := configDirs()
+	if len(dirs) == 0 {
+		return ""
+	}
+	for _, dir := range dirs {
+		name := filepath.Join(dir, "config")
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return filepath.Join(dirs[0], "config")
+}
+
+// ConfigDir returns the directory holding the Upspin configuration:
+// the directory of the file named by DefaultConfigPath, usually
+// $HOME/upspin or $UPSPIN_HOME. The directory is created, with mode 0700, if it
+// does not exist, unless the WithReadOnly option is given, in which case
+// a missing directory is an error.
+func ConfigDir(opts ...InitOption) (string, error) {
+	const op = "config.ConfigDir"
+	o := makeInitOptions(opts)
+	name := DefaultConfigPath()
+	if name == "" {
+		return "", errors.E(op, errors.NotExist, errors.Str("cannot find home directory"))
+	}
+	dir := filepath.Dir(name)
+	if o.readOnly {
+		fi, err := os.Stat(dir)
+		if os.IsNotExist(err) {
+			return "", errors.E(op, errors.NotExist, errors.Errorf("%s does not exist and the config is read-only", dir))
+		}
+		if err != nil {
+			return "", errors.E(op, errors.IO, err)
+		}
+		if !fi.IsDir() {
+			return "", errors.E(op, errors.NotDir, errors.Errorf("%s is not a directory", dir))
+		}
+		return dir, nil
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", errors.E(op, errors.IO, err)
+	}
+	return dir, nil
+}
+
+// ConfigFile returns the path name of the default config file, as
+// returned by DefaultConfigPath, after ensuring its directory exists
+// as described for ConfigDir. The file itself may not exist.
+func ConfigFile(opts ...InitOption) (string, error) {
+	const op = "config.ConfigFile"
+	dir, err := ConfigDir(opts...)
+	if err != nil {
+		return "", errors.E(op, err)
+	}
+	return filepath.Join(dir, "config"), nil
+}
+
+// UpspinDir returns the directory holding the user's Upspin files, such
+// as the config file, caches, and deployment configuration: $UPSPIN_HOME
+// if it is set, otherwise $HOME/upspin. It is the first directory searched
+// by DefaultConfigPath. Unlike ConfigDir, it does not create the directory.
+// It panics if UPSPIN_HOME is not set and the home directory cannot be found.
+func UpspinDir() string {
+	if home := os.Getenv(upspinHomeEnv); home != "" {
+		return home
+	}
+	home, err := homedir()
+	if err != nil {
+		panic(err)
+	}
+	return filepath.Join(home, "upspin")
+}
+
+// homedir is Homedir; it is a variable so it can be changed in tests.
+var homedir = Homedir
+
+// configDirs returns the directories in which to look for config files,
+// in order of preference: $HOME/upspin and $XDG_CONFIG_HOME/upspin,
+// or $UPSPIN_HOME alone if it is set.
+func configDirs() []string {
+	if home := os.Getenv(upspinHomeEnv); home != "" {
+		return []string{home}
+	}
+	var dirs []string
+	home, err := homedir()
+	if err == nil {
+		dirs = append(dirs, filepath.Join(home, "upspin"))
+	}
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" && err == nil {
+		xdg = filepath.Join(home, ".config")
+	}
+	if xdg != "" {
+		dirs = append(dirs, filepath.Join(xdg, "upspin"))
+	}
+	return dirs
+}
+
+// EndpointTimeout returns the time allowed to connect to the named server,
+// which is one of "keyserver", "dirserver", "storeserver", or "cache",
+// as given by the config key formed by appending "_timeout" to the name.
+// If the key is not set or its value is not a valid positive duration,
+// EndpointTimeout returns DefaultDialTimeout.
+func EndpointTimeout(cfg upspin.Config, server string) time.Duration {
+	v := cfg.Value(server + timeoutSuffix)
+	if v == "" {
+		return DefaultDialTimeout
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return DefaultDialTimeout
+	}
+	return d
+}
+
+// TLSServerName returns the host name expected in the TLS certificate of
+// the named server, which is one of "keyserver", "dirserver", or
+// "storeserver", as given by the config key formed by appending
+// "_tls_name" to the name. If the key is not set, TLSServerName returns
+// the empty string, and the host in the server's address should be used.
+func TLSServerName(cfg upspin.Config, server string) string {
+	return cfg.Value(server + tlsNameSuffix)
+}
+
+// ProxyURL returns the URL of the HTTP proxy through which to connect
+// to servers. It is the value of the proxy key in the config, if set;
+// otherwise that of the environment variable HTTPS_PROXY or, failing
+// that, HTTP_PROXY (or their lower-case forms). If none of those is set,
+// or the value is not a valid URL, ProxyURL returns nil.
+func ProxyURL(cfg upspin.Config) *url.URL {
+	v := cfg.Value(proxy)
+	if v == "" {
+		for _, name := range []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"} {
+			if v = os.Getenv(name); v != "" {
+				break
+			}
+		}
+	}
+	if v == "" {
+		return nil
+	}
+	u, err := parseProxyURL(v)
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+// parseProxyURL parses the address of an HTTP proxy. As is conventional,
+// an address with no scheme, such as "proxy.example.com:8080",
+// is taken to be an http URL.
+func parseProxyURL(s string) (*url.URL, error) {
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" {
+		return nil, errors.Errorf("no host in proxy URL %q", s)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, errors.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+	return u, nil
 }
 
 // TODO(adg): move to osutil package?
@@ -622,12 +1625,22 @@ func Home() string {
 	return home
 }
 
-func sshdir() (string, error) {
-	h, err := Homedir()
-	if err != nil {
-		return "", err
+// sshdir returns the default secrets directory: the .ssh subdirectory
+// of the Upspin home directory, which is home if it is not empty and
+// otherwise $UPSPIN_HOME, or, if neither is set, of the user's home
+// directory.
+func sshdir(home string) (string, error) {
+	if home == "" {
+		home = os.Getenv(upspinHomeEnv)
+	}
+	if home == "" {
+		h, err := Homedir()
+		if err != nil {
+			return "", err
+		}
+		home = h
 	}
-	p := filepath.Join(h, ".ssh")
+	p := filepath.Join(home, ".ssh")
 	if err := isDir(p); err != nil {
 		return "", err
 	}
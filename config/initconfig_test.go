@@ -6,15 +6,25 @@ package config
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"math/big"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"upspin.io/errors"
+	"upspin.io/factotum"
 	"upspin.io/pack"
 	"upspin.io/rpc/local"
 	"upspin.io/upspin"
@@ -77,6 +87,28 @@ func TestDefaults(t *testing.T) {
 	testConfig(t, &expect, makeConfig(&expect))
 }
 
+func TestMakeDefault(t *testing.T) {
+	cfg := MakeDefault()
+	if got := cfg.UserName(); got != "" {
+		t.Errorf("UserName() = %q, want empty", got)
+	}
+	if got := cfg.Packing(); got != upspin.EEPack {
+		t.Errorf("Packing() = %v, want %v", got, upspin.EEPack)
+	}
+	if got := cfg.KeyEndpoint(); got != defaultKeyEndpoint {
+		t.Errorf("KeyEndpoint() = %v, want %v", got, defaultKeyEndpoint)
+	}
+	var zero upspin.Endpoint
+	for _, ep := range []upspin.Endpoint{cfg.DirEndpoint(), cfg.StoreEndpoint(), cfg.CacheEndpoint()} {
+		if ep != zero {
+			t.Errorf("endpoint = %v, want zero value", ep)
+		}
+	}
+	if cfg.Factotum() != nil {
+		t.Errorf("Factotum() is non-nil")
+	}
+}
+
 func TestBadKey(t *testing.T) {
 	// "name=" should be "username=".
 	const config = `name: p@google.com
@@ -93,6 +125,19 @@ storeserver: inprocess`
 	}
 }
 
+func TestBadKeys(t *testing.T) {
+	const config = `sttoreserver: inprocess
+dirserver: inprocess
+usrname: p@google.com`
+	_, err := InitConfig(strings.NewReader(config))
+	if err == nil {
+		t.Fatalf("expected error, got none")
+	}
+	if !strings.Contains(err.Error(), `unrecognized keys "sttoreserver", "usrname"`) {
+		t.Fatalf("expected error naming both bad keys; got %q", err)
+	}
+}
+
 func TestCmdFlags(t *testing.T) {
 	config := `
 keyserver: key.example.com
@@ -169,6 +214,167 @@ cmdflags:
 
 }
 
+func TestApplyFlagValues(t *testing.T) {
+	flag.CommandLine = flag.NewFlagSet("hooha", flag.ContinueOnError)
+	flag.Int64("cachesize", 5e9, "max disk `bytes` for cache")
+	flag.Bool("writethrough", false, "make storage cache writethrough")
+	flag.String("cachedir", "/default", "`directory` containing the cache")
+	flag.String("log", "info", "`level` of logging")
+
+	// The log flag is already set, so the config must not change it.
+	if err := flag.Set("log", "debug"); err != nil {
+		t.Fatal(err)
+	}
+
+	configuration := `
+secrets: ` + secretsDir + `
+cmdflags:
+ cacheserver:
+  writethrough: true
+  cachesize: 1000
+  log: error
+`
+	config, err := InitConfig(strings.NewReader(configuration))
+	if err != nil {
+		t.Fatalf("could not parse config %v: %v", configuration, err)
+	}
+	changed, err := ApplyFlagValues(config, "cacheserver")
+	if err != nil {
+		t.Fatalf("could not apply config flags %v: %v", configuration, err)
+	}
+	want := []string{"cachesize", "writethrough"}
+	if !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %q, want %q", changed, want)
+	}
+	if got := flag.Lookup("log").Value.String(); got != "debug" {
+		t.Errorf("log = %q, want %q", got, "debug")
+	}
+
+	// A bad value is reported, but the other flags are still applied.
+	configuration = `
+secrets: ` + secretsDir + `
+cmdflags:
+ cacheserver:
+  cachedir: /tmp
+  nosuchflag: true
+`
+	config, err = InitConfig(strings.NewReader(configuration))
+	if err != nil {
+		t.Fatalf("could not parse config %v: %v", configuration, err)
+	}
+	changed, err = ApplyFlagValues(config, "cacheserver")
+	if err == nil {
+		t.Errorf("ApplyFlagValues should have failed %v", configuration)
+	}
+	want = []string{"cachedir"}
+	if !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %q, want %q", changed, want)
+	}
+
+	// No flags for the command.
+	changed, err = ApplyFlagValues(config, "upspinfs")
+	if err != nil || changed != nil {
+		t.Errorf("ApplyFlagValues(upspinfs) = %q, %v; want nil, nil", changed, err)
+	}
+}
+
+func TestSetFlagValuesFS(t *testing.T) {
+	global := flag.CommandLine
+	flag.CommandLine = flag.NewFlagSet("global", flag.ContinueOnError)
+	defer func() { flag.CommandLine = global }()
+	globalDir := flag.String("cachedir", "/global", "`directory` containing the cache")
+
+	fs := flag.NewFlagSet("upspinfs", flag.ContinueOnError)
+	cacheDir := fs.String("cachedir", "/default", "`directory` containing the cache")
+	cacheSize := fs.Int64("cachesize", 5e9, "max disk `bytes` for cache")
+	prudent := fs.Bool("prudent", false, "be prudent")
+
+	configuration := `
+secrets: ` + secretsDir + `
+cmdflags:
+ upspinfs:
+  cachedir: /tmp
+  cachesize: 1000
+`
+	config, err := InitConfig(strings.NewReader(configuration))
+	if err != nil {
+		t.Fatalf("could not parse config %v: %v", configuration, err)
+	}
+	changed, err := SetFlagValuesFS(config, "upspinfs", fs)
+	if err != nil {
+		t.Fatalf("could not apply config flags %v: %v", configuration, err)
+	}
+	if want := []string{"cachedir", "cachesize"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %q, want %q", changed, want)
+	}
+	if *cacheDir != "/tmp" || *cacheSize != 1000 || *prudent {
+		t.Errorf("cachedir, cachesize, prudent = %q, %d, %v; want %q, %d, %v", *cacheDir, *cacheSize, *prudent, "/tmp", 1000, false)
+	}
+	// The default flag set is not touched.
+	if *globalDir != "/global" {
+		t.Errorf("global cachedir = %q, want %q", *globalDir, "/global")
+	}
+
+	// Flags not defined in fs are unknown, even if defined globally.
+	flag.Bool("writethrough", false, "make storage cache writethrough")
+	config = SetFlags(config, map[string]map[string]string{"upspinfs": {"writethrough": "true"}})
+	if _, err := SetFlagValuesFS(config, "upspinfs", fs); err == nil || !strings.Contains(err.Error(), "writethrough") {
+		t.Errorf("SetFlagValuesFS with unknown flag: err = %v", err)
+	}
+}
+
+func TestSetFlagValuesErrors(t *testing.T) {
+	flag.CommandLine = flag.NewFlagSet("hooha", flag.ContinueOnError)
+	cacheSizeFlag := flag.Int64("cachesize", 5e9, "max disk `bytes` for cache")
+	writethroughFlag := flag.Bool("writethrough", false, "make storage cache writethrough")
+	cacheDirFlag := flag.String("cachedir", "/default", "`directory` containing the cache")
+
+	configuration := `
+secrets: ` + secretsDir + `
+cmdflags:
+ cacheserver:
+  cachesize: lots
+  writethrough: maybe
+  cachedir: /tmp
+`
+	config, err := InitConfig(strings.NewReader(configuration))
+	if err != nil {
+		t.Fatalf("could not parse config %v: %v", configuration, err)
+	}
+	err = SetFlagValues(config, "cacheserver")
+	if err == nil {
+		t.Fatalf("SetFlagValues should have failed %v", configuration)
+	}
+	// Every bad value is reported, not just the last.
+	for _, want := range []string{`"cachesize"`, `"lots"`, `"writethrough"`, `"maybe"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %s", err, want)
+		}
+	}
+	// The good value is still applied and the bad ones are not.
+	if *cacheDirFlag != "/tmp" {
+		t.Errorf("cachedir = %q, want %q", *cacheDirFlag, "/tmp")
+	}
+	if *cacheSizeFlag != 5e9 || *writethroughFlag {
+		t.Errorf("cachesize, writethrough = %v, %v; want defaults", *cacheSizeFlag, *writethroughFlag)
+	}
+}
+
+func TestCmdFlagsShape(t *testing.T) {
+	bad := []string{
+		"cmdflags: [cacheserver]",
+		"cmdflags:\n cacheserver: [cachedir]",
+		"cmdflags:\n cacheserver:\n  cachedir:\n   deeper: /tmp",
+		"cmdflags:\n cacheserver:\n  cachedir: [/tmp, /var/tmp]",
+	}
+	for _, c := range bad {
+		_, err := InitConfig(strings.NewReader("secrets: " + secretsDir + "\n" + c))
+		if !errors.Match(errors.E(errors.Invalid), err) || !strings.Contains(err.Error(), "cmdflags") {
+			t.Errorf("InitConfig(%q) error = %v, want invalid cmdflags", c, err)
+		}
+	}
+}
+
 func TestCacheValues(t *testing.T) {
 	// Test values for cache:.
 	base := "secrets: " + secretsDir + "\n"
@@ -205,6 +411,90 @@ func TestCacheValues(t *testing.T) {
 	}
 }
 
+func TestReadOnly(t *testing.T) {
+	home, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer func(f func() (string, error)) { homedir = f }(homedir)
+	homedir = func() (string, error) { return home, nil }
+	defer os.Setenv(upspinHomeEnv, os.Getenv(upspinHomeEnv))
+	os.Unsetenv(upspinHomeEnv)
+
+	// A config directory that may not be written.
+	dir := filepath.Join(home, "upspin")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "config")
+	data := "secrets: " + secretsDir + "\ncache: yes\n"
+	if err := ioutil.WriteFile(file, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dir, 0500); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(dir, 0700)
+	list := func() []string {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, fi := range infos {
+			names = append(names, fi.Name())
+		}
+		return names
+	}
+	before := list()
+
+	if got, err := ConfigFile(WithReadOnly()); err != nil || got != file {
+		t.Errorf("ConfigFile(WithReadOnly()) = %q, %v; want %q", got, err, file)
+	}
+	if _, err := FromFile(file, WithReadOnly()); err != nil {
+		t.Errorf("FromFile(WithReadOnly()): %v", err)
+	}
+	if _, err := InitConfig(strings.NewReader(data), WithReadOnly()); err != nil {
+		t.Errorf("InitConfig(WithReadOnly()): %v", err)
+	}
+	if after := list(); !reflect.DeepEqual(after, before) {
+		t.Errorf("read-only config directory changed from %q to %q", before, after)
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0500 {
+		t.Errorf("read-only config directory has mode %v, want 0500", fi.Mode().Perm())
+	}
+}
+
+func TestTLSCerts(t *testing.T) {
+	if cfg := SetTLSCerts(New(), ""); cfg.CertPool() != nil || TLSCerts(cfg) != "" {
+		t.Errorf("empty tlscerts: got pool %v, dir %q; want system roots", cfg.CertPool(), TLSCerts(cfg))
+	}
+	dir, err := filepath.Abs("../rpc/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := SetTLSCerts(New(), dir)
+	if cfg.CertPool() == nil || len(cfg.CertPool().Subjects()) == 0 {
+		t.Errorf("tlscerts %q: no certificates in pool", dir)
+	}
+	if got := TLSCerts(cfg); got != dir {
+		t.Errorf("TLSCerts() = %q, want %q", got, dir)
+	}
+	if got := TLSCerts(SetCertPool(cfg, nil)); got != "" {
+		t.Errorf("TLSCerts after SetCertPool = %q, want empty", got)
+	}
+	// An unreadable directory yields an empty pool, not the system roots.
+	cfg = SetTLSCerts(New(), filepath.Join(dir, "missing"))
+	if cfg.CertPool() == nil || len(cfg.CertPool().Subjects()) != 0 {
+		t.Errorf("missing tlscerts: want empty pool")
+	}
+}
+
 func parseTestEndpoint(text string) (upspin.Endpoint, error) {
 	if text == "" {
 		return upspin.Endpoint{}, nil
@@ -261,6 +551,53 @@ func TestEnv(t *testing.T) {
 	testConfig(t, &expect, config)
 }
 
+func TestDefaultEnv(t *testing.T) {
+	expect := expectations{
+		username:    "p@google.com",
+		keyserver:   upspin.Endpoint{Transport: upspin.InProcess, NetAddr: ""},
+		dirserver:   upspin.Endpoint{Transport: upspin.Remote, NetAddr: "who.knows:1234"},
+		storeserver: upspin.Endpoint{Transport: upspin.Remote, NetAddr: "who.knows:1234"},
+		packing:     upspin.PlainPack,
+		secrets:     secretsDir,
+	}
+	env := map[string]string{
+		"UPSPIN_USERNAME":    string(expect.username),
+		"UPSPIN_KEYSERVER":   expect.keyserver.String(),
+		"UPSPIN_DIRSERVER":   expect.dirserver.String(),
+		"UPSPIN_STORESERVER": expect.storeserver.String(),
+		"UPSPIN_PACKING":     expect.packing.String(),
+		"UPSPIN_SECRETS":     expect.secrets,
+	}
+	for k, v := range env {
+		os.Setenv(k, v)
+		defer os.Unsetenv(k)
+	}
+
+	// The environment alone is equivalent to a config file.
+	fromEnv, err := FromEnvironment()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromFile, err := InitConfig(strings.NewReader(makeConfig(&expect)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromEnv.UserName() != fromFile.UserName() ||
+		fromEnv.Packing() != fromFile.Packing() ||
+		fromEnv.KeyEndpoint() != fromFile.KeyEndpoint() ||
+		fromEnv.DirEndpoint() != fromFile.DirEndpoint() ||
+		fromEnv.StoreEndpoint() != fromFile.StoreEndpoint() ||
+		fromEnv.Factotum().PublicKey() != fromFile.Factotum().PublicKey() {
+		t.Errorf("config from environment differs from config from file")
+	}
+
+	// A key in the config file beats the environment.
+	config := "username: bob@google.com\npacking: ee\n"
+	expect.username = "bob@google.com"
+	expect.packing = upspin.EEPack
+	testConfig(t, &expect, config)
+}
+
 func TestBadEnv(t *testing.T) {
 	expect := expectations{
 		username:    "p@google.com",
@@ -297,6 +634,64 @@ func TestNoSecrets(t *testing.T) {
 	}
 }
 
+func TestNoFactotumError(t *testing.T) {
+	empty, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(empty)
+	bad, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bad)
+	for _, name := range []string{"public.upspinkey", "secret.upspinkey"} {
+		if err := ioutil.WriteFile(filepath.Join(bad, name), []byte("garbage\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Secrets none yields the ErrNoFactotum sentinel itself.
+	cfg, err := InitConfig(strings.NewReader("secrets: none\n"))
+	if err != ErrNoFactotum || cfg == nil {
+		t.Errorf("none: InitConfig = %v, %v; want config and ErrNoFactotum", cfg, err)
+	}
+
+	tests := []struct {
+		secrets string
+		reason  string
+		kind    errors.Kind
+	}{
+		{empty, "missing", errors.NotExist},
+		{bad, "invalid", errors.Invalid},
+	}
+	for _, test := range tests {
+		cfg, err := InitConfig(strings.NewReader("secrets: " + test.secrets + "\n"))
+		if err == ErrNoFactotum {
+			t.Errorf("%s: got ErrNoFactotum", test.reason)
+		}
+		if cfg != nil {
+			t.Errorf("%s: InitConfig returned config %v", test.reason, cfg)
+		}
+		e, ok := err.(*errors.Error)
+		if !ok {
+			t.Errorf("%s: error is %T, want *errors.Error", test.reason, err)
+			continue
+		}
+		if e.Kind != test.kind {
+			t.Errorf("%s: error kind is %v, want %v", test.reason, e.Kind, test.kind)
+		}
+		nf, ok := e.Err.(*NoFactotumError)
+		if !ok {
+			t.Errorf("%s: wrapped error is %T, want *NoFactotumError", test.reason, e.Err)
+			continue
+		}
+		if nf.Reason != test.reason || nf.SecretsDir != test.secrets {
+			t.Errorf("%s: got Reason %q, SecretsDir %q; want %q, %q", test.reason, nf.Reason, nf.SecretsDir, test.reason, test.secrets)
+		}
+	}
+}
+
 func TestEndpointDefaults(t *testing.T) {
 	config := `
 keyserver: key.example.com
@@ -313,6 +708,45 @@ secrets: ` + secretsDir + "\n"
 	testConfig(t, &expect, config)
 }
 
+func TestDefaultPort(t *testing.T) {
+	tests := []struct {
+		port    string
+		text    string
+		want    upspin.NetAddr
+		wantErr bool
+	}{
+		{"443", "dir.example.com:8080", "dir.example.com:8080", false},
+		{"", "dir.example.com:8080", "dir.example.com:8080", false},
+		{"443", "dir.example.com", "dir.example.com:443", false},
+		{"5580", "remote,dir.example.com", "dir.example.com:5580", false},
+		{"", "dir.example.com", "", true},
+		{"", "remote,dir.example.com", "", true},
+	}
+	for _, test := range tests {
+		config := "dirserver: " + test.text + "\nsecrets: " + secretsDir + "\n"
+		cfg, err := InitConfig(strings.NewReader(config), WithDefaultPort(test.port))
+		if test.wantErr {
+			if err == nil || !strings.Contains(err.Error(), "missing port") {
+				t.Errorf("port %q, dirserver %q: got error %v, want missing port", test.port, test.text, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("port %q, dirserver %q: %v", test.port, test.text, err)
+			continue
+		}
+		if got := cfg.DirEndpoint().NetAddr; got != test.want {
+			t.Errorf("port %q, dirserver %q: got %q, want %q", test.port, test.text, got, test.want)
+		}
+	}
+
+	// The address of the local cache server needs no port.
+	config := "cache: yes\nsecrets: " + secretsDir + "\n"
+	if _, err := InitConfig(strings.NewReader(config), WithDefaultPort("")); err != nil {
+		t.Errorf("cache: yes: %v", err)
+	}
+}
+
 func makeConfig(expect *expectations) string {
 	var buf bytes.Buffer
 
@@ -403,3 +837,604 @@ func testConfig(t *testing.T, expect *expectations, configuration string) {
 		}
 	}
 }
+
+func TestDefaultConfigPath(t *testing.T) {
+	home, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer func(f func() (string, error)) { homedir = f }(homedir)
+	homedir = func() (string, error) { return home, nil }
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Unsetenv("XDG_CONFIG_HOME")
+
+	legacy := filepath.Join(home, "upspin", "config")
+	xdg := filepath.Join(home, ".config", "upspin", "config")
+	write := func(name string, user upspin.UserName) {
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		data := "username: " + string(user) + "\nsecrets: " + secretsDir + "\n"
+		if err := ioutil.WriteFile(name, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check := func(what, wantPath string, wantUser upspin.UserName) {
+		if got := DefaultConfigPath(); got != wantPath {
+			t.Errorf("%s: DefaultConfigPath() = %q, want %q", what, got, wantPath)
+		}
+		cfg, err := InitConfig(nil)
+		if err != nil {
+			t.Fatalf("%s: InitConfig(nil): %v", what, err)
+		}
+		if cfg.UserName() != wantUser {
+			t.Errorf("%s: InitConfig(nil) user = %q, want %q", what, cfg.UserName(), wantUser)
+		}
+		cfg, err = FromFile("config")
+		if err != nil {
+			t.Fatalf("%s: FromFile: %v", what, err)
+		}
+		if cfg.UserName() != wantUser {
+			t.Errorf("%s: FromFile user = %q, want %q", what, cfg.UserName(), wantUser)
+		}
+	}
+
+	if got := DefaultConfigPath(); got != legacy {
+		t.Errorf("no config: DefaultConfigPath() = %q, want %q", got, legacy)
+	}
+
+	write(xdg, "xdg@example.com")
+	check("XDG only", xdg, "xdg@example.com")
+
+	write(legacy, "legacy@example.com")
+	check("both", legacy, "legacy@example.com")
+
+	if err := os.Remove(xdg); err != nil {
+		t.Fatal(err)
+	}
+	check("legacy only", legacy, "legacy@example.com")
+
+	// XDG_CONFIG_HOME overrides $HOME/.config.
+	if err := os.Remove(legacy); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(home, "xdg")
+	os.Setenv("XDG_CONFIG_HOME", other)
+	write(filepath.Join(other, "upspin", "config"), "other@example.com")
+	check("XDG_CONFIG_HOME", filepath.Join(other, "upspin", "config"), "other@example.com")
+}
+
+func TestConfigDir(t *testing.T) {
+	home, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer func(f func() (string, error)) { homedir = f }(homedir)
+	homedir = func() (string, error) { return home, nil }
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Unsetenv("XDG_CONFIG_HOME")
+
+	want := filepath.Join(home, "upspin")
+	dir, err := ConfigDir()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dir != want {
+		t.Errorf("ConfigDir() = %q, want %q", dir, want)
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.IsDir() || fi.Mode().Perm() != 0700 {
+		t.Errorf("ConfigDir() created %v, want directory with mode 0700", fi.Mode())
+	}
+	file, err := ConfigFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(want, "config"); file != want {
+		t.Errorf("ConfigFile() = %q, want %q", file, want)
+	}
+
+	// A read-only caller finds the directory but never creates it.
+	if got, err := ConfigDir(WithReadOnly()); err != nil || got != want {
+		t.Errorf("ConfigDir(WithReadOnly()) = %q, %v; want %q", got, err, want)
+	}
+	if err := os.Remove(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ConfigDir(WithReadOnly()); !errors.Match(errors.E(errors.NotExist), err) {
+		t.Errorf("ConfigDir(WithReadOnly()) with no directory: err = %v, want NotExist", err)
+	}
+	if _, err := ConfigFile(WithReadOnly()); !errors.Match(errors.E(errors.NotExist), err) {
+		t.Errorf("ConfigFile(WithReadOnly()) with no directory: err = %v, want NotExist", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("read-only ConfigDir created %s", dir)
+	}
+
+	homedir = func() (string, error) { return "", errors.Str("no home") }
+	if _, err := ConfigDir(); err == nil {
+		t.Errorf("ConfigDir() with no home directory: got no error")
+	}
+}
+
+func TestUpspinHome(t *testing.T) {
+	home, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv(upspinHomeEnv, os.Getenv(upspinHomeEnv))
+	os.Setenv(upspinHomeEnv, home)
+
+	// Put the keys of user1 in the default secrets directory.
+	ssh := filepath.Join(home, ".ssh")
+	if err := os.Mkdir(ssh, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"public.upspinkey", "secret.upspinkey"} {
+		data, err := ioutil.ReadFile(filepath.Join(secretsDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(ssh, name), data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	file := filepath.Join(home, "config")
+	if err := ioutil.WriteFile(file, []byte("username: ann@example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := DefaultConfigPath(); got != file {
+		t.Errorf("DefaultConfigPath() = %q, want %q", got, file)
+	}
+	if got, err := ConfigDir(); err != nil || got != home {
+		t.Errorf("ConfigDir() = %q, %v; want %q", got, err, home)
+	}
+	if got, err := ConfigFile(); err != nil || got != file {
+		t.Errorf("ConfigFile() = %q, %v; want %q", got, err, file)
+	}
+	if got := UpspinDir(); got != home {
+		t.Errorf("UpspinDir() = %q, want %q", got, home)
+	}
+	if got, err := sshdir(""); err != nil || got != ssh {
+		t.Errorf("sshdir() = %q, %v; want %q", got, err, ssh)
+	}
+
+	// A relative name is found in the Upspin home directory,
+	// and the keys in the default secrets directory there.
+	cfg, err := FromFile("config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.UserName(), upspin.UserName("ann@example.com"); got != want {
+		t.Errorf("UserName() = %q, want %q", got, want)
+	}
+	if got, want := factotumDir(cfg), ssh; got != want {
+		t.Errorf("secrets = %q, want %q", got, want)
+	}
+
+	// The upspin_home key takes precedence over the variable.
+	other, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(other)
+	_, err = InitConfig(strings.NewReader("upspin_home: " + other))
+	if err == nil || !strings.Contains(err.Error(), filepath.Join(other, ".ssh")) {
+		t.Errorf("InitConfig with upspin_home %s: got error %v, want missing %s", other, err, filepath.Join(other, ".ssh"))
+	}
+}
+
+func TestInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name, data string) string {
+		name = filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return name
+	}
+
+	// Three levels, with relative and absolute includes.
+	base := write("base/base", "keyserver: key.example.com\npacking: plain\ndirserver: dir.example.com\n")
+	write("team/team", "include: "+base+"\ndirserver: dir.team.example.com\nsecrets: "+secretsDir+"\n")
+	user := write("user", "include: team/team\nusername: ann@example.com\n")
+	cfg, err := FromFile(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.UserName(), upspin.UserName("ann@example.com"); got != want {
+		t.Errorf("UserName() = %q, want %q", got, want)
+	}
+	if got, want := cfg.Packing(), upspin.PlainPack; got != want {
+		t.Errorf("Packing() = %v, want %v", got, want)
+	}
+	if got, want := cfg.KeyEndpoint().NetAddr, upspin.NetAddr("key.example.com:443"); got != want {
+		t.Errorf("KeyEndpoint().NetAddr = %q, want %q", got, want)
+	}
+	if got, want := cfg.DirEndpoint().NetAddr, upspin.NetAddr("dir.team.example.com:443"); got != want {
+		t.Errorf("DirEndpoint().NetAddr = %q, want %q", got, want)
+	}
+
+	// Relative names in an included file in another directory are
+	// interpreted relative to that file, not the including one.
+	for _, k := range []string{"public.upspinkey", "secret.upspinkey"} {
+		key, err := ioutil.ReadFile(filepath.Join(secretsDir, k))
+		if err != nil {
+			t.Fatal(err)
+		}
+		write("shared/keys/"+k, string(key))
+	}
+	write("shared/shared", "secrets: keys\ncredentials_file: netrc\nupspin_home: home\nprofiles:\n  test:\n    upspin_home: testhome\n")
+	user = write("users/ann/config", "include: ../../shared/shared\nusername: ann@example.com\n")
+	for _, profile := range []string{"", "test"} {
+		cfg, err = FromFile(user, WithProfile(profile))
+		if err != nil {
+			t.Fatalf("profile %q: %v", profile, err)
+		}
+		home := "home"
+		if profile != "" {
+			home = "testhome"
+		}
+		for k, want := range map[string]string{
+			credentialsFile: filepath.Join(dir, "shared", "netrc"),
+			upspinHome:      filepath.Join(dir, "shared", home),
+		} {
+			if got := cfg.Value(k); got != want {
+				t.Errorf("profile %q: Value(%q) = %q, want %q", profile, k, got, want)
+			}
+		}
+	}
+
+	// Circular includes.
+	write("a", "include: b\n")
+	b := write("b", "include: a\n")
+	_, err = FromFile(b)
+	if err == nil || !strings.Contains(err.Error(), "circular include") {
+		t.Errorf("circular include: got error %v", err)
+	}
+
+	// InitConfig does not support include.
+	_, err = InitConfig(strings.NewReader("include: " + base + "\n"))
+	if err == nil {
+		t.Errorf("InitConfig with include: got no error")
+	}
+}
+
+func TestEndpointTimeout(t *testing.T) {
+	base := "secrets: " + secretsDir + "\n"
+	cfg, err := InitConfig(strings.NewReader(base + "keyserver_timeout: 30s\ndirserver_timeout: 2m\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		server string
+		want   time.Duration
+	}{
+		{"keyserver", 30 * time.Second},
+		{"dirserver", 2 * time.Minute},
+		{"storeserver", DefaultDialTimeout},
+		{"cache", DefaultDialTimeout},
+	}
+	for _, test := range tests {
+		if got := EndpointTimeout(cfg, test.server); got != test.want {
+			t.Errorf("EndpointTimeout(%q) = %v, want %v", test.server, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{"30", "soon", "-1s"} {
+		_, err := InitConfig(strings.NewReader(base + "storeserver_timeout: " + bad + "\n"))
+		if err == nil || !strings.Contains(err.Error(), "storeserver_timeout: invalid duration") {
+			t.Errorf("storeserver_timeout %q: got error %v", bad, err)
+		}
+	}
+}
+
+func TestSecretsEnv(t *testing.T) {
+	fromDir, err := InitConfig(strings.NewReader("secrets: " + secretsDir + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Convert the test user's keys to PEM.
+	pubKey, err := ioutil.ReadFile(filepath.Join(secretsDir, "public.upspinkey"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	secKey, err := ioutil.ReadFile(filepath.Join(secretsDir, "secret.upspinkey"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := factotum.ParsePublicKey(upspin.PublicKey(pubKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d big.Int
+	if _, ok := d.SetString(strings.TrimSpace(string(secKey)), 10); !ok {
+		t.Fatal("bad secret key")
+	}
+	der, err := x509.MarshalECPrivateKey(&ecdsa.PrivateKey{PublicKey: *pub, D: &d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+
+	defer func() { envFactotum.f = nil }()
+	for _, val := range []string{string(pemData), base64.StdEncoding.EncodeToString(pemData)} {
+		os.Setenv("UPSPIN_PRIVATE_KEY", val)
+		cfg, err := InitConfig(strings.NewReader("secrets: env\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := os.LookupEnv("UPSPIN_PRIVATE_KEY"); ok {
+			t.Errorf("UPSPIN_PRIVATE_KEY is still set")
+		}
+		hash := sha256.Sum256([]byte("hello"))
+		sig, err := cfg.Factotum().Sign(hash[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := factotum.Verify(hash[:], sig, fromDir.Factotum().PublicKey()); err != nil {
+			t.Errorf("signature from env key does not verify with directory key: %v", err)
+		}
+	}
+
+	// A later load, such as a reload, reuses the key.
+	cfg, err := InitConfig(strings.NewReader("secrets: env\n"))
+	if err != nil {
+		t.Fatalf("second load: %v", err)
+	}
+	if cfg.Factotum().PublicKey() != fromDir.Factotum().PublicKey() {
+		t.Errorf("second load: PublicKey() = %q, want %q", cfg.Factotum().PublicKey(), fromDir.Factotum().PublicKey())
+	}
+
+	// UPSPIN_SECRETS still names the secrets directory.
+	os.Setenv("UPSPIN_SECRETS", secretsDir)
+	defer os.Unsetenv("UPSPIN_SECRETS")
+	cfg, err = InitConfig(strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := factotumDir(cfg); got != secretsDir {
+		t.Errorf("secrets dir from UPSPIN_SECRETS = %q, want %q", got, secretsDir)
+	}
+
+	// With no key loaded, the variable must be set.
+	envFactotum.f = nil
+	if _, err := InitConfig(strings.NewReader("secrets: env\n")); err == nil {
+		t.Errorf("secrets env without UPSPIN_PRIVATE_KEY: got no error")
+	}
+}
+
+func TestProxyURL(t *testing.T) {
+	envs := []string{"HTTPS_PROXY", "https_proxy", "HTTP_PROXY", "http_proxy"}
+	for _, name := range envs {
+		if v, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, v)
+		} else {
+			defer os.Unsetenv(name)
+		}
+		os.Unsetenv(name)
+	}
+
+	base := "secrets: " + secretsDir + "\n"
+	cfg, err := InitConfig(strings.NewReader(base))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := ProxyURL(cfg); u != nil {
+		t.Errorf("ProxyURL with no proxy = %v, want nil", u)
+	}
+
+	// The environment is consulted when the config has no proxy key.
+	os.Setenv("HTTPS_PROXY", "https://env.example.com:3128")
+	if u := ProxyURL(cfg); u == nil || u.String() != "https://env.example.com:3128" {
+		t.Errorf("ProxyURL from HTTPS_PROXY = %v", u)
+	}
+
+	// The proxy key takes precedence over the environment.
+	for _, test := range []struct {
+		proxy, want string
+	}{
+		{"http://proxy.example.com:8080", "http://proxy.example.com:8080"},
+		{"proxy.example.com:8080", "http://proxy.example.com:8080"},
+	} {
+		cfg, err := InitConfig(strings.NewReader(base + "proxy: " + test.proxy + "\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u := ProxyURL(cfg); u == nil || u.String() != test.want {
+			t.Errorf("ProxyURL for %q = %v, want %s", test.proxy, u, test.want)
+		}
+	}
+
+	for _, bad := range []string{"ftp://proxy.example.com", "http://", "http://%zz"} {
+		_, err := InitConfig(strings.NewReader(base + "proxy: " + bad + "\n"))
+		if err == nil || !strings.Contains(err.Error(), "proxy:") {
+			t.Errorf("proxy %q: got error %v", bad, err)
+		}
+	}
+}
+
+func TestStoreEndpoints(t *testing.T) {
+	base := "secrets: " + secretsDir + "\n"
+	ep := func(addr string) upspin.Endpoint {
+		return upspin.Endpoint{Transport: upspin.Remote, NetAddr: upspin.NetAddr(addr)}
+	}
+	tests := []struct {
+		config string
+		want   []upspin.Endpoint
+	}{
+		{"", nil},
+		{"storeserver: a.example.com\n", []upspin.Endpoint{ep("a.example.com:443")}},
+		{
+			"storeservers: [a.example.com, 'remote,b.example.com:8080', inprocess]\n",
+			[]upspin.Endpoint{ep("a.example.com:443"), ep("b.example.com:8080"), {Transport: upspin.InProcess}},
+		},
+		{
+			"storeservers:\n - a.example.com\n - b.example.com\n",
+			[]upspin.Endpoint{ep("a.example.com:443"), ep("b.example.com:443")},
+		},
+		{
+			// The storeserver key supplies the first entry.
+			"storeserver: c.example.com\nstoreservers: [a.example.com, b.example.com]\n",
+			[]upspin.Endpoint{ep("c.example.com:443"), ep("a.example.com:443"), ep("b.example.com:443")},
+		},
+		{
+			"storeserver: b.example.com\nstoreservers: [a.example.com, b.example.com]\n",
+			[]upspin.Endpoint{ep("b.example.com:443"), ep("a.example.com:443")},
+		},
+	}
+	for _, test := range tests {
+		cfg, err := InitConfig(strings.NewReader(base + test.config))
+		if err != nil {
+			t.Errorf("%q: %v", test.config, err)
+			continue
+		}
+		got := StoreEndpoints(cfg)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%q: StoreEndpoints = %v, want %v", test.config, got, test.want)
+		}
+		want := upspin.Endpoint{}
+		if len(test.want) > 0 {
+			want = test.want[0]
+		}
+		if got := cfg.StoreEndpoint(); got != want {
+			t.Errorf("%q: StoreEndpoint = %v, want %v", test.config, got, want)
+		}
+		testRoundTrip(t, cfg, nil)
+	}
+
+	// A later SetStoreEndpoint replaces the list.
+	cfg := SetStoreEndpoints(New(), []upspin.Endpoint{ep("a.example.com:443"), ep("b.example.com:443")})
+	cfg = SetStoreEndpoint(cfg, ep("c.example.com:443"))
+	if got, want := StoreEndpoints(cfg), []upspin.Endpoint{ep("c.example.com:443")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after SetStoreEndpoint: StoreEndpoints = %v, want %v", got, want)
+	}
+}
+
+func TestFromReader(t *testing.T) {
+	// Name the secrets directory relative to its parent,
+	// which is not the current directory.
+	abs, err := filepath.Abs(secretsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseDir, rel := filepath.Split(abs)
+	want, err := InitConfig(strings.NewReader("secrets: " + abs + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := FromReader(strings.NewReader("secrets: "+rel+"\n"), baseDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.Factotum().PublicKey(), want.Factotum().PublicKey(); got != want {
+		t.Errorf("PublicKey = %q, want %q", got, want)
+	}
+
+	// Absolute paths and special values are not affected.
+	if _, err := FromReader(strings.NewReader("secrets: "+abs+"\n"), "/nonexistent"); err != nil {
+		t.Errorf("absolute secrets: %v", err)
+	}
+	if _, err := FromReader(strings.NewReader("secrets: none\n"), baseDir); err != ErrNoFactotum {
+		t.Errorf("secrets none: got error %v, want %v", err, ErrNoFactotum)
+	}
+
+	// Without a base directory, the path is relative to the current
+	// directory, as with InitConfig.
+	if _, err := FromReader(strings.NewReader("secrets: "+rel+"\n"), ""); err == nil {
+		t.Errorf("relative secrets with no base directory: got no error")
+	}
+
+	// FromFile resolves relative paths against the file's directory.
+	tmp, err := ioutil.TempDir("", "config-fromreader")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	rel, err = filepath.Rel(tmp, abs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(tmp, "config")
+	if err := ioutil.WriteFile(file, []byte("secrets: "+rel+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromFile(file); err != nil {
+		t.Errorf("FromFile with relative secrets: %v", err)
+	}
+}
+
+func TestSecretsKeychain(t *testing.T) {
+	want, err := factotum.NewFromDir(secretsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	factotum.RegisterKeychainProvider(func(user upspin.UserName) (upspin.Factotum, error) {
+		if user != "ann@example.com" {
+			return nil, errors.E(errors.NotExist, user)
+		}
+		return want, nil
+	})
+	defer factotum.RegisterKeychainProvider(nil)
+
+	cfg, err := InitConfig(strings.NewReader("username: ann@example.com\nsecrets: keychain\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Factotum().PublicKey(); got != want.PublicKey() {
+		t.Errorf("PublicKey = %q, want %q", got, want.PublicKey())
+	}
+	testRoundTrip(t, cfg, nil)
+
+	_, err = InitConfig(strings.NewReader("username: bob@example.com\nsecrets: keychain\n"))
+	if !errors.Match(errors.E(errors.NotExist), err) {
+		t.Errorf("unknown user: got error %v, want NotExist", err)
+	}
+}
+
+func TestTLSServerName(t *testing.T) {
+	cfg, err := InitConfig(strings.NewReader(`
+dirserver: remote,dir.example.com:443
+dirserver_tls_name: upspin.example.com
+storeserver_tls_name: store.internal.example.com
+secrets: none
+`))
+	if err != ErrNoFactotum {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		server, want string
+	}{
+		{"dirserver", "upspin.example.com"},
+		{"storeserver", "store.internal.example.com"},
+		{"keyserver", ""},
+	}
+	for _, test := range tests {
+		if got := TLSServerName(cfg, test.server); got != test.want {
+			t.Errorf("TLSServerName(%q) = %q, want %q", test.server, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{"dir.example.com:443", "https://dir.example.com", "two words"} {
+		_, err := InitConfig(strings.NewReader("dirserver_tls_name: " + bad + "\nsecrets: none\n"))
+		if !errors.Match(errors.E(errors.Invalid), err) {
+			t.Errorf("dirserver_tls_name %q: err = %v, want invalid", bad, err)
+		}
+	}
+}
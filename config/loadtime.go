@@ -0,0 +1,40 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"time"
+
+	"upspin.io/upspin"
+)
+
+// cfgLoadTime records the time at which a config was loaded.
+type cfgLoadTime struct {
+	upspin.Config
+	loaded time.Time
+}
+
+// LoadedAt returns the time at which the config, or the config from
+// which it was derived, was loaded by InitConfig, FromFile, or another
+// function of this package that reads a config. A config delivered by
+// Watch reports the time it was reloaded. LoadedAt returns the zero
+// time for a config that was not loaded, such as one returned by New.
+func LoadedAt(cfg upspin.Config) time.Time {
+	switch c := find(cfg, isLoadTime).(type) {
+	case cfgLoadTime:
+		return c.loaded
+	case Snapshot:
+		return c.loaded
+	}
+	return time.Time{}
+}
+
+func isLoadTime(cfg upspin.Config) bool {
+	switch cfg.(type) {
+	case cfgLoadTime, Snapshot:
+		return true
+	}
+	return false
+}
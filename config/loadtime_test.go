@@ -0,0 +1,44 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadedAt(t *testing.T) {
+	before := time.Now()
+	cfg, err := InitConfig(strings.NewReader("username: ann@example.com\nsecrets: " + secretsDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now()
+	got := LoadedAt(cfg)
+	if got.Before(before) || got.After(after) {
+		t.Errorf("LoadedAt() = %v, want between %v and %v", got, before, after)
+	}
+	// Derived configs report the time their base was loaded.
+	if got := LoadedAt(Freeze(SetUserName(cfg, "bob@example.com"))); !got.Equal(LoadedAt(cfg)) {
+		t.Errorf("LoadedAt(derived) = %v, want %v", got, LoadedAt(cfg))
+	}
+
+	// As do snapshots and clones.
+	if got := LoadedAt(NewSnapshot(cfg)); !got.Equal(LoadedAt(cfg)) {
+		t.Errorf("LoadedAt(NewSnapshot) = %v, want %v", got, LoadedAt(cfg))
+	}
+	clone := Clone(SetUserName(cfg, "bob@example.com"))
+	if got := LoadedAt(clone); !got.Equal(LoadedAt(cfg)) {
+		t.Errorf("LoadedAt(Clone) = %v, want %v", got, LoadedAt(cfg))
+	}
+
+	if got := LoadedAt(New()); !got.IsZero() {
+		t.Errorf("LoadedAt(New()) = %v, want zero time", got)
+	}
+	if got := LoadedAt(SetUserName(New(), "ann@example.com")); !got.IsZero() {
+		t.Errorf("LoadedAt(SetUserName(New())) = %v, want zero time", got)
+	}
+}
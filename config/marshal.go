@@ -0,0 +1,217 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"upspin.io/errors"
+	"upspin.io/pack"
+	"upspin.io/upspin"
+)
+
+// MarshalConfig returns the YAML representation of the given config,
+// in the format read by InitConfig, marked with CurrentVersion.
+// Parsing the result with InitConfig yields a config with the same values.
+//
+// Unassigned endpoints are omitted, except for the key server, whose
+// default is not unassigned. If the config has no Factotum, secrets is
+// set to "none". The secrets and tlscerts directories are recorded only
+// if they are known, that is, if the Factotum and certificate pool were
+// loaded by InitConfig; a Factotum installed by SetFactotum is recorded
+// as the default secrets directory.
+func MarshalConfig(cfg upspin.Config) ([]byte, error) {
+	const op = "config.MarshalConfig"
+	var m yaml.MapSlice
+	add := func(key string, val interface{}) {
+		m = append(m, yaml.MapItem{Key: key, Value: val})
+	}
+
+	add(versionKey, CurrentVersion)
+	add(username, string(cfg.UserName()))
+	if pack.Lookup(cfg.Packing()) == nil {
+		return nil, errors.E(op, errors.Invalid, errors.Errorf("unknown packing %v", cfg.Packing()))
+	}
+	add(packing, cfg.Packing().String())
+
+	endpoints := []struct {
+		key string
+		ep  upspin.Endpoint
+	}{
+		{keyserver, cfg.KeyEndpoint()},
+		{dirserver, cfg.DirEndpoint()},
+		{storeserver, cfg.StoreEndpoint()},
+		{cache, cfg.CacheEndpoint()},
+	}
+	for _, e := range endpoints {
+		if e.ep.Transport == upspin.Unassigned && e.key != keyserver {
+			continue
+		}
+		s, err := e.ep.MarshalYAML()
+		if err != nil {
+			return nil, errors.E(op, errors.Invalid, errors.Errorf("%s: %v", e.key, err))
+		}
+		add(e.key, s)
+	}
+	if eps := StoreEndpoints(cfg); len(eps) > 1 {
+		var list []string
+		for _, e := range eps {
+			s, err := e.MarshalYAML()
+			if err != nil {
+				return nil, errors.E(op, errors.Invalid, errors.Errorf("%s: %v", storeservers, err))
+			}
+			list = append(list, s.(string))
+		}
+		add(storeservers, list)
+	}
+
+	for _, k := range timeoutKeys {
+		if v := cfg.Value(k); v != "" {
+			add(k, v)
+		}
+	}
+	for _, k := range retryKeys {
+		if cfg.Value(k) == "" {
+			continue
+		}
+		p := GetRetryPolicy(cfg, strings.TrimSuffix(k, retrySuffix))
+		add(k, yaml.MapSlice{
+			{Key: maxAttempts, Value: p.MaxAttempts},
+			{Key: initialBackoff, Value: p.InitialBackoff.String()},
+			{Key: maxBackoff, Value: p.MaxBackoff.String()},
+		})
+	}
+
+	if v := cfg.Value(proxy); v != "" {
+		add(proxy, v)
+	}
+	if v := cfg.Value(upspinHome); v != "" {
+		add(upspinHome, v)
+	}
+	if v := cfg.Value(credentialsFile); v != "" {
+		add(credentialsFile, v)
+	}
+	for _, k := range tlsNameKeys {
+		if v := cfg.Value(k); v != "" {
+			add(k, v)
+		}
+	}
+	for _, k := range cacheKeys {
+		if v := cfg.Value(k); v != "" {
+			add(k, v)
+		}
+	}
+
+	if cfg.Factotum() == nil {
+		add(secrets, "none")
+	} else if dir := factotumDir(cfg); dir != "" {
+		add(secrets, dir)
+	}
+	if dir := TLSCerts(cfg); dir != "" {
+		add(tlscerts, dir)
+	}
+	if flags := allFlags(cfg); flags != nil {
+		add("cmdflags", flags)
+	}
+
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	return data, nil
+}
+
+// find returns the most recently derived config in the chain leading
+// to cfg for which the predicate is true, or nil if there is none.
+func find(cfg upspin.Config, pred func(upspin.Config) bool) upspin.Config {
+	for ; cfg != nil; cfg = parent(cfg) {
+		if pred(cfg) {
+			return cfg
+		}
+	}
+	return nil
+}
+
+// The predicates below match the configs that hold a particular value.
+// A Snapshot holds all values. A scrubbed config holds its own Factotum.
+
+func isFactotum(cfg upspin.Config) bool {
+	switch cfg.(type) {
+	case cfgFactotum, Snapshot, scrubbedConfig:
+		return true
+	}
+	return false
+}
+
+func isFlags(cfg upspin.Config) bool {
+	switch cfg.(type) {
+	case cfgFlags, Snapshot:
+		return true
+	}
+	return false
+}
+
+func isCertPool(cfg upspin.Config) bool {
+	switch cfg.(type) {
+	case cfgCertPool, cfgTLSCerts, Snapshot:
+		return true
+	}
+	return false
+}
+
+// factotumDir returns the directory from which the Factotum of the config
+// was loaded, or the empty string if it is not known.
+func factotumDir(cfg upspin.Config) string {
+	switch c := find(cfg, isFactotum).(type) {
+	case cfgFactotum:
+		return c.secrets
+	case Snapshot:
+		return c.secrets
+	case scrubbedConfig:
+		return redacted
+	}
+	return ""
+}
+
+// parent returns the config from which cfg was derived by one of the
+// Set functions of this package, by Freeze, or by Scrub, or nil if cfg was not
+// derived that way.
+func parent(cfg upspin.Config) upspin.Config {
+	switch c := cfg.(type) {
+	case cfgUserName:
+		return c.Config
+	case cfgFactotum:
+		return c.Config
+	case cfgPacking:
+		return c.Config
+	case cfgKeyEndpoint:
+		return c.Config
+	case cfgStoreEndpoint:
+		return c.Config
+	case cfgStoreEndpoints:
+		return c.Config
+	case cfgCacheEndpoint:
+		return c.Config
+	case cfgDirEndpoint:
+		return c.Config
+	case cfgCertPool:
+		return c.Config
+	case cfgTLSCerts:
+		return c.Config
+	case cfgFlags:
+		return c.Config
+	case cfgValue:
+		return c.Config
+	case cfgLoadTime:
+		return c.Config
+	case frozenConfig:
+		return c.Config
+	case scrubbedConfig:
+		return c.Config
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"upspin.io/upspin"
+)
+
+func TestMarshalConfig(t *testing.T) {
+	certsDir, err := filepath.Abs("../rpc/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configuration := `
+username: p@google.com
+packing: plain
+keyserver: inprocess
+dirserver: remote,dir.example.com
+storeserver: store.example.com:8080
+cache: remote,cache.example.com:5580
+dirserver_timeout: 1m30s
+storeserver_retry: {max_attempts: 3, initial_backoff: 1s, max_backoff: 30s}
+tlscerts: ` + certsDir + `
+secrets: ` + secretsDir + `
+cmdflags:
+ cacheserver:
+  cachedir: /tmp
+  cachesize: 1000000000
+ upspinfs:
+  cachedir: /tmp
+`
+	cfg, err := InitConfig(strings.NewReader(configuration))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testRoundTrip(t, cfg, nil)
+
+	// A config built without a file, with no Factotum.
+	cfg = SetUserName(New(), "ann@example.com")
+	cfg = SetStoreEndpoint(cfg, upspin.Endpoint{Transport: upspin.Remote, NetAddr: "store.example.com:443"})
+	cfg = SetKeyEndpoint(cfg, upspin.Endpoint{})
+	testRoundTrip(t, cfg, ErrNoFactotum)
+
+	// A certificate directory set without a file.
+	testRoundTrip(t, SetTLSCerts(cfg, certsDir), ErrNoFactotum)
+}
+
+func testRoundTrip(t *testing.T, cfg upspin.Config, wantErr error) {
+	data, err := MarshalConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := InitConfig(bytes.NewReader(data))
+	if err != wantErr {
+		t.Fatalf("InitConfig(%q) = %v, want %v", data, err, wantErr)
+	}
+	if g, w := got.UserName(), cfg.UserName(); g != w {
+		t.Errorf("UserName() = %q, want %q", g, w)
+	}
+	if g, w := got.Packing(), cfg.Packing(); g != w {
+		t.Errorf("Packing() = %v, want %v", g, w)
+	}
+	if g, w := StoreEndpoints(got), StoreEndpoints(cfg); !reflect.DeepEqual(g, w) {
+		t.Errorf("StoreEndpoints() = %v, want %v", g, w)
+	}
+	endpoints := []struct {
+		name      string
+		got, want upspin.Endpoint
+	}{
+		{"KeyEndpoint", got.KeyEndpoint(), cfg.KeyEndpoint()},
+		{"DirEndpoint", got.DirEndpoint(), cfg.DirEndpoint()},
+		{"StoreEndpoint", got.StoreEndpoint(), cfg.StoreEndpoint()},
+		{"CacheEndpoint", got.CacheEndpoint(), cfg.CacheEndpoint()},
+	}
+	for _, e := range endpoints {
+		if e.got != e.want {
+			t.Errorf("%s() = %v, want %v", e.name, e.got, e.want)
+		}
+	}
+	if cfg.Factotum() == nil {
+		if got.Factotum() != nil {
+			t.Errorf("Factotum() is non-nil")
+		}
+	} else if got.Factotum() == nil {
+		t.Errorf("Factotum() is nil")
+	} else if g, w := got.Factotum().PublicKey(), cfg.Factotum().PublicKey(); g != w {
+		t.Errorf("Factotum().PublicKey() = %q, want %q", g, w)
+	}
+	if (got.CertPool() == nil) != (cfg.CertPool() == nil) {
+		t.Errorf("CertPool() = %v, want %v", got.CertPool(), cfg.CertPool())
+	}
+	if g, w := TLSCerts(got), TLSCerts(cfg); g != w {
+		t.Errorf("TLSCerts() = %q, want %q", g, w)
+	}
+	for _, k := range append(timeoutKeys, retryKeys...) {
+		if g, w := got.Value(k), cfg.Value(k); g != w {
+			t.Errorf("Value(%q) = %q, want %q", k, g, w)
+		}
+	}
+	for _, cmd := range []string{"cacheserver", "upspinfs", "upspin"} {
+		if g, w := got.Flags(cmd), cfg.Flags(cmd); !reflect.DeepEqual(g, w) {
+			t.Errorf("Flags(%q) = %v, want %v", cmd, g, w)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"upspin.io/errors"
+	"upspin.io/log"
+	"upspin.io/upspin"
+)
+
+// credentialsFile is the key naming a file, in .netrc format, holding
+// credentials for servers that require HTTP authentication.
+const credentialsFile = "credentials_file"
+
+// netrcEntry is a machine or default entry in a .netrc file.
+type netrcEntry struct {
+	machine  string // Empty for the default entry.
+	login    string
+	password string
+}
+
+// netrcFile is a parsed .netrc file and the modification time of the
+// file when it was read.
+type netrcFile struct {
+	modTime time.Time
+	entries []netrcEntry
+}
+
+// netrcCache holds the credentials files read by Credentials, by name.
+var netrcCache struct {
+	sync.Mutex
+	files map[string]*netrcFile
+}
+
+// Credentials returns the user name and password for the named host,
+// which should not include a port, as recorded in the credentials file
+// named by the credentials_file key of the config. The file is in the
+// format of .netrc: a machine entry whose name is host is used or, if
+// there is none, the default entry. Either the user name or the
+// password may be empty. If the config names no credentials file, the
+// file does not exist, or it has no entry for the host, ok is false.
+//
+// Credentials are provided only for the hosts of the servers named in
+// the config: the key, directory, store, and cache servers. For any
+// other host, such as that of a directory server found in another
+// user's key server record, ok is false, whatever the file says.
+//
+// Like ssh with private keys, Credentials refuses to use a file that
+// can be read or written by anyone but its owner; the problem is
+// logged and ok is false. The file is read once and read again only
+// if it changes.
+func Credentials(cfg upspin.Config, host string) (user, password string, ok bool) {
+	name := cfg.Value(credentialsFile)
+	if name == "" || !isConfiguredHost(cfg, host) {
+		return "", "", false
+	}
+	f, err := readNetrc(name)
+	if err != nil {
+		if !errors.Match(errors.E(errors.NotExist), err) {
+			log.Error.Printf("config.Credentials: %v", err)
+		}
+		return "", "", false
+	}
+	var def *netrcEntry
+	for i := range f.entries {
+		e := &f.entries[i]
+		if e.machine == host {
+			return e.login, e.password, true
+		}
+		if e.machine == "" && def == nil {
+			def = e
+		}
+	}
+	if def != nil {
+		return def.login, def.password, true
+	}
+	return "", "", false
+}
+
+// isConfiguredHost reports whether host is the host of one of the
+// remote servers named in the config.
+func isConfiguredHost(cfg upspin.Config, host string) bool {
+	eps := append(StoreEndpoints(cfg), cfg.KeyEndpoint(), cfg.DirEndpoint(), cfg.StoreEndpoint(), cfg.CacheEndpoint())
+	for _, e := range eps {
+		if e.Transport != upspin.Remote {
+			continue
+		}
+		h, _, err := net.SplitHostPort(string(e.NetAddr))
+		if err != nil {
+			h = string(e.NetAddr)
+		}
+		if h == host {
+			return true
+		}
+	}
+	return false
+}
+
+// readNetrc returns the parsed contents of the named file,
+// from the cache if the file is unchanged.
+func readNetrc(name string) (*netrcFile, error) {
+	info, err := os.Stat(name)
+	if os.IsNotExist(err) {
+		return nil, errors.E(errors.NotExist, err)
+	}
+	if err != nil {
+		return nil, errors.E(errors.IO, err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, errors.E(errors.Permission, errors.Errorf("credentials file %s is accessible by others (mode %v); it must be accessible only by its owner", name, info.Mode().Perm()))
+	}
+
+	netrcCache.Lock()
+	defer netrcCache.Unlock()
+	if f, ok := netrcCache.files[name]; ok && f.modTime.Equal(info.ModTime()) {
+		return f, nil
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, errors.E(errors.IO, err)
+	}
+	f := &netrcFile{
+		modTime: info.ModTime(),
+		entries: parseNetrc(string(data)),
+	}
+	if netrcCache.files == nil {
+		netrcCache.files = make(map[string]*netrcFile)
+	}
+	netrcCache.files[name] = f
+	return f, nil
+}
+
+// parseNetrc parses the text of a .netrc file. Unknown tokens,
+// comments, and macro definitions are skipped. A comment starts with
+// a token beginning with # where a keyword is expected, so a # within
+// a value, such as a password, is not a comment.
+func parseNetrc(text string) []netrcEntry {
+	var entries []netrcEntry
+	var e *netrcEntry
+	lines := strings.Split(text, "\n")
+	for i := 0; i < len(lines); i++ {
+		fields := strings.Fields(lines[i])
+		for j := 0; j < len(fields); j++ {
+			if strings.HasPrefix(fields[j], "#") {
+				// The rest of the line is a comment.
+				break
+			}
+			// next returns the token after the current one, if any.
+			next := func() string {
+				if j+1 < len(fields) {
+					j++
+					return fields[j]
+				}
+				return ""
+			}
+			switch fields[j] {
+			case "machine":
+				entries = append(entries, netrcEntry{machine: next()})
+				e = &entries[len(entries)-1]
+			case "default":
+				entries = append(entries, netrcEntry{})
+				e = &entries[len(entries)-1]
+			case "login":
+				if v := next(); e != nil {
+					e.login = v
+				}
+			case "password":
+				if v := next(); e != nil {
+					e.password = v
+				}
+			case "account":
+				next()
+			case "macdef":
+				// A macro runs to the next blank line.
+				for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+					i++
+				}
+				j = len(fields)
+			}
+		}
+	}
+	return entries
+}
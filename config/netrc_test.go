@@ -0,0 +1,113 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+const testNetrc = `# Credentials for the test servers.
+machine key.example.com login ann password sec#ret1 # Ann's key server.
+machine dir.example.com
+	login bob
+	# A comment between keywords.
+	password #secret2
+
+macdef init
+machine store.example.com login eve password wrong
+
+machine token.example.com password token3
+machine third.example.com login mallory password secret5
+default login guest password secret4
+`
+
+func TestCredentials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := filepath.Join(dir, "netrc")
+	if err := ioutil.WriteFile(name, []byte(testNetrc), 0600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := InitConfig(strings.NewReader(`
+secrets: none
+keyserver: key.example.com
+dirserver: dir.example.com
+storeservers:
+ - store.example.com
+ - token.example.com
+ - other.example.com:8443
+credentials_file: ` + name))
+	if err != ErrNoFactotum {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host, user, password string
+	}{
+		// A # in a value does not start a comment.
+		{"key.example.com", "ann", "sec#ret1"},
+		{"dir.example.com", "bob", "#secret2"},
+		{"token.example.com", "", "token3"},
+		// The macro hides the machine after it; the default applies.
+		{"store.example.com", "guest", "secret4"},
+		{"other.example.com", "guest", "secret4"},
+	}
+	for _, test := range tests {
+		user, password, ok := Credentials(cfg, test.host)
+		if !ok || user != test.user || password != test.password {
+			t.Errorf("Credentials(%q) = %q, %q, %t; want %q, %q, true", test.host, user, password, ok, test.user, test.password)
+		}
+	}
+
+	// Hosts of servers not named in the config get nothing,
+	// neither their own entry nor the default.
+	for _, host := range []string{"third.example.com", "unknown.example.com"} {
+		if user, password, ok := Credentials(cfg, host); ok {
+			t.Errorf("Credentials(%q) = %q, %q, true; want false", host, user, password)
+		}
+	}
+
+	// Without a default entry, an unknown host has no credentials.
+	noDefault := testNetrc[:strings.Index(testNetrc, "default")]
+	if err := ioutil.WriteFile(name, []byte(noDefault), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// Ensure the change is seen even if the modification time is unchanged.
+	delete(netrcCache.files, name)
+	if user, password, ok := Credentials(cfg, "other.example.com"); ok {
+		t.Errorf("Credentials(other.example.com) = %q, %q, true; want false", user, password)
+	}
+
+	// A file that others can read is refused.
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(name, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, ok := Credentials(cfg, "key.example.com"); ok {
+			t.Errorf("Credentials succeeded with mode 0644")
+		}
+	}
+
+	// A missing file provides no credentials.
+	if err := os.Remove(name); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := Credentials(cfg, "key.example.com"); ok {
+		t.Errorf("Credentials succeeded with missing file")
+	}
+
+	// Nor does a config with no credentials file.
+	if _, _, ok := Credentials(New(), "key.example.com"); ok {
+		t.Errorf("Credentials succeeded with no credentials file")
+	}
+}
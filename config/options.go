@@ -0,0 +1,121 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"crypto/x509"
+
+	"upspin.io/upspin"
+)
+
+// An Option sets a value of the config built by NewWithDefaults.
+type Option func(*Snapshot)
+
+// NewWithDefaults returns a config holding the default values, as does
+// New, modified by the given options, which are applied in order.
+// For example,
+//	cfg := config.NewWithDefaults(
+//		config.WithUserName("ann@example.com"),
+//		config.WithDirEndpoint(dirEndpoint),
+//	)
+// is equivalent to, and more convenient than, a chain of calls to
+// SetUserName and SetDirEndpoint. The result is a Snapshot.
+func NewWithDefaults(opts ...Option) upspin.Config {
+	s := NewSnapshot(New())
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+// WithUserName returns an Option that sets the user name, as does SetUserName.
+func WithUserName(u upspin.UserName) Option {
+	return func(s *Snapshot) { s.userName = u }
+}
+
+// WithFactotum returns an Option that sets the Factotum, as does SetFactotum.
+func WithFactotum(f upspin.Factotum) Option {
+	return func(s *Snapshot) {
+		s.factotum = f
+		s.secrets = ""
+	}
+}
+
+// WithPacking returns an Option that sets the packing, as does SetPacking.
+func WithPacking(p upspin.Packing) Option {
+	return func(s *Snapshot) { s.packing = p }
+}
+
+// WithKeyEndpoint returns an Option that sets the key endpoint,
+// as does SetKeyEndpoint.
+func WithKeyEndpoint(e upspin.Endpoint) Option {
+	return func(s *Snapshot) { s.keyEndpoint = e }
+}
+
+// WithDirEndpoint returns an Option that sets the directory endpoint,
+// as does SetDirEndpoint.
+func WithDirEndpoint(e upspin.Endpoint) Option {
+	return func(s *Snapshot) { s.dirEndpoint = e }
+}
+
+// WithStoreEndpoint returns an Option that sets the store endpoint,
+// as does SetStoreEndpoint. It replaces any list of store endpoints.
+func WithStoreEndpoint(e upspin.Endpoint) Option {
+	return func(s *Snapshot) {
+		s.storeEndpoint = e
+		s.storeEndpoints = nil
+	}
+}
+
+// WithStoreEndpoints returns an Option that sets the list of store
+// endpoints, as does SetStoreEndpoints. If the list is empty, the
+// Option does nothing.
+func WithStoreEndpoints(eps []upspin.Endpoint) Option {
+	return func(s *Snapshot) {
+		if len(eps) == 0 {
+			return
+		}
+		s.storeEndpoint = eps[0]
+		s.storeEndpoints = nil
+		if len(eps) > 1 {
+			s.storeEndpoints = append([]upspin.Endpoint(nil), eps...)
+		}
+	}
+}
+
+// WithCacheEndpoint returns an Option that sets the cache endpoint,
+// as does SetCacheEndpoint.
+func WithCacheEndpoint(e upspin.Endpoint) Option {
+	return func(s *Snapshot) { s.cacheEndpoint = e }
+}
+
+// WithCertPool returns an Option that sets the certificate pool,
+// as does SetCertPool.
+func WithCertPool(pool *x509.CertPool) Option {
+	return func(s *Snapshot) {
+		s.certPool = pool
+		s.tlsCerts = ""
+	}
+}
+
+// WithFlags returns an Option that sets the command flags, as does SetFlags.
+func WithFlags(flags map[string]map[string]string) Option {
+	return func(s *Snapshot) {
+		s.flags = make(map[string]map[string]string)
+		for cmd, f := range flags {
+			s.flags[cmd] = copyFlags(f)
+		}
+	}
+}
+
+// WithValue returns an Option that sets the value of a key, as does SetValue.
+func WithValue(key, value string) Option {
+	return func(s *Snapshot) {
+		if s.values == nil {
+			s.values = make(map[string]string)
+		}
+		s.values[key] = value
+	}
+}
@@ -0,0 +1,63 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"testing"
+
+	"upspin.io/upspin"
+)
+
+func TestNewWithDefaults(t *testing.T) {
+	if got, want := NewWithDefaults(), New(); !Equal(got, want) {
+		t.Errorf("NewWithDefaults() differs from New(): %q", Diff(got, want))
+	}
+
+	got := NewWithDefaults(WithUserName("alice@example.com"))
+	want := SetUserName(New(), "alice@example.com")
+	if !Equal(got, want) {
+		t.Errorf("NewWithDefaults(WithUserName) differs from SetUserName: %q", Diff(got, want))
+	}
+
+	dir := upspin.Endpoint{Transport: upspin.Remote, NetAddr: "dir.example.com:443"}
+	store1 := upspin.Endpoint{Transport: upspin.Remote, NetAddr: "store1.example.com:443"}
+	store2 := upspin.Endpoint{Transport: upspin.Remote, NetAddr: "store2.example.com:443"}
+	flags := map[string]map[string]string{"upspinfs": {"cachedir": "/tmp"}}
+	got = NewWithDefaults(
+		WithUserName("alice@example.com"),
+		WithPacking(upspin.PlainPack),
+		WithKeyEndpoint(upspin.Endpoint{Transport: upspin.InProcess}),
+		WithDirEndpoint(dir),
+		WithStoreEndpoints([]upspin.Endpoint{store1, store2}),
+		WithCacheEndpoint(upspin.Endpoint{}),
+		WithFlags(flags),
+		WithValue("dirserver_timeout", "1m"),
+	)
+	want = New()
+	want = SetUserName(want, "alice@example.com")
+	want = SetPacking(want, upspin.PlainPack)
+	want = SetKeyEndpoint(want, upspin.Endpoint{Transport: upspin.InProcess})
+	want = SetDirEndpoint(want, dir)
+	want = SetStoreEndpoints(want, []upspin.Endpoint{store1, store2})
+	want = SetCacheEndpoint(want, upspin.Endpoint{})
+	want = SetFlags(want, flags)
+	want = SetValue(want, "dirserver_timeout", "1m")
+	if !Equal(got, want) {
+		t.Errorf("NewWithDefaults with options differs from Set functions: %q", Diff(got, want))
+	}
+
+	// A later store endpoint replaces the list, as with SetStoreEndpoint.
+	got = NewWithDefaults(WithStoreEndpoints([]upspin.Endpoint{store1, store2}), WithStoreEndpoint(store2))
+	if eps := StoreEndpoints(got); len(eps) != 1 || eps[0] != store2 {
+		t.Errorf("StoreEndpoints = %v, want [%v]", eps, store2)
+	}
+
+	// Options do not affect configs built earlier.
+	first := NewWithDefaults(WithValue("k", "v1"))
+	NewWithDefaults(WithValue("k", "v2"))
+	if v := first.Value("k"); v != "v1" {
+		t.Errorf(`Value("k") = %q, want "v1"`, v)
+	}
+}
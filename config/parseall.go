@@ -0,0 +1,92 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// ParseAll reads a YAML stream holding several config files, as documents
+// separated by "---" lines, and returns a config for each document, in
+// order, as parsed by InitConfig. Documents holding nothing but comments
+// are skipped. A document that does not set username takes the user name
+// of the first document, which may therefore serve as a header giving a
+// default user. As with ParseProfiles, a document whose secrets key is
+// "none" yields a config without a Factotum, and this is not reported
+// as an error. If any document cannot be parsed, ParseAll returns an error
+// identifying the document by its number, counting from 1.
+func ParseAll(r io.Reader) ([]upspin.Config, error) {
+	const op = "config.ParseAll"
+	docs, err := splitDocuments(r)
+	if err != nil {
+		return nil, errors.E(op, errors.IO, err)
+	}
+	if len(docs) == 0 {
+		return nil, errors.E(op, errors.Invalid, errors.Str("no config documents"))
+	}
+	var defaultUser string
+	var cfgs []upspin.Config
+	for i, doc := range docs {
+		vals := map[string]interface{}{}
+		if err := yaml.Unmarshal(doc, vals); err != nil {
+			return nil, errors.E(op, errors.Invalid, errors.Errorf("document %d: parsing YAML: %v", i+1, err))
+		}
+		if v, ok := vals[username]; ok {
+			if i == 0 {
+				defaultUser, _ = asString(v)
+			}
+		} else if defaultUser != "" {
+			doc = append([]byte(username+": "+defaultUser+"\n"), doc...)
+		}
+		cfg, err := InitConfig(bytes.NewReader(doc))
+		if err != nil && err != ErrNoFactotum {
+			return nil, errors.E(op, errors.Errorf("document %d: %v", i+1, err))
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	return cfgs, nil
+}
+
+// splitDocuments splits a YAML stream into its documents at lines
+// consisting of "---", dropping documents that hold only blank lines
+// and comments.
+func splitDocuments(r io.Reader) ([][]byte, error) {
+	var docs [][]byte
+	var doc bytes.Buffer
+	empty := true
+	flush := func() {
+		if !empty {
+			docs = append(docs, append([]byte(nil), doc.Bytes()...))
+		}
+		doc.Reset()
+		empty = true
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimRight(line, " \t") == "---" {
+			flush()
+			continue
+		}
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			empty = false
+		}
+		doc.WriteString(line)
+		doc.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return docs, nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"upspin.io/upspin"
+)
+
+func TestParseAll(t *testing.T) {
+	const stream = `
+# Ann's config.
+username: ann@example.com
+dirserver: remote,dir.example.com:443
+secrets: none
+---
+username: bob@example.com
+dirserver: remote,bob.example.com:443
+secrets: none
+---
+# No user name: this is Ann's too.
+storeserver: remote,store.example.com:443
+secrets: none
+---
+# An empty document is skipped.
+`
+	cfgs, err := ParseAll(strings.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		user upspin.UserName
+		dir  upspin.NetAddr
+	}{
+		{"ann@example.com", "dir.example.com:443"},
+		{"bob@example.com", "bob.example.com:443"},
+		{"ann@example.com", ""},
+	}
+	if len(cfgs) != len(want) {
+		t.Fatalf("got %d configs, want %d", len(cfgs), len(want))
+	}
+	for i, w := range want {
+		if got := cfgs[i].UserName(); got != w.user {
+			t.Errorf("config %d: UserName() = %q, want %q", i, got, w.user)
+		}
+		if got := cfgs[i].DirEndpoint().NetAddr; got != w.dir {
+			t.Errorf("config %d: DirEndpoint().NetAddr = %q, want %q", i, got, w.dir)
+		}
+		if cfgs[i].Factotum() != nil {
+			t.Errorf("config %d: Factotum() is non-nil", i)
+		}
+	}
+	if got, want := cfgs[2].StoreEndpoint().NetAddr, upspin.NetAddr("store.example.com:443"); got != want {
+		t.Errorf("config 2: StoreEndpoint().NetAddr = %q, want %q", got, want)
+	}
+}
+
+func TestParseAllErrors(t *testing.T) {
+	tests := []struct {
+		stream, want string
+	}{
+		{"username: ann@example.com\nsecrets: none\n---\npacking: bogus\nsecrets: none\n", "document 2"},
+		{"username: ann@example.com\nsecrets: none\n---\n: [\n", "document 2"},
+		{"nosuchkey: x\n---\nusername: ann@example.com\n", "document 1"},
+		{"# Nothing here.\n---\n", "no config documents"},
+	}
+	for _, test := range tests {
+		_, err := ParseAll(strings.NewReader(test.stream))
+		if err == nil {
+			t.Errorf("ParseAll(%q) succeeded", test.stream)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("ParseAll(%q) error = %q, want mention of %q", test.stream, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+const profilesTemplate = `
+username: ann@example.com
+dirserver: dir.example.com
+secrets: SECRETS
+profiles:
+  work:
+    username: ann@work.example.com
+  test:
+    secrets: none
+    packing: plain
+  empty:
+`
+
+func TestProfiles(t *testing.T) {
+	profilesConfig := strings.Replace(profilesTemplate, "SECRETS", secretsDir, 1)
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(file, []byte(profilesConfig), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := FromFileWithProfile(file, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.UserName() != "ann@example.com" || root.Factotum() == nil {
+		t.Errorf("root: user %q, factotum %v", root.UserName(), root.Factotum())
+	}
+
+	// A profile overrides only the keys it sets.
+	work, err := FromFileWithProfile(file, "work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if work.UserName() != "ann@work.example.com" {
+		t.Errorf("work: user %q, want ann@work.example.com", work.UserName())
+	}
+	if work.DirEndpoint() != root.DirEndpoint() || work.Factotum() == nil {
+		t.Errorf("work: dirserver %v, factotum %v", work.DirEndpoint(), work.Factotum())
+	}
+
+	// A profile may set secrets to none.
+	test, err := FromFileWithProfile(file, "test")
+	if err != ErrNoFactotum {
+		t.Fatalf("test: err = %v, want %v", err, ErrNoFactotum)
+	}
+	if test.Factotum() != nil || test.Packing() != upspin.PlainPack {
+		t.Errorf("test: factotum %v, packing %v", test.Factotum(), test.Packing())
+	}
+
+	_, err = FromFileWithProfile(file, "missing")
+	if !errors.Match(errors.E(errors.NotExist), err) {
+		t.Errorf("missing: err = %v, want NotExist error", err)
+	}
+
+	cfgs, err := ParseProfiles(strings.NewReader(profilesConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfgs) != 3 {
+		t.Fatalf("ParseProfiles returned %d profiles, want 3", len(cfgs))
+	}
+	if !Equal(cfgs["work"], work) || !Equal(cfgs["test"], test) || !Equal(cfgs["empty"], root) {
+		t.Errorf("ParseProfiles returned different configs than FromFileWithProfile")
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !windows
+
+package config
+
+import "os"
+
+// rename renames oldpath to newpath, replacing newpath if it exists.
+// On POSIX systems the replacement is atomic.
+func rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
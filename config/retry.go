@@ -0,0 +1,167 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// RetryPolicy describes how requests to a server are retried
+// when they fail because the server cannot be reached.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of times a request is attempted,
+	// including the first. A value of 1 or less means no retries.
+	MaxAttempts int
+
+	// InitialBackoff is the time to wait before the first retry.
+	// The wait doubles after each subsequent attempt.
+	InitialBackoff time.Duration
+
+	// MaxBackoff bounds the time to wait between attempts.
+	// If zero, the wait is not bounded.
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy is the policy for a server for which the config
+// specifies none: each request is attempted once, with no retries.
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 1}
+
+// retrySuffix is appended to the name of a server key (keyserver,
+// dirserver, storeserver, or cache) to form the key holding the retry
+// policy for that server.
+const retrySuffix = "_retry"
+
+// retryKeys lists the known keys that hold retry policies.
+var retryKeys = []string{
+	keyserver + retrySuffix,
+	dirserver + retrySuffix,
+	storeserver + retrySuffix,
+	cache + retrySuffix,
+}
+
+// Names of the fields of a retry policy in a config file.
+const (
+	maxAttempts    = "max_attempts"
+	initialBackoff = "initial_backoff"
+	maxBackoff     = "max_backoff"
+)
+
+// String returns the policy in the form stored as the value of a retry
+// key and accepted by parseRetryPolicy, such as
+//	max_attempts=3,initial_backoff=1s,max_backoff=30s
+func (p RetryPolicy) String() string {
+	return fmt.Sprintf("%s=%d,%s=%v,%s=%v", maxAttempts, p.MaxAttempts, initialBackoff, p.InitialBackoff, maxBackoff, p.MaxBackoff)
+}
+
+// validate reports whether the policy's values are usable.
+func (p RetryPolicy) validate() error {
+	switch {
+	case p.MaxAttempts < 1:
+		return errors.Errorf("%s must be at least 1", maxAttempts)
+	case p.InitialBackoff < 0:
+		return errors.Errorf("%s must not be negative", initialBackoff)
+	case p.MaxBackoff < 0:
+		return errors.Errorf("%s must not be negative", maxBackoff)
+	case p.MaxBackoff != 0 && p.MaxBackoff < p.InitialBackoff:
+		return errors.Errorf("%s must not be less than %s", maxBackoff, initialBackoff)
+	}
+	return nil
+}
+
+// setField sets the named field of the policy from its textual value.
+func (p *RetryPolicy) setField(name, value string) error {
+	var err error
+	switch name {
+	case maxAttempts:
+		p.MaxAttempts, err = strconv.Atoi(value)
+	case initialBackoff:
+		p.InitialBackoff, err = time.ParseDuration(value)
+	case maxBackoff:
+		p.MaxBackoff, err = time.ParseDuration(value)
+	default:
+		return errors.Errorf("unrecognized field %q", name)
+	}
+	if err != nil {
+		return errors.Errorf("%s: invalid value %q", name, value)
+	}
+	return nil
+}
+
+// parseRetryPolicy parses a policy in the form returned by
+// RetryPolicy.String. Missing fields take their values from
+// DefaultRetryPolicy.
+func parseRetryPolicy(s string) (RetryPolicy, error) {
+	p := DefaultRetryPolicy
+	for _, field := range strings.Split(s, ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			return p, errors.Errorf("malformed field %q", field)
+		}
+		if err := p.setField(kv[0], kv[1]); err != nil {
+			return p, err
+		}
+	}
+	return p, p.validate()
+}
+
+// asRetryPolicy converts the YAML value of a retry key, a map such as
+//	{max_attempts: 3, initial_backoff: 1s, max_backoff: 30s}
+// into the form accepted by parseRetryPolicy. A string value is taken
+// to be in that form already.
+func asRetryPolicy(v interface{}) (string, error) {
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	m, ok := v.(map[interface{}]interface{})
+	if !ok {
+		return "", errors.E(errors.Invalid, errors.Errorf("unrecognized retry policy %v", v))
+	}
+	p := DefaultRetryPolicy
+	for k, v := range m {
+		name, err := asString(k)
+		if err != nil {
+			return "", err
+		}
+		value, err := asString(v)
+		if err != nil {
+			return "", errors.E(errors.Invalid, errors.Errorf("%s: %v", name, err))
+		}
+		if err := p.setField(name, value); err != nil {
+			return "", errors.E(errors.Invalid, err)
+		}
+	}
+	return p.String(), nil
+}
+
+// SetRetryPolicy returns a config derived from the given config
+// with the retry policy for the named server, which is one of
+// "keyserver", "dirserver", "storeserver", or "cache", set to p.
+func SetRetryPolicy(cfg upspin.Config, server string, p RetryPolicy) upspin.Config {
+	checkFrozen(cfg, "SetRetryPolicy")
+	return SetValue(cfg, server+retrySuffix, p.String())
+}
+
+// GetRetryPolicy returns the retry policy for the named server, which is
+// one of "keyserver", "dirserver", "storeserver", or "cache", as given by
+// the config key formed by appending "_retry" to the name. If the key is
+// not set or its value is not a valid policy, GetRetryPolicy returns
+// DefaultRetryPolicy.
+func GetRetryPolicy(cfg upspin.Config, server string) RetryPolicy {
+	v := cfg.Value(server + retrySuffix)
+	if v == "" {
+		return DefaultRetryPolicy
+	}
+	p, err := parseRetryPolicy(v)
+	if err != nil {
+		return DefaultRetryPolicy
+	}
+	return p
+}
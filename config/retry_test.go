@@ -0,0 +1,74 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	// By default, there are no retries.
+	cfg := New()
+	for _, server := range []string{"keyserver", "dirserver", "storeserver", "cache"} {
+		if got := GetRetryPolicy(cfg, server); got != DefaultRetryPolicy {
+			t.Errorf("GetRetryPolicy(%q) = %v, want %v", server, got, DefaultRetryPolicy)
+		}
+	}
+	if DefaultRetryPolicy.MaxAttempts != 1 {
+		t.Errorf("DefaultRetryPolicy.MaxAttempts = %d, want 1", DefaultRetryPolicy.MaxAttempts)
+	}
+
+	// A policy set for one server does not affect the others.
+	p := RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond, MaxBackoff: 10 * time.Second}
+	cfg = SetRetryPolicy(cfg, "storeserver", p)
+	if got := GetRetryPolicy(cfg, "storeserver"); got != p {
+		t.Errorf("GetRetryPolicy(storeserver) = %v, want %v", got, p)
+	}
+	if got := GetRetryPolicy(cfg, "dirserver"); got != DefaultRetryPolicy {
+		t.Errorf("GetRetryPolicy(dirserver) = %v, want %v", got, DefaultRetryPolicy)
+	}
+}
+
+func TestRetryPolicyFromFile(t *testing.T) {
+	base := "secrets: " + secretsDir + "\n"
+	cfg, err := InitConfig(strings.NewReader(base + `
+dirserver_retry: {max_attempts: 3, initial_backoff: 1s, max_backoff: 30s}
+storeserver_retry:
+  max_attempts: 2
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		server string
+		want   RetryPolicy
+	}{
+		{"dirserver", RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: 30 * time.Second}},
+		{"storeserver", RetryPolicy{MaxAttempts: 2}},
+		{"keyserver", DefaultRetryPolicy},
+		{"cache", DefaultRetryPolicy},
+	}
+	for _, test := range tests {
+		if got := GetRetryPolicy(cfg, test.server); got != test.want {
+			t.Errorf("GetRetryPolicy(%q) = %v, want %v", test.server, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{
+		"{max_attempts: 0}",
+		"{max_attempts: many}",
+		"{initial_backoff: -1s}",
+		"{initial_backoff: 1m, max_backoff: 1s}",
+		"{retries: 3}",
+		"[3, 1s, 30s]",
+	} {
+		_, err := InitConfig(strings.NewReader(base + "dirserver_retry: " + bad + "\n"))
+		if err == nil || !strings.Contains(err.Error(), "dirserver_retry") {
+			t.Errorf("dirserver_retry %s: got error %v", bad, err)
+		}
+	}
+}
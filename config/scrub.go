@@ -0,0 +1,125 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"crypto/elliptic"
+	"fmt"
+	"math/big"
+	"net/url"
+	"sort"
+	"strings"
+
+	"upspin.io/upspin"
+)
+
+// redacted replaces the values hidden by Scrub.
+const redacted = "<redacted>"
+
+// scrubbedConfig is a config returned by Scrub.
+type scrubbedConfig struct {
+	upspin.Config
+}
+
+// Scrub returns a config with the same values as cfg that is safe to
+// log. Its Factotum, if cfg has one, reports the same public keys, but
+// its private key operations, such as Sign, panic. Its secrets value
+// is "<redacted>", as is the password of any proxy URL. Its String
+// method formats the values returned by ToMap, in sorted order, so
+// the result may be printed directly.
+func Scrub(cfg upspin.Config) upspin.Config {
+	if _, ok := cfg.(scrubbedConfig); ok {
+		return cfg
+	}
+	return scrubbedConfig{Config: cfg}
+}
+
+func (cfg scrubbedConfig) Factotum() upspin.Factotum {
+	f := cfg.Config.Factotum()
+	if f == nil {
+		return nil
+	}
+	return scrubbedFactotum{f: f}
+}
+
+func (cfg scrubbedConfig) Value(key string) string {
+	v := cfg.Config.Value(key)
+	switch key {
+	case secrets:
+		return redacted
+	case proxy:
+		return scrubURL(v)
+	}
+	return v
+}
+
+func (cfg scrubbedConfig) String() string {
+	m := ToMap(cfg)
+	m[secrets] = redacted
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var fields []string
+	for _, k := range keys {
+		fields = append(fields, fmt.Sprintf("%s=%q", k, m[k]))
+	}
+	return strings.Join(fields, " ")
+}
+
+// scrubURL returns the URL with any password replaced by "<redacted>".
+func scrubURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	if _, ok := u.User.Password(); !ok {
+		return s
+	}
+	u.User = url.UserPassword(u.User.Username(), redacted)
+	return u.String()
+}
+
+// scrubbedFactotum is the Factotum of a scrubbed config. It provides the
+// public operations of the underlying Factotum and panics on the others.
+type scrubbedFactotum struct {
+	f upspin.Factotum
+}
+
+func scrubbedPanic(method string) {
+	panic(fmt.Sprintf("config: Factotum.%s called on a scrubbed config", method))
+}
+
+func (s scrubbedFactotum) DirEntryHash(n, l upspin.PathName, a upspin.Attribute, p upspin.Packing, t upspin.Time, dkey, hash []byte) upspin.DEHash {
+	return s.f.DirEntryHash(n, l, a, p, t, dkey, hash)
+}
+
+func (s scrubbedFactotum) FileSign(hash upspin.DEHash) (upspin.Signature, error) {
+	scrubbedPanic("FileSign")
+	return upspin.Signature{}, nil
+}
+
+func (s scrubbedFactotum) ScalarMult(keyHash []byte, c elliptic.Curve, x, y *big.Int) (sx, sy *big.Int, err error) {
+	scrubbedPanic("ScalarMult")
+	return nil, nil, nil
+}
+
+func (s scrubbedFactotum) Sign(hash []byte) (upspin.Signature, error) {
+	scrubbedPanic("Sign")
+	return upspin.Signature{}, nil
+}
+
+func (s scrubbedFactotum) Pop() upspin.Factotum {
+	return scrubbedFactotum{f: s.f.Pop()}
+}
+
+func (s scrubbedFactotum) PublicKey() upspin.PublicKey {
+	return s.f.PublicKey()
+}
+
+func (s scrubbedFactotum) PublicKeyFromHash(keyHash []byte) (upspin.PublicKey, error) {
+	return s.f.PublicKeyFromHash(keyHash)
+}
@@ -0,0 +1,276 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"crypto/x509"
+	"encoding"
+	"encoding/json"
+	"time"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"upspin.io/errors"
+	"upspin.io/pack"
+	"upspin.io/upspin"
+)
+
+// Snapshot is a config that holds all its values directly,
+// rather than deriving them from another config. It is created
+// by NewSnapshot or Clone and never modified.
+//
+// A Snapshot can be encoded as YAML, through its MarshalText method,
+// or as JSON, and decoded again, so that a config can be stored or
+// sent to another process. The Factotum is never encoded; a decoded
+// Snapshot has none until one is attached with WithFactotum. The
+// certificate pool is encoded as the directory from which it was
+// loaded and is reloaded from there when decoded, so a pool installed
+// by SetCertPool is lost. The time at which the config was loaded,
+// as reported by LoadedAt, is not encoded either.
+//
+// The zero Snapshot has no values set and no Factotum.
+type Snapshot struct {
+	userName       upspin.UserName
+	factotum       upspin.Factotum
+	secrets        string // Directory the factotum was loaded from, if known.
+	packing        upspin.Packing
+	keyEndpoint    upspin.Endpoint
+	dirEndpoint    upspin.Endpoint
+	storeEndpoint  upspin.Endpoint
+	storeEndpoints []upspin.Endpoint // Set only if there is more than one.
+	cacheEndpoint  upspin.Endpoint
+	certPool       *x509.CertPool
+	tlsCerts       string // Directory the cert pool was loaded from, if known.
+	flags          map[string]map[string]string
+	values         map[string]string
+	loaded         time.Time // Time the config was loaded, as reported by LoadedAt.
+}
+
+var (
+	_ upspin.Config            = Snapshot{}
+	_ encoding.TextMarshaler   = Snapshot{}
+	_ encoding.TextUnmarshaler = (*Snapshot)(nil)
+	_ json.Marshaler           = Snapshot{}
+	_ json.Unmarshaler         = (*Snapshot)(nil)
+)
+
+func (s Snapshot) UserName() upspin.UserName      { return s.userName }
+func (s Snapshot) Factotum() upspin.Factotum      { return s.factotum }
+func (s Snapshot) Packing() upspin.Packing        { return s.packing }
+func (s Snapshot) KeyEndpoint() upspin.Endpoint   { return s.keyEndpoint }
+func (s Snapshot) DirEndpoint() upspin.Endpoint   { return s.dirEndpoint }
+func (s Snapshot) StoreEndpoint() upspin.Endpoint { return s.storeEndpoint }
+func (s Snapshot) CacheEndpoint() upspin.Endpoint { return s.cacheEndpoint }
+func (s Snapshot) CertPool() *x509.CertPool       { return s.certPool }
+func (s Snapshot) Value(key string) string        { return s.values[key] }
+
+func (s Snapshot) Flags(cmd string) map[string]string {
+	// Return a copy so the snapshot cannot be modified through it.
+	return copyFlags(s.flags[cmd])
+}
+
+// NewSnapshot returns a Snapshot holding the values of the config.
+// Command flags and the values of keys set by SetValue are copied;
+// the Factotum and certificate pool, which are never modified, are
+// shared with the original.
+func NewSnapshot(cfg upspin.Config) Snapshot {
+	cfg = unfreeze(cfg)
+	if s, ok := cfg.(Snapshot); ok {
+		return s
+	}
+	s := Snapshot{
+		userName:      cfg.UserName(),
+		factotum:      cfg.Factotum(),
+		packing:       cfg.Packing(),
+		keyEndpoint:   cfg.KeyEndpoint(),
+		dirEndpoint:   cfg.DirEndpoint(),
+		storeEndpoint: cfg.StoreEndpoint(),
+		cacheEndpoint: cfg.CacheEndpoint(),
+		certPool:      cfg.CertPool(),
+		tlsCerts:      TLSCerts(cfg),
+		values:        make(map[string]string),
+		loaded:        LoadedAt(cfg),
+	}
+	if s.factotum != nil {
+		s.secrets = factotumDir(cfg)
+	}
+	if eps := StoreEndpoints(cfg); len(eps) > 1 {
+		s.storeEndpoints = eps
+	}
+	if flags := allFlags(cfg); flags != nil {
+		s.flags = make(map[string]map[string]string)
+		for cmd, f := range flags {
+			s.flags[cmd] = copyFlags(f)
+		}
+	}
+	for _, k := range Keys(cfg) {
+		s.values[k] = cfg.Value(k)
+	}
+	return s
+}
+
+// WithFactotum returns a copy of the Snapshot with the given Factotum,
+// which may be nil to remove it.
+func (s Snapshot) WithFactotum(f upspin.Factotum) Snapshot {
+	s.factotum = f
+	s.secrets = ""
+	return s
+}
+
+// snapshotData is the encoded form of a Snapshot.
+// Endpoints are held in their string form; unassigned ones are empty.
+type snapshotData struct {
+	UserName     string                       `json:"username" yaml:"username"`
+	Packing      string                       `json:"packing" yaml:"packing"`
+	KeyServer    string                       `json:"keyserver,omitempty" yaml:"keyserver,omitempty"`
+	DirServer    string                       `json:"dirserver,omitempty" yaml:"dirserver,omitempty"`
+	StoreServer  string                       `json:"storeserver,omitempty" yaml:"storeserver,omitempty"`
+	StoreServers []string                     `json:"storeservers,omitempty" yaml:"storeservers,omitempty"`
+	Cache        string                       `json:"cache,omitempty" yaml:"cache,omitempty"`
+	TLSCerts     string                       `json:"tlscerts,omitempty" yaml:"tlscerts,omitempty"`
+	CmdFlags     map[string]map[string]string `json:"cmdflags,omitempty" yaml:"cmdflags,omitempty"`
+	Values       map[string]string            `json:"values,omitempty" yaml:"values,omitempty"`
+}
+
+// MarshalText implements encoding.TextMarshaler.
+// The Snapshot is encoded as YAML.
+func (s Snapshot) MarshalText() ([]byte, error) {
+	const op = "config.Snapshot.MarshalText"
+	d, err := s.data()
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	data, err := yaml.Marshal(d)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	return data, nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+// It decodes YAML produced by MarshalText.
+func (s *Snapshot) UnmarshalText(data []byte) error {
+	const op = "config.Snapshot.UnmarshalText"
+	var d snapshotData
+	if err := yaml.Unmarshal(data, &d); err != nil {
+		return errors.E(op, errors.Invalid, err)
+	}
+	if err := s.setData(&d); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler.
+func (s Snapshot) MarshalJSON() ([]byte, error) {
+	const op = "config.Snapshot.MarshalJSON"
+	d, err := s.data()
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	return data, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (s *Snapshot) UnmarshalJSON(data []byte) error {
+	const op = "config.Snapshot.UnmarshalJSON"
+	var d snapshotData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return errors.E(op, errors.Invalid, err)
+	}
+	if err := s.setData(&d); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// data returns the encoded form of the Snapshot.
+func (s Snapshot) data() (*snapshotData, error) {
+	if pack.Lookup(s.packing) == nil {
+		return nil, errors.E(errors.Invalid, errors.Errorf("unknown packing %v", s.packing))
+	}
+	d := &snapshotData{
+		UserName: string(s.userName),
+		Packing:  s.packing.String(),
+		TLSCerts: s.tlsCerts,
+		CmdFlags: s.flags,
+	}
+	endpoints := []struct {
+		text *string
+		ep   upspin.Endpoint
+	}{
+		{&d.KeyServer, s.keyEndpoint},
+		{&d.DirServer, s.dirEndpoint},
+		{&d.StoreServer, s.storeEndpoint},
+		{&d.Cache, s.cacheEndpoint},
+	}
+	for _, e := range endpoints {
+		if e.ep.Transport != upspin.Unassigned {
+			*e.text = e.ep.String()
+		}
+	}
+	for _, e := range s.storeEndpoints {
+		d.StoreServers = append(d.StoreServers, e.String())
+	}
+	if len(s.values) > 0 {
+		d.Values = s.values
+	}
+	return d, nil
+}
+
+// setData sets the contents of the Snapshot from its encoded form.
+// The Snapshot has no Factotum.
+func (s *Snapshot) setData(d *snapshotData) error {
+	packer := pack.LookupByName(d.Packing)
+	if packer == nil {
+		return errors.E(errors.Invalid, errors.Errorf("unknown packing %q", d.Packing))
+	}
+	n := Snapshot{
+		userName: upspin.UserName(d.UserName),
+		packing:  packer.Packing(),
+		tlsCerts: d.TLSCerts,
+		flags:    d.CmdFlags,
+		values:   d.Values,
+	}
+	endpoints := []struct {
+		text string
+		ep   *upspin.Endpoint
+	}{
+		{d.KeyServer, &n.keyEndpoint},
+		{d.DirServer, &n.dirEndpoint},
+		{d.StoreServer, &n.storeEndpoint},
+		{d.Cache, &n.cacheEndpoint},
+	}
+	for _, e := range endpoints {
+		if e.text == "" {
+			continue
+		}
+		ep, err := upspin.ParseEndpoint(e.text)
+		if err != nil {
+			return errors.E(errors.Invalid, err)
+		}
+		*e.ep = *ep
+	}
+	for _, text := range d.StoreServers {
+		ep, err := upspin.ParseEndpoint(text)
+		if err != nil {
+			return errors.E(errors.Invalid, err)
+		}
+		n.storeEndpoints = append(n.storeEndpoints, *ep)
+	}
+	if n.tlsCerts != "" {
+		pool, err := certPoolFromDir(n.tlsCerts)
+		if err != nil {
+			return errors.E(errors.IO, err)
+		}
+		n.certPool = pool
+	}
+	*s = n
+	return nil
+}
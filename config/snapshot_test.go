@@ -0,0 +1,92 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotEncoding(t *testing.T) {
+	certsDir, err := filepath.Abs("../rpc/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := InitConfig(strings.NewReader(`
+username: ann@example.com
+packing: plain
+keyserver: inprocess
+dirserver: dir.example.com
+storeservers: [store1.example.com, "store2.example.com:8080"]
+cache: remote,cache.example.com:5580
+dirserver_timeout: 1m
+tlscerts: ` + certsDir + `
+secrets: ` + secretsDir + `
+cmdflags:
+ upspinfs:
+  cachedir: /tmp
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig = SetValue(orig, "extra", "1")
+	snap := NewSnapshot(orig)
+
+	codecs := []struct {
+		name      string
+		marshal   func(Snapshot) ([]byte, error)
+		unmarshal func([]byte, *Snapshot) error
+	}{
+		{"YAML", Snapshot.MarshalText, func(b []byte, s *Snapshot) error { return s.UnmarshalText(b) }},
+		{"JSON", func(s Snapshot) ([]byte, error) { return json.Marshal(s) }, func(b []byte, s *Snapshot) error { return json.Unmarshal(b, s) }},
+	}
+	for _, c := range codecs {
+		data, err := c.marshal(snap)
+		if err != nil {
+			t.Fatalf("%s: marshal: %v", c.name, err)
+		}
+		if strings.Contains(string(data), "PRIVATE") {
+			t.Errorf("%s: encoding contains private key:\n%s", c.name, data)
+		}
+		var got Snapshot
+		if err := c.unmarshal(data, &got); err != nil {
+			t.Fatalf("%s: unmarshal %s: %v", c.name, data, err)
+		}
+		if got.Factotum() != nil {
+			t.Errorf("%s: decoded snapshot has a Factotum", c.name)
+		}
+		if diff := Diff(snap.WithFactotum(nil), got); diff != nil {
+			t.Errorf("%s: decoded snapshot differs:\n%s", c.name, strings.Join(diff, "\n"))
+		}
+		if g, w := StoreEndpoints(got), StoreEndpoints(orig); !reflect.DeepEqual(g, w) {
+			t.Errorf("%s: StoreEndpoints = %v, want %v", c.name, g, w)
+		}
+		if g, w := TLSCerts(got), certsDir; g != w {
+			t.Errorf("%s: TLSCerts = %q, want %q", c.name, g, w)
+		}
+		if got.CertPool() == nil {
+			t.Errorf("%s: CertPool is nil", c.name)
+		}
+		withF := got.WithFactotum(orig.Factotum())
+		if !Equal(withF, orig) {
+			t.Errorf("%s: WithFactotum: differences: %q", c.name, Diff(withF, orig))
+		}
+		if withF.Factotum() != orig.Factotum() {
+			t.Errorf("%s: WithFactotum did not attach the Factotum", c.name)
+		}
+	}
+
+	// Bad data is rejected.
+	var s Snapshot
+	if err := s.UnmarshalText([]byte("username: ann@example.com\npacking: nonesuch\n")); err == nil {
+		t.Errorf("UnmarshalText accepted unknown packing")
+	}
+	if err := json.Unmarshal([]byte(`{"packing": "plain", "dirserver": "bogus,x"}`), &s); err == nil {
+		t.Errorf("UnmarshalJSON accepted bad endpoint")
+	}
+}
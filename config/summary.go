@@ -0,0 +1,38 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"upspin.io/upspin"
+)
+
+// Summary returns a one-line description of the config, suitable for
+// log messages, such as
+//	ann@example.com [ee] store=remote,store.example.com:443 dir=remote,dir.example.com:443 key=remote,key.upspin.io:443 factotum=yes
+// An unassigned endpoint is shown as "(unset)". If the config has more
+// than one store endpoint, each is shown in its own store= field.
+func Summary(cfg upspin.Config) string {
+	m := ToMap(cfg)
+	unset := upspin.Endpoint{}.String()
+	endpoint := func(key string) string {
+		if v := m[key]; v != "" && v != unset {
+			return v
+		}
+		return "(unset)"
+	}
+	store := endpoint(storeserver)
+	if v := m[storeservers]; v != "" {
+		store = strings.Replace(v, " ", " store=", -1)
+	}
+	factotum := "no"
+	if m["factotum"] == "present" {
+		factotum = "yes"
+	}
+	return fmt.Sprintf("%s [%s] store=%s dir=%s key=%s factotum=%s",
+		m[username], m[packing], store, endpoint(dirserver), endpoint(keyserver), factotum)
+}
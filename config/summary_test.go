@@ -0,0 +1,46 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"upspin.io/upspin"
+)
+
+func TestSummary(t *testing.T) {
+	full, err := InitConfig(strings.NewReader(`
+username: ann@example.com
+packing: ee
+keyserver: remote,key.upspin.io
+dirserver: remote,dir.example.com
+storeservers:
+ - remote,store1.example.com
+ - remote,store2.example.com
+secrets: ` + secretsDir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	minimal := SetKeyEndpoint(New(), upspin.Endpoint{})
+
+	tests := []struct {
+		name string
+		cfg  upspin.Config
+		want string
+	}{
+		{"full", full, "ann@example.com [ee] store=remote,store1.example.com:443 store=remote,store2.example.com:443 dir=remote,dir.example.com:443 key=remote,key.upspin.io:443 factotum=yes"},
+		{"minimal", minimal, "noone@nowhere.org [ee] store=(unset) dir=(unset) key=(unset) factotum=no"},
+	}
+	for _, test := range tests {
+		got := Summary(test.cfg)
+		if got == "" || strings.Contains(got, "\n") {
+			t.Errorf("%s: Summary = %q, want a single non-empty line", test.name, got)
+		}
+		if got != test.want {
+			t.Errorf("%s: Summary = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
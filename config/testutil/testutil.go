@@ -0,0 +1,67 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package testutil provides a way to build configs in tests
+// without config files or key directories on disk.
+package testutil // import "upspin.io/config/testutil"
+
+import (
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"upspin.io/config"
+	"upspin.io/errors"
+	"upspin.io/factotum"
+	"upspin.io/upspin"
+)
+
+// The key pair installed in the Factotum of configs built by NewTestConfig.
+// It must never be used for anything but tests.
+const (
+	publicKey  = "p256\n86754568856409436056886548963722747418663925733852968840719951502625645703023\n55374006944977701639377273685946154797448684848748065688191847332792959379206\n"
+	privateKey = "33732563467898584041325590158539299810645722675081856412396066039103123277092\n"
+)
+
+// NewTestConfig returns a config built from vals, whose keys and values
+// are those of a config file, as read by config.InitConfig. Values that
+// are lists, such as storeservers, are separated by spaces; retry
+// policies use the form accepted in the environment, such as
+// "max_attempts=3,initial_backoff=1s". As with config.InitConfig,
+// unset values take their defaults and UPSPIN_ environment variables
+// override the values given.
+//
+// Unless vals sets secrets, the config's Factotum holds a fixed test key
+// pair and nothing is read from disk. If secrets is "none" the config has
+// no Factotum; any other value is a directory from which keys are read.
+func NewTestConfig(vals map[string]string) (upspin.Config, error) {
+	const op = "config/testutil.NewTestConfig"
+	m := make(map[string]string, len(vals)+1)
+	for k, v := range vals {
+		m[strings.ToLower(k)] = v
+	}
+	_, haveSecrets := m["secrets"]
+	if !haveSecrets {
+		m["secrets"] = "none"
+	}
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	cfg, err := config.InitConfig(strings.NewReader(string(data)))
+	if err == config.ErrNoFactotum && m["secrets"] == "none" {
+		err = nil
+	}
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	if haveSecrets {
+		return cfg, nil
+	}
+	f, err := factotum.NewFromKeys([]byte(publicKey), []byte(privateKey), nil)
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	return config.SetFactotum(cfg, f), nil
+}
@@ -0,0 +1,69 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testutil
+
+import (
+	"testing"
+
+	"upspin.io/config"
+	"upspin.io/upspin"
+
+	_ "upspin.io/pack/plain"
+)
+
+func TestNewTestConfig(t *testing.T) {
+	cfg, err := NewTestConfig(map[string]string{
+		"username":          "ann@example.com",
+		"packing":           "plain",
+		"dirserver":         "remote,dir.example.com",
+		"storeservers":      "remote,a.example.com:443 remote,b.example.com:443",
+		"dirserver_timeout": "30s",
+		"storeserver_retry": "max_attempts=3,initial_backoff=1s",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.UserName(), upspin.UserName("ann@example.com"); got != want {
+		t.Errorf("UserName() = %q, want %q", got, want)
+	}
+	if got, want := cfg.Packing(), upspin.PlainPack; got != want {
+		t.Errorf("Packing() = %v, want %v", got, want)
+	}
+	if got, want := cfg.DirEndpoint().String(), "remote,dir.example.com:443"; got != want {
+		t.Errorf("DirEndpoint() = %q, want %q", got, want)
+	}
+	if got, want := len(config.StoreEndpoints(cfg)), 2; got != want {
+		t.Errorf("len(StoreEndpoints()) = %d, want %d", got, want)
+	}
+	if got, want := cfg.Value("dirserver_timeout"), "30s"; got != want {
+		t.Errorf("Value(dirserver_timeout) = %q, want %q", got, want)
+	}
+	if got, want := config.GetRetryPolicy(cfg, "storeserver").MaxAttempts, 3; got != want {
+		t.Errorf("MaxAttempts = %d, want %d", got, want)
+	}
+	f := cfg.Factotum()
+	if f == nil {
+		t.Fatal("Factotum() is nil")
+	}
+	if got, want := f.PublicKey(), upspin.PublicKey(publicKey); got != want {
+		t.Errorf("PublicKey() = %q, want %q", got, want)
+	}
+}
+
+func TestNewTestConfigNoSecrets(t *testing.T) {
+	cfg, err := NewTestConfig(map[string]string{"secrets": "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Factotum() != nil {
+		t.Error("Factotum() is non-nil")
+	}
+}
+
+func TestNewTestConfigError(t *testing.T) {
+	if _, err := NewTestConfig(map[string]string{"dirserver": "bogus,x"}); err == nil {
+		t.Error("NewTestConfig with bad endpoint succeeded")
+	}
+}
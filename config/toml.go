@@ -0,0 +1,394 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// InitConfigTOML is like InitConfig but reads a config file in TOML
+// rather than YAML. The keys and their meanings are the same; maps such
+// as cmdflags, profiles, and retry policies are written as tables, for
+// example:
+//	username = "ann@example.com"
+//	dirserver = "remote,dir.example.com:443"
+//	storeserver_retry = {max_attempts = 3, initial_backoff = "1s"}
+//
+//	[cmdflags.cacheserver]
+//	cachedir = "/tmp"
+// The subset of TOML supported covers everything a config file needs:
+// comments, tables, dotted keys, strings, integers, floats, booleans,
+// arrays, and inline tables. Multi-line strings, dates, and arrays of
+// tables are not supported.
+func InitConfigTOML(r io.Reader, opts ...InitOption) (upspin.Config, error) {
+	const op = "config.InitConfigTOML"
+	if r == nil {
+		return nil, errors.E(op, errors.Invalid, errors.Str("nil reader"))
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.E(op, errors.IO, err)
+	}
+	data, err = tomlToYAML(data)
+	if err != nil {
+		return nil, errors.E(op, errors.Invalid, errors.Errorf("parsing TOML file: %v", err))
+	}
+	return initConfig(op, bytes.NewReader(data), "", opts)
+}
+
+// isTOML reports whether the named config file holds TOML,
+// as indicated by its extension.
+func isTOML(name string) bool {
+	return strings.ToLower(filepath.Ext(name)) == ".toml"
+}
+
+// tomlToYAML converts a TOML config file to the equivalent YAML,
+// so that it can be read by the rest of this package.
+func tomlToYAML(data []byte) ([]byte, error) {
+	vals, err := parseTOML(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(vals)
+}
+
+// tomlParser holds the state of the parse of a TOML file.
+type tomlParser struct {
+	text string
+	pos  int
+	line int
+
+	top     map[string]interface{}
+	defined map[string]bool // Tables defined by a header, by dotted name.
+}
+
+// parseTOML parses the TOML text and returns its top-level table.
+// Nested tables are returned as maps with string keys.
+func parseTOML(text string) (map[string]interface{}, error) {
+	p := &tomlParser{
+		text:    text,
+		line:    1,
+		top:     make(map[string]interface{}),
+		defined: make(map[string]bool),
+	}
+	if err := p.parse(); err != nil {
+		return nil, errors.Errorf("line %d: %v", p.line, err)
+	}
+	return p.top, nil
+}
+
+func (p *tomlParser) parse() error {
+	table := p.top
+	for {
+		p.skipBlank(true)
+		if p.eof() {
+			return nil
+		}
+		var err error
+		if p.peek() == '[' {
+			table, err = p.parseHeader()
+		} else {
+			err = p.parseKeyValue(table)
+		}
+		if err != nil {
+			return err
+		}
+		if err := p.endLine(); err != nil {
+			return err
+		}
+	}
+}
+
+// parseHeader parses a table header and returns the table it names.
+func (p *tomlParser) parseHeader() (map[string]interface{}, error) {
+	p.pos++ // '['
+	if p.peek() == '[' {
+		return nil, errors.Str("arrays of tables are not supported")
+	}
+	keys, err := p.parseKey()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek() != ']' {
+		return nil, errors.Str("expected ] after table name")
+	}
+	p.pos++
+	name := strings.Join(keys, ".")
+	if p.defined[name] {
+		return nil, errors.Errorf("table [%s] defined twice", name)
+	}
+	p.defined[name] = true
+	return p.table(p.top, keys)
+}
+
+// parseKeyValue parses a key = value pair into the table.
+func (p *tomlParser) parseKeyValue(table map[string]interface{}) error {
+	keys, err := p.parseKey()
+	if err != nil {
+		return err
+	}
+	if p.peek() != '=' {
+		return errors.Errorf("expected = after key %s", strings.Join(keys, "."))
+	}
+	p.pos++
+	p.skipBlank(false)
+	val, err := p.parseValue()
+	if err != nil {
+		return err
+	}
+	t, err := p.table(table, keys[:len(keys)-1])
+	if err != nil {
+		return err
+	}
+	last := keys[len(keys)-1]
+	if _, ok := t[last]; ok {
+		return errors.Errorf("key %s defined twice", strings.Join(keys, "."))
+	}
+	t[last] = val
+	return nil
+}
+
+// table returns the table reached from t by following the keys,
+// creating tables as needed.
+func (p *tomlParser) table(t map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for _, k := range keys {
+		v, ok := t[k]
+		if !ok {
+			n := make(map[string]interface{})
+			t[k] = n
+			t = n
+			continue
+		}
+		n, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, errors.Errorf("key %s is not a table", k)
+		}
+		t = n
+	}
+	return t, nil
+}
+
+// parseKey parses a possibly dotted key and any blanks after it.
+func (p *tomlParser) parseKey() ([]string, error) {
+	var keys []string
+	for {
+		p.skipBlank(false)
+		var k string
+		switch c := p.peek(); {
+		case c == '"' || c == '\'':
+			s, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			k = s
+		default:
+			start := p.pos
+			for !p.eof() && isBareKeyChar(p.peek()) {
+				p.pos++
+			}
+			if p.pos == start {
+				return nil, errors.Errorf("expected key, found %q", p.rest())
+			}
+			k = p.text[start:p.pos]
+		}
+		keys = append(keys, k)
+		p.skipBlank(false)
+		if p.peek() != '.' {
+			return keys, nil
+		}
+		p.pos++
+	}
+}
+
+func isBareKeyChar(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-'
+}
+
+// parseValue parses a value.
+func (p *tomlParser) parseValue() (interface{}, error) {
+	switch c := p.peek(); c {
+	case '"', '\'':
+		return p.parseString()
+	case '[':
+		return p.parseArray()
+	case '{':
+		return p.parseInlineTable()
+	}
+	start := p.pos
+	for !p.eof() && !strings.ContainsRune(" \t\r\n,]}#", rune(p.peek())) {
+		p.pos++
+	}
+	word := p.text[start:p.pos]
+	switch word {
+	case "":
+		return nil, errors.Str("missing value")
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	num := strings.Replace(word, "_", "", -1)
+	if i, err := strconv.ParseInt(num, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(num, 64); err == nil {
+		return f, nil
+	}
+	return nil, errors.Errorf("unsupported value %q", word)
+}
+
+// parseString parses a basic ("...") or literal ('...') string.
+func (p *tomlParser) parseString() (string, error) {
+	quote := p.peek()
+	if strings.HasPrefix(p.text[p.pos:], strings.Repeat(string(quote), 3)) {
+		return "", errors.Str("multi-line strings are not supported")
+	}
+	start := p.pos
+	p.pos++
+	for {
+		if p.eof() || p.peek() == '\n' {
+			return "", errors.Str("unterminated string")
+		}
+		c := p.peek()
+		p.pos++
+		if c == '\\' && quote == '"' {
+			p.pos++
+			continue
+		}
+		if c == quote {
+			break
+		}
+	}
+	s := p.text[start:p.pos]
+	if quote == '\'' {
+		return s[1 : len(s)-1], nil
+	}
+	u, err := strconv.Unquote(s)
+	if err != nil {
+		return "", errors.Errorf("bad string %s", s)
+	}
+	return u, nil
+}
+
+// parseArray parses an array, which may span lines.
+func (p *tomlParser) parseArray() ([]interface{}, error) {
+	p.pos++ // '['
+	list := []interface{}{}
+	for {
+		p.skipBlank(true)
+		if p.peek() == ']' {
+			p.pos++
+			return list, nil
+		}
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, v)
+		p.skipBlank(true)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case ']':
+		default:
+			return nil, errors.Errorf("expected , or ] in array, found %q", p.rest())
+		}
+	}
+}
+
+// parseInlineTable parses an inline table, which must be on one line.
+func (p *tomlParser) parseInlineTable() (map[string]interface{}, error) {
+	p.pos++ // '{'
+	t := make(map[string]interface{})
+	p.skipBlank(false)
+	if p.peek() == '}' {
+		p.pos++
+		return t, nil
+	}
+	for {
+		if err := p.parseKeyValue(t); err != nil {
+			return nil, err
+		}
+		p.skipBlank(false)
+		switch p.peek() {
+		case ',':
+			p.pos++
+		case '}':
+			p.pos++
+			return t, nil
+		default:
+			return nil, errors.Errorf("expected , or } in inline table, found %q", p.rest())
+		}
+	}
+}
+
+// skipBlank skips spaces and tabs and, if newlines is set,
+// comments and newlines.
+func (p *tomlParser) skipBlank(newlines bool) {
+	for !p.eof() {
+		switch c := p.peek(); {
+		case c == ' ', c == '\t', c == '\r':
+			p.pos++
+		case newlines && c == '\n':
+			p.pos++
+			p.line++
+		case newlines && c == '#':
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+func (p *tomlParser) skipComment() {
+	for !p.eof() && p.peek() != '\n' {
+		p.pos++
+	}
+}
+
+// endLine checks that nothing but a comment follows on the line.
+func (p *tomlParser) endLine() error {
+	p.skipBlank(false)
+	if p.peek() == '#' {
+		p.skipComment()
+	}
+	if p.eof() {
+		return nil
+	}
+	if p.peek() != '\n' {
+		return errors.Errorf("unexpected %q", p.rest())
+	}
+	return nil
+}
+
+func (p *tomlParser) eof() bool {
+	return p.pos >= len(p.text)
+}
+
+func (p *tomlParser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.text[p.pos]
+}
+
+// rest returns the remainder of the current line, for error messages.
+func (p *tomlParser) rest() string {
+	s := p.text[p.pos:]
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
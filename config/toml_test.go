@@ -0,0 +1,155 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const yamlConfig = `
+username: ann@example.com
+packing: plain
+keyserver: inprocess
+dirserver: remote,dir.example.com
+storeservers: [store1.example.com, "store2.example.com:8080"]
+cache: remote,cache.example.com:5580
+dirserver_timeout: 1m30s
+storeserver_retry: {max_attempts: 3, initial_backoff: 1s, max_backoff: 30s}
+cmdflags:
+ cacheserver:
+  cachedir: /tmp
+  cachesize: 1000000000
+ upspinfs:
+  cachedir: /tmp
+`
+
+const tomlConfig = `
+# An Upspin config in TOML.
+username = "ann@example.com"
+packing = 'plain'
+keyserver = "inprocess"
+dirserver = "remote,dir.example.com" # Port 443 is assumed.
+storeservers = [
+	"store1.example.com",
+	"store2.example.com:8080", # Trailing comma.
+]
+cache = "remote,cache.example.com:5580"
+dirserver_timeout = "1m30s"
+storeserver_retry = { max_attempts = 3, initial_backoff = "1s", max_backoff = "30s" }
+cmdflags.upspinfs.cachedir = "/tmp"
+
+[cmdflags.cacheserver]
+cachedir = "/tmp"
+cachesize = 1_000_000_000
+`
+
+func TestInitConfigTOML(t *testing.T) {
+	secrets := "secrets: " + secretsDir + "\n"
+	fromYAML, err := InitConfig(strings.NewReader(secrets + yamlConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromTOML, err := InitConfigTOML(strings.NewReader(`secrets = "` + secretsDir + `"` + tomlConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equal(fromYAML, fromTOML) {
+		t.Errorf("TOML config differs from YAML:\n%s", strings.Join(Diff(fromYAML, fromTOML), "\n"))
+	}
+	if g, w := StoreEndpoints(fromTOML), StoreEndpoints(fromYAML); !reflect.DeepEqual(g, w) {
+		t.Errorf("StoreEndpoints = %v, want %v", g, w)
+	}
+	if fromTOML.Factotum() == nil {
+		t.Errorf("TOML config has no Factotum")
+	}
+}
+
+func TestFromFileTOML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A TOML file including a YAML file.
+	base := filepath.Join(dir, "base")
+	if err := ioutil.WriteFile(base, []byte(yamlConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	name := filepath.Join(dir, "config.toml")
+	data := "include = \"base\"\nsecrets = \"" + secretsDir + "\"\nusername = \"bob@example.com\"\n"
+	if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := FromFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.UserName(), "bob@example.com"; string(got) != want {
+		t.Errorf("UserName() = %q, want %q", got, want)
+	}
+	if got, want := cfg.Value("dirserver_timeout"), "1m30s"; got != want {
+		t.Errorf("Value(dirserver_timeout) = %q, want %q", got, want)
+	}
+
+	// A file with a TOML error reports the line.
+	if err := ioutil.WriteFile(name, []byte("username = \"bob@example.com\"\nsecrets = \n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := FromFile(name); err == nil || !strings.Contains(err.Error(), "line 2") {
+		t.Errorf("FromFile with bad TOML: error %v, want line 2", err)
+	}
+}
+
+func TestParseTOML(t *testing.T) {
+	good := []struct {
+		text string
+		want map[string]interface{}
+	}{
+		{`a = "x\ty"`, map[string]interface{}{"a": "x\ty"}},
+		{`a = 'C:\dir'`, map[string]interface{}{"a": `C:\dir`}},
+		{`"quoted key" = -12`, map[string]interface{}{"quoted key": int64(-12)}},
+		{`a = 1.5`, map[string]interface{}{"a": 1.5}},
+		{`a = [true, false]`, map[string]interface{}{"a": []interface{}{true, false}}},
+		{`a = []`, map[string]interface{}{"a": []interface{}{}}},
+		{"a.b = 1\n[c]\nd = {}", map[string]interface{}{
+			"a": map[string]interface{}{"b": int64(1)},
+			"c": map[string]interface{}{"d": map[string]interface{}{}},
+		}},
+	}
+	for _, test := range good {
+		got, err := parseTOML(test.text)
+		if err != nil {
+			t.Errorf("parseTOML(%q): %v", test.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseTOML(%q) = %v, want %v", test.text, got, test.want)
+		}
+	}
+
+	bad := []string{
+		`a = `,
+		`a = "unterminated`,
+		`a = 1 b = 2`,
+		"a = 1\na = 2",
+		"[t]\n[t]",
+		"a = 1\n[a]",
+		"[[t]]",
+		`a = """multi"""`,
+		`a = 1979-05-27`,
+		`= 1`,
+	}
+	for _, text := range bad {
+		if _, err := parseTOML(text); err == nil {
+			t.Errorf("parseTOML(%q) succeeded, want error", text)
+		}
+	}
+}
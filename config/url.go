@@ -0,0 +1,81 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// urlTimeout bounds the time taken to fetch a config by FromURL.
+// It is a variable so it can be changed in tests.
+var urlTimeout = 10 * time.Second
+
+// isURL reports whether the name is an HTTP or HTTPS URL.
+func isURL(name string) bool {
+	return strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://")
+}
+
+// FromURL initializes a config using the YAML file served at the given
+// HTTP or HTTPS URL. If the bootstrap config is not nil and has a
+// certificate pool, that pool is used to verify the server's certificate.
+// As with InitConfig, environment variables may override the values in
+// the fetched file.
+//
+// The secrets key in the fetched file, if present, names a directory
+// on the local file system; keys are never fetched from the server.
+func FromURL(url string, bootstrap upspin.Config, opts ...InitOption) (upspin.Config, error) {
+	const op = "config.FromURL"
+	if !isURL(url) {
+		return nil, errors.E(op, errors.Invalid, errors.Errorf("not an HTTP or HTTPS URL: %q", url))
+	}
+	client := &http.Client{Timeout: urlTimeout}
+	if bootstrap != nil && bootstrap.CertPool() != nil {
+		client.Transport = urlTransport(bootstrap)
+	}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, errors.E(op, errors.IO, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		kind := errors.IO
+		if resp.StatusCode == http.StatusNotFound {
+			kind = errors.NotExist
+		}
+		return nil, errors.E(op, kind, errors.Errorf("fetching %s: %s", url, resp.Status))
+	}
+	return InitConfig(resp.Body, opts...)
+}
+
+// urlTransport returns a transport that verifies servers using the
+// certificate pool of the bootstrap config. It connects through the
+// proxy given by ProxyURL; otherwise it matches http.DefaultTransport.
+func urlTransport(bootstrap upspin.Config) *http.Transport {
+	proxyFunc := http.ProxyFromEnvironment
+	if bootstrap.Value(proxy) != "" {
+		proxyFunc = http.ProxyURL(ProxyURL(bootstrap))
+	}
+	return &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: bootstrap.CertPool()},
+		Proxy:           proxyFunc,
+		// The following values are the same as
+		// net/http.DefaultTransport.
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
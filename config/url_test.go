@@ -0,0 +1,87 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"upspin.io/errors"
+)
+
+func TestFromURL(t *testing.T) {
+	block := make(chan bool)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/config", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "username: p@google.com\nsecrets: %s\n", secretsDir)
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "broken", http.StatusInternalServerError)
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	defer close(block)
+
+	cfg, err := FromURL(srv.URL+"/config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.UserName(), "p@google.com"; string(got) != want {
+		t.Errorf("UserName() = %q, want %q", got, want)
+	}
+	if cfg, err := FromFile(srv.URL + "/config"); err != nil || cfg.UserName() != "p@google.com" {
+		t.Errorf("FromFile(URL) = %v, %v", cfg, err)
+	}
+
+	_, err = FromURL(srv.URL+"/missing", nil)
+	if !errors.Match(errors.E(errors.NotExist), err) {
+		t.Errorf("FromURL(missing) = %v, want NotExist error", err)
+	}
+	_, err = FromURL(srv.URL+"/broken", nil)
+	if !errors.Match(errors.E(errors.IO), err) {
+		t.Errorf("FromURL(broken) = %v, want IO error", err)
+	}
+
+	defer func(d time.Duration) { urlTimeout = d }(urlTimeout)
+	urlTimeout = 100 * time.Millisecond
+	_, err = FromURL(srv.URL+"/slow", nil)
+	if !errors.Match(errors.E(errors.IO), err) {
+		t.Errorf("FromURL(slow) = %v, want IO error", err)
+	}
+}
+
+func TestURLTransportProxy(t *testing.T) {
+	dir, err := filepath.Abs("../rpc/testdata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := SetTLSCerts(New(), dir)
+	cfg = SetValue(cfg, proxy, "proxy.example.com:3128")
+	tr := urlTransport(cfg)
+	if tr.TLSClientConfig.RootCAs != cfg.CertPool() {
+		t.Errorf("transport does not use the config's certificate pool")
+	}
+	if tr.Proxy == nil {
+		t.Fatal("transport has no proxy function")
+	}
+	req, err := http.NewRequest("GET", "https://config.example.com/config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := tr.Proxy(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u == nil || u.Host != "proxy.example.com:3128" {
+		t.Errorf("proxy = %v, want http://proxy.example.com:3128", u)
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"upspin.io/errors"
+	"upspin.io/pack"
+	"upspin.io/upspin"
+	"upspin.io/user"
+)
+
+// Validate checks that the config is well formed, without contacting
+// any servers. It checks that the user name is valid, that each assigned
+// endpoint has a known transport and, if remote, a network address, that
+// the packing is registered, and that the Factotum, if any, has a public
+// key. The returned error, of kind errors.Invalid, lists every problem found.
+func Validate(cfg upspin.Config) error {
+	const op = "config.Validate"
+	var problems []string
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if _, _, _, err := user.Parse(cfg.UserName()); err != nil {
+		report("user name %q: %v", cfg.UserName(), err)
+	}
+
+	endpoints := []struct {
+		key string
+		ep  upspin.Endpoint
+	}{
+		{keyserver, cfg.KeyEndpoint()},
+		{dirserver, cfg.DirEndpoint()},
+		{storeserver, cfg.StoreEndpoint()},
+		{cache, cfg.CacheEndpoint()},
+	}
+	for _, e := range endpoints {
+		switch e.ep.Transport {
+		case upspin.Unassigned, upspin.InProcess:
+		case upspin.Remote:
+			if e.ep.NetAddr == "" {
+				report("%s: remote endpoint has no network address", e.key)
+			}
+		default:
+			report("%s: unknown transport %v", e.key, e.ep.Transport)
+		}
+	}
+
+	if pack.Lookup(cfg.Packing()) == nil {
+		report("unknown packing %v", cfg.Packing())
+	}
+
+	if f := cfg.Factotum(); f != nil && f.PublicKey() == "" {
+		report("factotum has no public key")
+	}
+
+	if len(problems) == 0 {
+		return nil
+	}
+	return errors.E(op, errors.Invalid, errors.Str(strings.Join(problems, "; ")))
+}
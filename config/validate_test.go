@@ -0,0 +1,37 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+func TestValidate(t *testing.T) {
+	cfg, err := InitConfig(strings.NewReader("username: p@google.com\nsecrets: " + secretsDir + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Validate(cfg); err != nil {
+		t.Fatalf("Validate(good config): %v", err)
+	}
+
+	cfg = SetUserName(cfg, "not a user")
+	cfg = SetDirEndpoint(cfg, upspin.Endpoint{Transport: upspin.Remote})
+	cfg = SetStoreEndpoint(cfg, upspin.Endpoint{Transport: upspin.Transport(99), NetAddr: "store.example.com:443"})
+	cfg = SetPacking(cfg, upspin.Packing(99))
+	err = Validate(cfg)
+	if !errors.Match(errors.E(errors.Invalid), err) {
+		t.Fatalf("Validate(bad config) = %v, want Invalid error", err)
+	}
+	for _, want := range []string{"user name", dirserver, storeserver, "packing"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate(bad config) = %q, want mention of %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"context"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// VerifyKeyRegistration looks up the config's user on the given key
+// server, typically that of the config's key endpoint as returned by
+// bind.KeyServer, and reports whether the public key recorded there is
+// that of the config's Factotum. A mismatch, which typically follows
+// generating new keys without registering them, otherwise surfaces as
+// a permission error on the first request to a directory server.
+// Because it makes a network call, VerifyKeyRegistration is not called
+// by InitConfig.
+//
+// The context limits how long it waits for the key server. If the
+// context is done first, VerifyKeyRegistration returns at once, but
+// the lookup, which cannot be canceled, continues in a goroutine until
+// the key server responds or the connection to it fails.
+func VerifyKeyRegistration(ctx context.Context, cfg upspin.Config, key upspin.KeyServer) error {
+	const op = "config.VerifyKeyRegistration"
+	name := cfg.UserName()
+	f := cfg.Factotum()
+	if f == nil {
+		return errors.E(op, errors.Invalid, name, errors.Str("config has no Factotum"))
+	}
+
+	type result struct {
+		u   *upspin.User
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		u, err := key.Lookup(name)
+		done <- result{u, err}
+	}()
+	var r result
+	select {
+	case r = <-done:
+	case <-ctx.Done():
+		return errors.E(op, errors.IO, name, ctx.Err())
+	}
+	if r.err != nil {
+		return errors.E(op, name, r.err)
+	}
+	if r.u.PublicKey != f.PublicKey() {
+		return errors.E(op, errors.Invalid, name, errors.Str("local public key does not match key server record; run 'upspin rotate' to update"))
+	}
+	return nil
+}
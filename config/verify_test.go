@@ -0,0 +1,93 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"upspin.io/errors"
+	"upspin.io/factotum"
+	"upspin.io/upspin"
+)
+
+// testKeyServer is a KeyServer that holds a fixed set of users.
+// If block is not nil, Lookup waits until it is closed.
+type testKeyServer struct {
+	users map[upspin.UserName]*upspin.User
+	block chan struct{}
+}
+
+var _ upspin.KeyServer = (*testKeyServer)(nil)
+
+func (k *testKeyServer) Lookup(name upspin.UserName) (*upspin.User, error) {
+	if k.block != nil {
+		<-k.block
+	}
+	u, ok := k.users[name]
+	if !ok {
+		return nil, errors.E(errors.NotExist, name)
+	}
+	return u, nil
+}
+
+func (k *testKeyServer) Put(u *upspin.User) error                                    { return errors.Str("unimplemented") }
+func (k *testKeyServer) Dial(upspin.Config, upspin.Endpoint) (upspin.Service, error) { return k, nil }
+func (k *testKeyServer) Endpoint() upspin.Endpoint {
+	return upspin.Endpoint{Transport: upspin.InProcess}
+}
+func (k *testKeyServer) Ping() bool { return true }
+func (k *testKeyServer) Close()     {}
+
+func TestVerifyKeyRegistration(t *testing.T) {
+	f, err := factotum.NewFromDir(secretsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := factotum.NewFromDir(strings.Replace(secretsDir, "user1", "bob", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := &testKeyServer{
+		users: map[upspin.UserName]*upspin.User{
+			"ann@example.com": {Name: "ann@example.com", PublicKey: f.PublicKey()},
+		},
+	}
+	base := SetKeyEndpoint(New(), upspin.Endpoint{Transport: upspin.InProcess})
+	ctx := context.Background()
+
+	tests := []struct {
+		user    upspin.UserName
+		f       upspin.Factotum
+		wantErr string
+	}{
+		{"ann@example.com", f, ""},
+		{"ann@example.com", other, "does not match key server record"},
+		{"bob@example.com", f, "does not exist"},
+		{"ann@example.com", nil, "no Factotum"},
+	}
+	for _, test := range tests {
+		cfg := SetFactotum(SetUserName(base, test.user), test.f)
+		err := VerifyKeyRegistration(ctx, cfg, key)
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error: %v", test.user, err)
+		case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+			t.Errorf("%s: err = %v, want %q", test.user, err, test.wantErr)
+		}
+	}
+
+	// The context bounds the wait for the key server.
+	key.block = make(chan struct{})
+	defer close(key.block)
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	err = VerifyKeyRegistration(ctx, SetFactotum(SetUserName(base, "ann@example.com"), f), key)
+	if !errors.Match(errors.E(errors.IO), err) {
+		t.Errorf("blocked key server: err = %v, want I/O error", err)
+	}
+}
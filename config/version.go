@@ -0,0 +1,102 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"sync"
+
+	"upspin.io/errors"
+)
+
+// CurrentVersion is the version of the config file format written by
+// MarshalConfig. A file with no version key has version 0.
+const CurrentVersion = 1
+
+// versionKey is the key holding the version of the file format.
+const versionKey = "version"
+
+// migrations holds the functions registered by RegisterMigration,
+// keyed by the version they migrate from.
+var migrations struct {
+	sync.Mutex
+	fn map[int]func(map[string]string) error
+}
+
+// RegisterMigration registers fn to convert the keys and values of a config
+// file from version fromVersion of the format to version fromVersion+1.
+// When a file of an older version is loaded, the migrations for each step
+// up to CurrentVersion are applied in turn, before the keys are checked.
+// The map passed to fn holds the keys at the top level of the file, or of a
+// profile, that have single values, such as strings or numbers; fn may
+// rename, change, add, or delete entries. Registering nil removes the
+// migration for fromVersion.
+func RegisterMigration(fromVersion int, fn func(map[string]string) error) {
+	migrations.Lock()
+	defer migrations.Unlock()
+	if migrations.fn == nil {
+		migrations.fn = make(map[int]func(map[string]string) error)
+	}
+	if fn == nil {
+		delete(migrations.fn, fromVersion)
+		return
+	}
+	migrations.fn[fromVersion] = fn
+}
+
+// fileVersion returns the version given by the version key in
+// the parsed YAML, removing the key. If there is none, it is 0.
+func fileVersion(newVals map[string]interface{}) (int, error) {
+	v, ok := newVals[versionKey]
+	if !ok {
+		return 0, nil
+	}
+	delete(newVals, versionKey)
+	version, ok := v.(int)
+	if !ok || version < 0 {
+		return 0, errors.E(errors.Invalid, errors.Errorf("invalid config version %v", v))
+	}
+	if version > CurrentVersion {
+		return 0, errors.E(errors.Invalid, errors.Errorf("config version %d is newer than supported version %d", version, CurrentVersion))
+	}
+	return version, nil
+}
+
+// migrate applies the registered migrations from the given version
+// to CurrentVersion to the parsed YAML.
+func migrate(newVals map[string]interface{}, version int) error {
+	if newVals == nil {
+		// A profile with no overrides.
+		return nil
+	}
+	for ; version < CurrentVersion; version++ {
+		migrations.Lock()
+		fn := migrations.fn[version]
+		migrations.Unlock()
+		if fn == nil {
+			continue
+		}
+		vals := make(map[string]string)
+		for k, v := range newVals {
+			if s, err := asString(v); err == nil {
+				vals[k] = s
+			}
+		}
+		if err := fn(vals); err != nil {
+			return errors.E(errors.Invalid, errors.Errorf("migrating config from version %d: %v", version, err))
+		}
+		for k, v := range newVals {
+			if _, err := asString(v); err != nil {
+				continue // Not passed to the migration.
+			}
+			if _, ok := vals[k]; !ok {
+				delete(newVals, k)
+			}
+		}
+		for k, s := range vals {
+			newVals[k] = s
+		}
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+func TestMigration(t *testing.T) {
+	// Version 0 called the directory server "directory"
+	// and had a "verbose" key that is no longer used.
+	RegisterMigration(0, func(vals map[string]string) error {
+		if v, ok := vals["directory"]; ok {
+			vals[dirserver] = v
+			delete(vals, "directory")
+		}
+		if v := vals["verbose"]; v != "" && v != "true" && v != "false" {
+			return errors.Errorf("bad verbose value %q", v)
+		}
+		delete(vals, "verbose")
+		return nil
+	})
+	defer RegisterMigration(0, nil)
+
+	base := "secrets: none\n"
+	want := upspin.Endpoint{Transport: upspin.Remote, NetAddr: "dir.example.com:443"}
+	for _, config := range []string{
+		"directory: dir.example.com\nverbose: true\n",
+		"version: 0\ndirectory: dir.example.com\n",
+		"version: 1\ndirserver: dir.example.com\n",
+		"dirserver: dir.example.com\n",
+		// Profiles are migrated too.
+		"profiles:\n  p:\n    directory: dir.example.com\n",
+	} {
+		var opts []InitOption
+		if strings.Contains(config, "profiles") {
+			opts = append(opts, WithProfile("p"))
+		}
+		cfg, err := InitConfig(strings.NewReader(base+config), opts...)
+		if err != ErrNoFactotum {
+			t.Errorf("%q: %v", config, err)
+			continue
+		}
+		if got := cfg.DirEndpoint(); got != want {
+			t.Errorf("%q: DirEndpoint = %v, want %v", config, got, want)
+		}
+	}
+
+	for _, test := range []struct {
+		config, err string
+	}{
+		// The migration is not applied to a current file.
+		{"version: 1\ndirectory: dir.example.com\n", `unrecognized key "directory"`},
+		{"version: 2\n", "newer than supported version 1"},
+		{"version: one\n", "invalid config version"},
+		{"verbose: loud\n", "migrating config from version 0"},
+	} {
+		_, err := InitConfig(strings.NewReader(base + test.config))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%q: got error %v, want %q", test.config, err, test.err)
+		}
+	}
+
+	// Without the migration, the old key is unknown.
+	RegisterMigration(0, nil)
+	_, err := InitConfig(strings.NewReader(base + "directory: dir.example.com\n"))
+	if err == nil || !strings.Contains(err.Error(), `unrecognized key "directory"`) {
+		t.Errorf("no migration: got error %v", err)
+	}
+}
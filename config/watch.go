@@ -0,0 +1,122 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// watchInterval is how often Watch checks the config file for changes.
+// It is a variable so it can be changed in tests.
+var watchInterval = 5 * time.Second
+
+// Watch monitors the named config file, and any files it includes, and
+// whenever their contents change calls onChange with the config loaded
+// by FromFile. If the files cannot be read or parsed, onChange is called
+// with the error instead, so the caller may decide whether to keep using
+// its previous config.
+//
+// The file is checked for changes periodically. The onChange function is
+// called on a goroutine dedicated to that purpose; if it is still running
+// when further changes occur, it is later called just once, for the most
+// recent one. Closing the returned Closer stops the watch.
+func Watch(name string, onChange func(upspin.Config, error)) (io.Closer, error) {
+	const op = "config.Watch"
+	data, err := readConfigFile(name, make(map[string]bool))
+	if err != nil {
+		return nil, errors.E(op, err)
+	}
+	w := &watcher{
+		name:    name,
+		data:    data,
+		pending: make(chan watchEvent, 1),
+		done:    make(chan struct{}),
+	}
+	go w.poll()
+	go w.notify(onChange)
+	return w, nil
+}
+
+type watcher struct {
+	name    string
+	data    []byte // Contents of the file, with includes expanded, when last read.
+	readErr string // Error from the last failed read, if any.
+
+	pending chan watchEvent
+	done    chan struct{}
+	once    sync.Once
+}
+
+type watchEvent struct {
+	cfg upspin.Config
+	err error
+}
+
+// Close implements io.Closer.
+func (w *watcher) Close() error {
+	w.once.Do(func() { close(w.done) })
+	return nil
+}
+
+// poll checks the file for changes until the watcher is closed.
+func (w *watcher) poll() {
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+		data, err := readConfigFile(w.name, make(map[string]bool))
+		if err != nil {
+			// Report a failure to read the files only once.
+			if err.Error() != w.readErr {
+				w.readErr = err.Error()
+				w.data = nil
+				w.post(watchEvent{err: errors.E("config.Watch", err)})
+			}
+			continue
+		}
+		w.readErr = ""
+		if bytes.Equal(data, w.data) {
+			continue
+		}
+		w.data = data
+		cfg, err := FromFile(w.name)
+		w.post(watchEvent{cfg: cfg, err: err})
+	}
+}
+
+// post queues the event for delivery, replacing any event
+// that has not yet been delivered.
+func (w *watcher) post(e watchEvent) {
+	for {
+		select {
+		case w.pending <- e:
+			return
+		case <-w.pending:
+			// Discard the stale event.
+		}
+	}
+}
+
+// notify delivers events to onChange until the watcher is closed.
+func (w *watcher) notify(onChange func(upspin.Config, error)) {
+	for {
+		select {
+		case <-w.done:
+			return
+		case e := <-w.pending:
+			onChange(e.cfg, e.err)
+		}
+	}
+}
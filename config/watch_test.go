@@ -0,0 +1,105 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"upspin.io/upspin"
+)
+
+func TestWatch(t *testing.T) {
+	defer func(d time.Duration) { watchInterval = d }(watchInterval)
+	watchInterval = 10 * time.Millisecond
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config")
+	base := filepath.Join(dir, "base")
+	writeFile := func(file, data string) {
+		// Write and rename, so the watcher never sees a partial file.
+		tmp := file + ".tmp"
+		if err := ioutil.WriteFile(tmp, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, file); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(user string) {
+		writeFile(file, "include: base\nusername: "+user+"\n")
+	}
+	writeFile(base, "secrets: "+secretsDir+"\npacking: plain\n")
+	write("ann@example.com")
+
+	type event struct {
+		cfg upspin.Config
+		err error
+	}
+	events := make(chan event, 10)
+	w, err := Watch(file, func(cfg upspin.Config, err error) {
+		events <- event{cfg, err}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	next := func() event {
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for change")
+		}
+		panic("not reached")
+	}
+
+	before := time.Now()
+	write("bob@example.com")
+	e := next()
+	if e.err != nil {
+		t.Fatal(e.err)
+	}
+	if got, want := e.cfg.UserName(), upspin.UserName("bob@example.com"); got != want {
+		t.Errorf("UserName() = %q, want %q", got, want)
+	}
+	if got := LoadedAt(e.cfg); got.Before(before) {
+		t.Errorf("LoadedAt() = %v, before the change at %v", got, before)
+	}
+
+	if err := os.Remove(file); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(); e.err == nil {
+		t.Errorf("removed file: got no error")
+	}
+
+	write("carl@example.com")
+	e = next()
+	if e.err != nil {
+		t.Fatal(e.err)
+	}
+	if got, want := e.cfg.UserName(), upspin.UserName("carl@example.com"); got != want {
+		t.Errorf("UserName() = %q, want %q", got, want)
+	}
+
+	// A change to the included file is noticed too.
+	writeFile(base, "secrets: "+secretsDir+"\npacking: ee\n")
+	e = next()
+	if e.err != nil {
+		t.Fatal(e.err)
+	}
+	if got, want := e.cfg.Packing(), upspin.EEPack; got != want {
+		t.Errorf("Packing() = %v, want %v", got, want)
+	}
+}
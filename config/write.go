@@ -0,0 +1,75 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// WriteFile writes the config, as formatted by MarshalConfig, to the
+// named file. The file is replaced atomically: the data is written and
+// flushed to a temporary file in the same directory, which is then
+// renamed over the original, so a crash never leaves a partly written
+// config. The file keeps its permissions; a new file has mode 0600.
+// If path is a symbolic link, the file it refers to is replaced,
+// and the link is kept.
+func WriteFile(path string, cfg upspin.Config) error {
+	const op = "config.WriteFile"
+	data, err := MarshalConfig(cfg)
+	if err != nil {
+		return errors.E(op, err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return errors.E(op, err)
+	}
+	return nil
+}
+
+// renameFile renames a file, replacing any existing file with the new
+// name. It is a variable so tests can observe it.
+var renameFile = rename
+
+// writeFileAtomic writes data to the named file as described by WriteFile.
+func writeFileAtomic(path string, data []byte) error {
+	// Replace the target of a symbolic link, not the link itself.
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	} else if !os.IsNotExist(err) {
+		return errors.E(errors.IO, err)
+	}
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return errors.E(errors.IO, err)
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = renameFile(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.E(errors.IO, err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	// The temporary directory may itself be reached through a link.
+	if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "config")
+
+	cfg := SetUserName(New(), "ann@example.com")
+	cfg = SetDirEndpoint(cfg, upspin.Endpoint{Transport: upspin.Remote, NetAddr: "dir.example.com:443"})
+	want, err := MarshalConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that the rename is the last operation, so that a crash
+	// before it leaves the old file, and a crash after it the new one.
+	renames := 0
+	renameFile = func(oldpath, newpath string) error {
+		renames++
+		if filepath.Dir(oldpath) != dir || newpath != path {
+			t.Errorf("rename(%q, %q): want temporary file in %q renamed to %q", oldpath, newpath, dir, path)
+		}
+		data, err := ioutil.ReadFile(oldpath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, want) {
+			t.Errorf("temporary file holds %q before rename, want %q", data, want)
+		}
+		return rename(oldpath, newpath)
+	}
+	defer func() { renameFile = rename }()
+
+	// A new file has mode 0600.
+	if err := WriteFile(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkWritten(t, path, want, 0600)
+
+	// An existing file keeps its mode.
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+	cfg = SetUserName(cfg, "bob@example.com")
+	if want, err = MarshalConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkWritten(t, path, want, 0640)
+	if renames != 2 {
+		t.Errorf("%d renames, want 2", renames)
+	}
+
+	// A crash before the rename leaves the old file as it was.
+	old := want
+	renameFile = func(oldpath, newpath string) error {
+		return errors.Str("crash")
+	}
+	if err := WriteFile(path, SetUserName(cfg, "carla@example.com")); err == nil {
+		t.Fatal("WriteFile succeeded despite failed rename")
+	}
+	checkWritten(t, path, old, 0640)
+	renameFile = rename
+
+	// A symbolic link is kept, and the file it refers to,
+	// in another directory, is replaced.
+	if runtime.GOOS == "windows" {
+		return // Creating symbolic links needs privileges.
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(path, link); err != nil {
+		t.Fatal(err)
+	}
+	otherDir := filepath.Join(dir, "other")
+	if err := os.Mkdir(otherDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	otherLink := filepath.Join(otherDir, "config")
+	if err := os.Symlink(link, otherLink); err != nil {
+		t.Fatal(err)
+	}
+	cfg = SetUserName(cfg, "dan@example.com")
+	if want, err = MarshalConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(otherLink, cfg); err != nil {
+		t.Fatal(err)
+	}
+	checkWritten(t, path, want, 0640)
+	for _, l := range []string{link, otherLink} {
+		if fi, err := os.Lstat(l); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			t.Errorf("%s is no longer a symbolic link: %v", l, err)
+		}
+	}
+	checkWritten(t, otherLink, want, 0640)
+}
+
+// checkWritten checks that path holds data and has the given mode,
+// and that no temporary files remain beside it.
+func checkWritten(t *testing.T, path string, data []byte, mode os.FileMode) {
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("file holds %q, want %q", got, data)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Windows does not have Unix permission bits.
+	if m := info.Mode().Perm(); m != mode && runtime.GOOS != "windows" {
+		t.Errorf("file mode is %v, want %v", m, mode)
+	}
+	fis, err := ioutil.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range fis {
+		if strings.Contains(fi.Name(), ".tmp") {
+			t.Errorf("temporary file %q left behind", fi.Name())
+		}
+	}
+}
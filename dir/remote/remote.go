@@ -186,7 +186,7 @@ func dialCache(op *operation, config upspin.Config, proxyFor upspin.Endpoint) up
 	}
 
 	// Call the cache. The cache is local so don't bother with TLS.
-	authClient, err := rpc.NewClient(config, ce.NetAddr, rpc.NoSecurity, proxyFor)
+	authClient, err := rpc.NewServerClient(config, "cache", ce.NetAddr, rpc.NoSecurity, proxyFor)
 	if err != nil {
 		// On error dial direct.
 		op.error(errors.IO, err)
@@ -215,7 +215,7 @@ func (r *remote) Dial(config upspin.Config, e upspin.Endpoint) (upspin.Service,
 		return svc, nil
 	}
 
-	authClient, err := rpc.NewClient(config, e.NetAddr, rpc.Secure, upspin.Endpoint{})
+	authClient, err := rpc.NewServerClient(config, "dirserver", e.NetAddr, rpc.Secure, upspin.Endpoint{})
 	if err != nil {
 		return nil, op.error(errors.IO, err)
 	}
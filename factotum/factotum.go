@@ -11,11 +11,15 @@ import (
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
 	"io/ioutil"
 	"math/big"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"upspin.io/errors"
@@ -35,6 +39,7 @@ type factotum struct {
 	current  keyHashArray
 	previous keyHashArray
 	keys     map[keyHashArray]factotumKey
+	order    []keyHashArray // All keys, newest first.
 }
 
 var _ upspin.Factotum = factotum{}
@@ -85,6 +90,35 @@ func NewFromKeys(public, private, archived []byte) (upspin.Factotum, error) {
 	return newFactotum(op, public, private, archived)
 }
 
+// NewFromPEM returns a new Factotum holding the ECDSA private key
+// in the given PEM data, which must contain an "EC PRIVATE KEY" block
+// for one of the curves supported by Upspin.
+func NewFromPEM(pemData []byte) (upspin.Factotum, error) {
+	const op = "factotum.NewFromPEM"
+	block, _ := pem.Decode(pemData)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		return nil, errors.E(op, errors.Invalid, errors.Str("no EC PRIVATE KEY block in PEM data"))
+	}
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, errors.E(op, errors.Invalid, err)
+	}
+	var keyType string
+	switch key.Curve {
+	case elliptic.P256():
+		keyType = "p256"
+	case elliptic.P384():
+		keyType = "p384"
+	case elliptic.P521():
+		keyType = "p521"
+	default:
+		return nil, errors.E(op, errors.Invalid, errors.Errorf("unsupported curve %s", key.Curve.Params().Name))
+	}
+	public := fmt.Sprintf("%s\n%s\n%s\n", keyType, key.X, key.Y)
+	private := fmt.Sprintf("%s\n", key.D)
+	return newFactotum(op, []byte(public), []byte(private), nil)
+}
+
 // newFactotum creates a new Factotum using the given keys.
 func newFactotum(op string, public, private, archived []byte) (upspin.Factotum, error) {
 	pfk, err := makeKey(upspin.PublicKey(public), string(private))
@@ -99,6 +133,7 @@ func newFactotum(op string, public, private, archived []byte) (upspin.Factotum,
 		current:  h,
 		previous: h,
 		keys:     fm,
+		order:    []keyHashArray{h},
 	}
 
 	// Current file format is "# EE date" concatenated with old public.upspinkey
@@ -134,11 +169,89 @@ func newFactotum(op string, public, private, archived []byte) (upspin.Factotum,
 			continue
 		}
 		f.keys[h] = *pfk
+		f.order = append(f.order, h)
 		f.previous = h
 	}
 	return f, nil
 }
 
+// NewFromDirWithRotation returns a new Factotum holding every version of
+// the user's key pair found in the directory, to support key rotation.
+// The original version is stored in the files public.upspinkey and
+// secret.upspinkey, and version N in public.upspinkey.N and
+// secret.upspinkey.N, for N > 0. Not all versions need be present.
+// The newest version, the one with the highest number, is used to sign;
+// the previous one is used by Pop. Data signed or packed with any of the
+// versions may still be verified or unpacked, so a new key can be added
+// here and registered with the key server before the old one is retired.
+func NewFromDirWithRotation(dir string) (upspin.Factotum, error) {
+	const op = "factotum.NewFromDirWithRotation"
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, errors.E(op, errors.IO, err)
+	}
+	var versions []int
+	for _, fi := range fis {
+		if v, ok := keyVersion(fi.Name()); ok {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, errors.E(op, errors.NotExist, errors.Errorf("no public.upspinkey files in %q", dir))
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+
+	f := &factotum{keys: make(map[keyHashArray]factotumKey)}
+	for _, v := range versions {
+		suffix := ""
+		if v > 0 {
+			suffix = "." + strconv.Itoa(v)
+		}
+		pubBytes, err := readFile(op, dir, "public.upspinkey"+suffix)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		privBytes, err := readFile(op, dir, "secret.upspinkey"+suffix)
+		if err != nil {
+			return nil, errors.E(op, err)
+		}
+		pfk, err := makeKey(upspin.PublicKey(stripCR(pubBytes)), string(stripCR(privBytes)))
+		if err != nil {
+			return nil, errors.E(op, errors.Errorf("key version %d: %v", v, err))
+		}
+		var h keyHashArray
+		copy(h[:], pfk.keyHash)
+		if _, ok := f.keys[h]; ok { // Duplicate.
+			continue
+		}
+		f.keys[h] = *pfk
+		f.order = append(f.order, h)
+	}
+	f.current = f.order[0]
+	f.previous = f.order[0]
+	if len(f.order) > 1 {
+		f.previous = f.order[1]
+	}
+	return f, nil
+}
+
+// keyVersion reports whether the file name is that of a public key
+// for NewFromDirWithRotation and, if so, the version of the key.
+func keyVersion(name string) (int, bool) {
+	const prefix = "public.upspinkey"
+	if name == prefix {
+		return 0, true
+	}
+	if !strings.HasPrefix(name, prefix+".") {
+		return 0, false
+	}
+	v, err := strconv.Atoi(name[len(prefix)+1:])
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return v, true
+}
+
 // stripCR removes \r.
 func stripCR(b []byte) []byte {
 	return bytes.Replace(b, []byte("\r"), []byte(""), -1)
@@ -281,7 +394,49 @@ func Verify(hash []byte, sig upspin.Signature, key upspin.PublicKey) error {
 func (f factotum) Pop() upspin.Factotum {
 	// Arbitrarily keep f.previous unchanged, so Pop() is idempotent.
 	// We don't yet have any need to go further back in time.
-	return &factotum{current: f.previous, previous: f.previous, keys: f.keys}
+	return &factotum{current: f.previous, previous: f.previous, keys: f.keys, order: f.order}
+}
+
+// Keys returns all the public keys held by the factotum, newest first.
+func (f factotum) Keys() []upspin.PublicKey {
+	keys := make([]upspin.PublicKey, len(f.order))
+	for i, h := range f.order {
+		keys[i] = f.keys[h].public
+	}
+	return keys
+}
+
+// Verify verifies whether the given hash's signature was signed by the
+// private key corresponding to any of the public keys held by the factotum.
+func (f factotum) Verify(hash []byte, sig upspin.Signature) error {
+	for _, h := range f.order {
+		fk := f.keys[h]
+		if ecdsa.Verify(&fk.ecdsaKeyPair.PublicKey, hash, sig.R, sig.S) {
+			return nil
+		}
+	}
+	return errors.E(errors.Invalid, errors.Str("signature does not match any key"))
+}
+
+// VerifyKeyHash is like Verify but checks the signature only against the
+// key whose hash, as computed by KeyHash, is keyHash. Finding that key is
+// a map lookup, so unlike Verify its cost does not grow with the number of
+// old keys held. If the factotum holds no such key, the error is NotExist.
+func (f factotum) VerifyKeyHash(keyHash, hash []byte, sig upspin.Signature) error {
+	const op = "factotum.VerifyKeyHash"
+	var h keyHashArray
+	if len(keyHash) != len(h) {
+		return errors.E(op, errors.Invalid, errors.Errorf("invalid keyHash"))
+	}
+	copy(h[:], keyHash)
+	fk, ok := f.keys[h]
+	if !ok {
+		return errors.E(op, errors.NotExist, errors.Errorf("no such key %x", keyHash))
+	}
+	if !ecdsa.Verify(&fk.ecdsaKeyPair.PublicKey, hash, sig.R, sig.S) {
+		return errors.E(op, errors.Invalid, errors.Str("signature does not match"))
+	}
+	return nil
 }
 
 // PublicKey returns the user's latest public key.
@@ -5,9 +5,21 @@
 package factotum
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 
+	"upspin.io/errors"
 	"upspin.io/upspin"
 )
 
@@ -101,3 +113,274 @@ func TestSign(t *testing.T) {
 		t.Errorf("factotum.Sing(longstring) should have failed")
 	}
 }
+
+func TestNewFromPEM(t *testing.T) {
+	const (
+		pubKey = "p256\n86754568856409436056886548963722747418663925733852968840719951502625645703023\n55374006944977701639377273685946154797448684848748065688191847332792959379206\n"
+		secKey = "33732563467898584041325590158539299810645722675081856412396066039103123277092"
+	)
+	fromDir, err := NewFromDir(filepath.Join("testdata", "ok"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pub, err := ParsePublicKey(pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var d big.Int
+	if _, ok := d.SetString(secKey, 10); !ok {
+		t.Fatal("bad secret key")
+	}
+	der, err := x509.MarshalECPrivateKey(&ecdsa.PrivateKey{PublicKey: *pub, D: &d})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromPEM, err := NewFromPEM(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromPEM.PublicKey() != fromDir.PublicKey() {
+		t.Errorf("PublicKey() = %q, want %q", fromPEM.PublicKey(), fromDir.PublicKey())
+	}
+	hash := sha256.Sum256([]byte("hello"))
+	sig, err := fromPEM.Sign(hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(hash[:], sig, fromDir.PublicKey()); err != nil {
+		t.Errorf("signature from PEM key does not verify with directory key: %v", err)
+	}
+
+	if _, err := NewFromPEM([]byte("not PEM")); err == nil {
+		t.Errorf("NewFromPEM(not PEM): got no error")
+	}
+}
+
+func TestNewFromDirWithRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "factotum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	copyKey := func(from, suffix string) {
+		for _, name := range []string{"public.upspinkey", "secret.upspinkey"} {
+			data, err := ioutil.ReadFile(filepath.Join("testdata", from, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, name+suffix), data, 0600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Sign with the original key.
+	copyKey("ok", "")
+	old, err := NewFromDirWithRotation(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte("signed before rotation"))
+	oldSig, err := old.Sign(hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Add a new key version; it becomes the signing key.
+	copyKey("ok-archived", ".1")
+	f, err := NewFromDirWithRotation(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := NewFromDir(filepath.Join("testdata", "ok-archived"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.PublicKey() != newKey.PublicKey() {
+		t.Errorf("PublicKey() = %q, want %q", f.PublicKey(), newKey.PublicKey())
+	}
+	if f.Pop().PublicKey() != old.PublicKey() {
+		t.Errorf("Pop().PublicKey() = %q, want %q", f.Pop().PublicKey(), old.PublicKey())
+	}
+	rf := f.(interface {
+		Keys() []upspin.PublicKey
+		Verify([]byte, upspin.Signature) error
+	})
+	keys := rf.Keys()
+	if len(keys) != 2 || keys[0] != newKey.PublicKey() || keys[1] != old.PublicKey() {
+		t.Errorf("Keys() = %q, want new key then old key", keys)
+	}
+
+	// Data signed with the old key still verifies.
+	if err := rf.Verify(hash[:], oldSig); err != nil {
+		t.Errorf("Verify(old signature): %v", err)
+	}
+	sig, err := f.Sign(hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(hash[:], sig, newKey.PublicKey()); err != nil {
+		t.Errorf("signature not made with newest key: %v", err)
+	}
+	other := sha256.Sum256([]byte("something else"))
+	if err := rf.Verify(other[:], sig); err == nil {
+		t.Errorf("Verify(wrong hash): got no error")
+	}
+}
+
+func TestNewFromKeychain(t *testing.T) {
+	defer RegisterKeychainProvider(nil)
+	want, err := NewFromDir(filepath.Join("testdata", "ok"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var asked upspin.UserName
+	RegisterKeychainProvider(func(user upspin.UserName) (upspin.Factotum, error) {
+		asked = user
+		if user != "user1@google.com" {
+			return nil, errors.E(errors.NotExist, user)
+		}
+		return want, nil
+	})
+	f, err := NewFromKeychain("user1@google.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if asked != "user1@google.com" {
+		t.Errorf("provider asked for %q, want user1@google.com", asked)
+	}
+	if f.PublicKey() != want.PublicKey() {
+		t.Errorf("PublicKey = %q, want %q", f.PublicKey(), want.PublicKey())
+	}
+	_, err = NewFromKeychain("nobody@example.com")
+	if !errors.Match(errors.E(errors.NotExist, upspin.UserName("nobody@example.com")), err) {
+		t.Errorf("unknown user: got error %v, want NotExist", err)
+	}
+
+	// Without a provider, there is no keychain on other systems.
+	RegisterKeychainProvider(nil)
+	if runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+		_, err := NewFromKeychain("user1@google.com")
+		if !errors.Match(errors.E(errors.NotExist), err) {
+			t.Errorf("no provider: got error %v, want NotExist", err)
+		}
+	}
+}
+
+// newRotated returns a factotum holding n freshly generated keys,
+// as if the keys had been rotated n-1 times.
+func newRotated(tb testing.TB, n int) *factotum {
+	f := &factotum{keys: make(map[keyHashArray]factotumKey)}
+	for i := 0; i < n; i++ {
+		priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		pub := upspin.PublicKey(fmt.Sprintf("p256\n%s\n%s\n", priv.X, priv.Y))
+		fk, err := makeKey(pub, priv.D.String())
+		if err != nil {
+			tb.Fatal(err)
+		}
+		var h keyHashArray
+		copy(h[:], fk.keyHash)
+		f.keys[h] = *fk
+		f.order = append(f.order, h)
+	}
+	f.current = f.order[0]
+	f.previous = f.order[0]
+	return f
+}
+
+// sign signs hash with the key of f with the given hash.
+func sign(tb testing.TB, f *factotum, h keyHashArray, hash []byte) upspin.Signature {
+	g := *f
+	g.current = h
+	sig, err := g.Sign(hash)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return sig
+}
+
+func TestVerifyKeyHash(t *testing.T) {
+	f := newRotated(t, 4)
+	hash := sha256.Sum256([]byte("some data"))
+	other := sha256.Sum256([]byte("other data"))
+	for i, h := range f.order {
+		sig := sign(t, f, h, hash[:])
+		// Both paths accept the signature for the right data...
+		brute := f.Verify(hash[:], sig)
+		fast := f.VerifyKeyHash(h[:], hash[:], sig)
+		if brute != nil || fast != nil {
+			t.Errorf("key %d: Verify = %v, VerifyKeyHash = %v; want nil, nil", i, brute, fast)
+		}
+		// ...and reject it for other data.
+		brute = f.Verify(other[:], sig)
+		fast = f.VerifyKeyHash(h[:], other[:], sig)
+		if !errors.Match(errors.E(errors.Invalid), brute) || !errors.Match(errors.E(errors.Invalid), fast) {
+			t.Errorf("key %d: Verify = %v, VerifyKeyHash = %v; want Invalid errors", i, brute, fast)
+		}
+	}
+
+	// The signature of one key does not verify with another's hash.
+	sig := sign(t, f, f.order[0], hash[:])
+	if err := f.VerifyKeyHash(f.order[1][:], hash[:], sig); !errors.Match(errors.E(errors.Invalid), err) {
+		t.Errorf("VerifyKeyHash with wrong key: %v, want Invalid error", err)
+	}
+	// An unknown key.
+	unknown := newRotated(t, 1).order[0]
+	if err := f.VerifyKeyHash(unknown[:], hash[:], sig); !errors.Match(errors.E(errors.NotExist), err) {
+		t.Errorf("VerifyKeyHash with unknown key: %v, want NotExist error", err)
+	}
+	if err := f.VerifyKeyHash(nil, hash[:], sig); !errors.Match(errors.E(errors.Invalid), err) {
+		t.Errorf("VerifyKeyHash with nil keyHash: %v, want Invalid error", err)
+	}
+}
+
+func BenchmarkSign(b *testing.B) {
+	f := newRotated(b, 1)
+	hash := sha256.Sum256([]byte("some data"))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := f.Sign(hash[:]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// The Verify benchmarks verify a signature made with the oldest of
+// several keys, the worst case for Verify.
+
+func BenchmarkVerify(b *testing.B) {
+	for _, n := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("keys=%d", n), func(b *testing.B) {
+			f := newRotated(b, n)
+			hash := sha256.Sum256([]byte("some data"))
+			sig := sign(b, f, f.order[n-1], hash[:])
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := f.Verify(hash[:], sig); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkVerifyKeyHash(b *testing.B) {
+	for _, n := range []int{1, 4, 16} {
+		b.Run(fmt.Sprintf("keys=%d", n), func(b *testing.B) {
+			f := newRotated(b, n)
+			hash := sha256.Sum256([]byte("some data"))
+			h := f.order[n-1]
+			sig := sign(b, f, h, hash[:])
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := f.VerifyKeyHash(h[:], hash[:], sig); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package factotum
+
+import (
+	"encoding/base64"
+	"strings"
+	"sync"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// keychain holds the provider registered by RegisterKeychainProvider.
+var keychain struct {
+	sync.Mutex
+	provider func(upspin.UserName) (upspin.Factotum, error)
+}
+
+// RegisterKeychainProvider installs fn as the means by which NewFromKeychain
+// obtains a Factotum, replacing the operating system's keychain. It allows
+// programs to keep keys in stores this package does not support, such as
+// hardware tokens. Registering nil restores the default behavior.
+func RegisterKeychainProvider(fn func(upspin.UserName) (upspin.Factotum, error)) {
+	keychain.Lock()
+	keychain.provider = fn
+	keychain.Unlock()
+}
+
+// NewFromKeychain returns a new Factotum holding the user's private key,
+// which is read from the keychain of the operating system, or obtained
+// from the provider installed by RegisterKeychainProvider, if any.
+//
+// On macOS, the key is read from the generic password item in the user's
+// login keychain whose label is the user name. On Windows, it is read from
+// the generic credential in the Credential Manager whose target name is the
+// user name. In either case the secret must hold the key as PEM data with
+// an "EC PRIVATE KEY" block, as accepted by NewFromPEM, or as PEM data
+// encoded in base64. On other systems, there is no keychain and a provider
+// must be registered.
+func NewFromKeychain(user upspin.UserName) (upspin.Factotum, error) {
+	const op = "factotum.NewFromKeychain"
+	keychain.Lock()
+	provider := keychain.provider
+	keychain.Unlock()
+	if provider != nil {
+		f, err := provider(user)
+		if err != nil {
+			return nil, errors.E(op, user, err)
+		}
+		return f, nil
+	}
+	secret, err := readKeychain(user)
+	if err != nil {
+		return nil, errors.E(op, user, err)
+	}
+	pemData := secret
+	if !strings.HasPrefix(strings.TrimSpace(string(secret)), "-----BEGIN") {
+		pemData, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(secret)))
+		if err != nil {
+			return nil, errors.E(op, user, errors.Invalid, errors.Errorf("decoding keychain item: %v", err))
+		}
+	}
+	f, err := NewFromPEM(pemData)
+	if err != nil {
+		return nil, errors.E(op, user, err)
+	}
+	return f, nil
+}
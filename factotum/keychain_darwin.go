@@ -0,0 +1,30 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package factotum
+
+import (
+	"os/exec"
+	"syscall"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// itemNotFound is the exit status of the security command
+// when the requested keychain item does not exist.
+const itemNotFound = 44
+
+// readKeychain returns the secret of the generic password item
+// labeled with the user name in the user's keychains.
+func readKeychain(user upspin.UserName) ([]byte, error) {
+	out, err := exec.Command("security", "find-generic-password", "-l", string(user), "-w").Output()
+	if err != nil {
+		if ee, ok := err.(*exec.ExitError); ok && ee.Sys().(syscall.WaitStatus).ExitStatus() == itemNotFound {
+			return nil, errors.E(errors.NotExist, errors.Errorf("no keychain item labeled %q", user))
+		}
+		return nil, errors.E(errors.IO, errors.Errorf("reading keychain: %v", err))
+	}
+	return out, nil
+}
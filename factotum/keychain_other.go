@@ -0,0 +1,17 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !darwin,!windows
+
+package factotum
+
+import (
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// readKeychain reports that this system has no keychain.
+func readKeychain(user upspin.UserName) ([]byte, error) {
+	return nil, errors.E(errors.NotExist, errors.Str("no keychain on this system; a keychain provider must be registered"))
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package factotum
+
+import (
+	"syscall"
+	"unsafe"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+var (
+	advapi32     = syscall.NewLazyDLL("advapi32.dll")
+	procCredRead = advapi32.NewProc("CredReadW")
+	procCredFree = advapi32.NewProc("CredFree")
+)
+
+const (
+	credTypeGeneric = 1                   // CRED_TYPE_GENERIC
+	errorNotFound   = syscall.Errno(1168) // ERROR_NOT_FOUND
+)
+
+// credential mirrors the Windows CREDENTIALW structure.
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        syscall.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// readKeychain returns the secret of the generic credential
+// whose target name is the user name.
+func readKeychain(user upspin.UserName) ([]byte, error) {
+	target, err := syscall.UTF16PtrFromString(string(user))
+	if err != nil {
+		return nil, errors.E(errors.Invalid, err)
+	}
+	var cred *credential
+	r, _, err := procCredRead.Call(uintptr(unsafe.Pointer(target)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&cred)))
+	if r == 0 {
+		if err == errorNotFound {
+			return nil, errors.E(errors.NotExist, errors.Errorf("no credential named %q", user))
+		}
+		return nil, errors.E(errors.IO, errors.Errorf("reading credential: %v", err))
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(cred)))
+	if cred.CredentialBlobSize == 0 || cred.CredentialBlob == nil {
+		return nil, errors.E(errors.NotExist, errors.Errorf("no key in credential %q", user))
+	}
+	secret := make([]byte, cred.CredentialBlobSize)
+	copy(secret, (*[1 << 20]byte)(unsafe.Pointer(cred.CredentialBlob))[:cred.CredentialBlobSize:cred.CredentialBlobSize])
+	return secret, nil
+}
@@ -58,12 +58,12 @@ var (
 	// caches.
 	CacheDir = defaultCacheDir
 
-	defaultCacheDir = filepath.Join(config.Home(), "upspin")
+	defaultCacheDir = config.UpspinDir()
 
 	// Config ("config") names the Upspin configuration file to use.
 	Config = defaultConfig
 
-	defaultConfig = filepath.Join(config.Home(), "upspin", "config")
+	defaultConfig = config.DefaultConfigPath()
 
 	// HTTPAddr ("http") is the network address on which to listen for
 	// incoming insecure network connections.
@@ -82,7 +82,7 @@ var (
 	// should be owner-accessible only (chmod 0700).
 	LetsEncryptCache = defaultLetsEncryptCache
 
-	defaultLetsEncryptCache = filepath.Join(config.Home(), "upspin", "letsencrypt")
+	defaultLetsEncryptCache = filepath.Join(config.UpspinDir(), "letsencrypt")
 
 	// Log ("log") sets the level of logging (implements flag.Value).
 	Log logFlag
@@ -91,6 +91,10 @@ var (
 	// server.
 	NetAddr = ""
 
+	// NoKeyCache ("no-key-cache") disables the on-disk cache of key server
+	// lookups.
+	NoKeyCache = false
+
 	// ServerConfig ("serverconfig") specifies configuration options for
 	// servers in "key=value" pairs.
 	ServerConfig []string
@@ -158,6 +162,17 @@ var flags = map[string]*flagVar{
 		},
 		arg: func() string { return strArg("serverconfig", configFlag{&ServerConfig}.String(), "") },
 	},
+	"no-key-cache": &flagVar{
+		set: func() {
+			flag.BoolVar(&NoKeyCache, "no-key-cache", false, "disable the on-disk cache of key server lookups")
+		},
+		arg: func() string {
+			if !NoKeyCache {
+				return ""
+			}
+			return "-no-key-cache"
+		},
+	},
 	"prudent": &flagVar{
 		set: func() {
 			flag.BoolVar(&Prudent, "prudent", false, "protect against malicious directory server")
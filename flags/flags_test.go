@@ -0,0 +1,44 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package flags
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const childEnv = "FLAGS_CHILD_PROCESS"
+
+// TestUpspinHome checks, in a child process started with UPSPIN_HOME set,
+// that the default cache directories are within the Upspin home directory.
+// A child process is needed because the defaults are set at initialization.
+func TestUpspinHome(t *testing.T) {
+	if os.Getenv(childEnv) == "true" {
+		fmt.Println(defaultCacheDir)
+		fmt.Println(defaultLetsEncryptCache)
+		return
+	}
+	home := filepath.Join(os.TempDir(), "upspinhome")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestUpspinHome$")
+	cmd.Env = []string{childEnv + "=true", "UPSPIN_HOME=" + home}
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("child process: %v", err)
+	}
+	lines := strings.Split(string(out), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("child process output %q, want two lines", out)
+	}
+	if got, want := lines[0], home; got != want {
+		t.Errorf("default CacheDir = %q, want %q", got, want)
+	}
+	if got, want := lines[1], filepath.Join(home, "letsencrypt"); got != want {
+		t.Errorf("default LetsEncryptCache = %q, want %q", got, want)
+	}
+}
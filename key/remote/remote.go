@@ -87,7 +87,7 @@ func (r *remote) Dial(config upspin.Config, e upspin.Endpoint) (upspin.Service,
 		return nil, op.error(errors.Invalid, errors.Str("unrecognized transport"))
 	}
 
-	authClient, err := rpc.NewClient(config, e.NetAddr, rpc.Secure, upspin.Endpoint{})
+	authClient, err := rpc.NewServerClient(config, "keyserver", e.NetAddr, rpc.Secure, upspin.Endpoint{})
 	if err != nil {
 		return nil, op.error(errors.IO, err)
 	}
@@ -23,6 +23,10 @@ import (
 type entry struct {
 	expires time.Time // when the information expires.
 	user    *upspin.User
+
+	// saveUntil is when the copy of the entry saved to disk expires.
+	// It is zero if the entry is not to be saved.
+	saveUntil time.Time
 }
 
 type userCacheServer struct {
@@ -50,6 +54,10 @@ var _ upspin.KeyServer = (*userCacheServer)(nil)
 type userCache struct {
 	entries  *cache.LRU
 	duration time.Duration
+
+	// disk, if non-nil, identifies the file that holds
+	// the persistent copy of the cache.
+	disk *diskCache
 }
 
 const (
@@ -82,12 +90,13 @@ func (c *userCacheServer) Lookup(name upspin.UserName) (*upspin.User, error) {
 	const op = "key/usercache.Lookup"
 
 	// If we have an unexpired cache entry, use it.
+	// An expired one is replaced below; until then it may
+	// still be saved to disk, if its copy there is current.
 	if v, ok := c.cache.entries.Get(name); ok {
 		if !time.Now().After(v.(*entry).expires) {
 			e := v.(*entry)
 			return e.user, nil
 		}
-		c.cache.entries.Remove(name)
 	}
 
 	// Not found, look it up.
@@ -98,11 +107,16 @@ func (c *userCacheServer) Lookup(name upspin.UserName) (*upspin.User, error) {
 	if err != nil {
 		return nil, errors.E(op, err)
 	}
+	now := time.Now()
 	e := &entry{
-		expires: time.Now().Add(c.cache.duration),
+		expires: now.Add(c.cache.duration),
 		user:    u,
 	}
+	if c.cache.disk != nil {
+		e.saveUntil = now.Add(c.cache.disk.duration)
+	}
 	c.cache.entries.Add(name, e)
+	c.cache.scheduleSave()
 	return u, nil
 }
 
@@ -116,6 +130,7 @@ func (c *userCacheServer) Put(user *upspin.User) error {
 		return errors.E(op, err)
 	}
 	c.cache.entries.Remove(user.Name)
+	c.cache.scheduleSave()
 	return nil
 }
 
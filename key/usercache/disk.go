@@ -0,0 +1,204 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package usercache
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"upspin.io/errors"
+	"upspin.io/log"
+	"upspin.io/shutdown"
+	"upspin.io/upspin"
+)
+
+const (
+	// diskDuration is the expiration time of the entries
+	// saved to the file that backs a cache.
+	diskDuration = 24 * time.Hour
+
+	// evictInterval is how often expired entries are removed
+	// from a cache backed by a file.
+	evictInterval = time.Hour
+
+	// saveDelay is how long after a change to the cache its file
+	// is rewritten, so that a burst of changes is saved at once.
+	saveDelay = 5 * time.Second
+)
+
+// diskCache records the name of the file that backs a userCache.
+type diskCache struct {
+	mu       sync.Mutex // Serializes reads and writes of file.
+	file     string
+	duration time.Duration // Expiration time of the entries saved to file.
+
+	pendingMu sync.Mutex
+	pending   bool // Whether a save has been scheduled.
+}
+
+// diskEntry is the representation of a cache entry in the file.
+type diskEntry struct {
+	Expires time.Time
+	User    *upspin.User
+}
+
+// EnableDiskCache makes the global cache persist the results of Lookups in
+// the named file, so they may be reused by later processes. The entries
+// saved to and loaded from the file expire after 24 hours, while results
+// held only in memory expire as usual; expired entries are evicted in the
+// background. Changes are written to the file shortly after they are made,
+// and when the process shuts down. If the file does not exist it will be
+// created when the first entry is added to the cache.
+func EnableDiskCache(file string) error {
+	const op = "key/usercache.EnableDiskCache"
+	globalCache.disk = &diskCache{file: file, duration: diskDuration}
+	if err := globalCache.load(); err != nil {
+		return errors.E(op, err)
+	}
+	shutdown.Handle(globalCache.flush)
+	go globalCache.evictLoop(evictInterval)
+	return nil
+}
+
+// load adds the unexpired entries in the cache's file to the cache.
+func (c *userCache) load() error {
+	c.disk.mu.Lock()
+	defer c.disk.mu.Unlock()
+	data, err := ioutil.ReadFile(c.disk.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	var entries []diskEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return errors.E(errors.Invalid, errors.Errorf("parsing %s: %v", c.disk.file, err))
+	}
+	now := time.Now()
+	for _, e := range entries {
+		if e.User == nil || now.After(e.Expires) {
+			continue
+		}
+		c.entries.Add(e.User.Name, &entry{
+			expires:   e.Expires,
+			user:      e.User,
+			saveUntil: e.Expires,
+		})
+	}
+	return nil
+}
+
+// save writes the unexpired entries that came from the underlying key
+// server to the cache's file, if there is one. The file is written to
+// a temporary file first and then renamed, so that a concurrent process
+// never sees a partially written cache.
+func (c *userCache) save() error {
+	if c.disk == nil {
+		return nil
+	}
+	var entries []diskEntry
+	now := time.Now()
+	for it := c.entries.NewIterator(); ; {
+		_, v, ok := it.GetAndAdvance()
+		if !ok {
+			break
+		}
+		e := v.(*entry)
+		if e.saveUntil.IsZero() || now.After(e.saveUntil) {
+			continue
+		}
+		entries = append(entries, diskEntry{Expires: e.saveUntil, User: e.user})
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+
+	c.disk.mu.Lock()
+	defer c.disk.mu.Unlock()
+	tmp, err := ioutil.TempFile(filepath.Dir(c.disk.file), filepath.Base(c.disk.file))
+	if err != nil {
+		return errors.E(errors.IO, err)
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.disk.file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.E(errors.IO, err)
+	}
+	return nil
+}
+
+// scheduleSave arranges for the cache's file, if there is one, to be
+// rewritten after saveDelay, unless that is already arranged.
+func (c *userCache) scheduleSave() {
+	if c.disk == nil {
+		return
+	}
+	c.disk.pendingMu.Lock()
+	defer c.disk.pendingMu.Unlock()
+	if c.disk.pending {
+		return
+	}
+	c.disk.pending = true
+	time.AfterFunc(saveDelay, c.flush)
+}
+
+// flush rewrites the cache's file if a save has been scheduled.
+func (c *userCache) flush() {
+	if c.disk == nil {
+		return
+	}
+	c.disk.pendingMu.Lock()
+	pending := c.disk.pending
+	c.disk.pending = false
+	c.disk.pendingMu.Unlock()
+	if !pending {
+		return
+	}
+	if err := c.save(); err != nil {
+		log.Error.Printf("key/usercache: saving cache: %v", err)
+	}
+}
+
+// evict removes the entries that have expired both in memory and on disk
+// from the cache and, if any were removed, rewrites its file.
+func (c *userCache) evict() {
+	var expired []interface{}
+	now := time.Now()
+	for it := c.entries.NewIterator(); ; {
+		k, v, ok := it.GetAndAdvance()
+		if !ok {
+			break
+		}
+		if e := v.(*entry); now.After(e.expires) && !now.Before(e.saveUntil) {
+			expired = append(expired, k)
+		}
+	}
+	for _, k := range expired {
+		c.entries.Remove(k)
+	}
+	if len(expired) > 0 {
+		c.scheduleSave()
+	}
+	c.flush()
+}
+
+// evictLoop calls evict at the given interval. It never returns.
+func (c *userCache) evictLoop(interval time.Duration) {
+	for range time.Tick(interval) {
+		c.evict()
+	}
+}
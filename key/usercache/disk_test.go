@@ -0,0 +1,122 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package usercache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"upspin.io/cache"
+	"upspin.io/config"
+	"upspin.io/upspin"
+)
+
+// setupDisk returns a cached KeyServer whose cache is backed by the named
+// file, with entries saved there expiring after the given duration.
+func setupDisk(t *testing.T, file string, duration time.Duration) (upspin.KeyServer, *userCache) {
+	c := config.New()
+	c = config.SetUserName(c, "disk@nowhere.com")
+	c = config.SetKeyEndpoint(c, keyService.endpoint)
+	uc := &userCache{
+		entries:  cache.NewLRU(256),
+		duration: defaultDuration,
+		disk:     &diskCache{file: file, duration: duration},
+	}
+	if err := uc.load(); err != nil {
+		t.Fatal(err)
+	}
+	svc, err := (&userCacheServer{base: keyService, cache: uc}).Dial(c, keyService.endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return svc.(upspin.KeyServer), uc
+}
+
+func TestDiskCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "usercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "keycache")
+
+	// Populate the file. It is not written until the cache is flushed.
+	c, uc := setupDisk(t, file, time.Hour)
+	start := time.Now()
+	try(t, keyService, c, "a@a.com")
+	try(t, keyService, c, "b@b.com")
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("cache file written before flush: %v", err)
+	}
+	uc.flush()
+
+	// Entries in memory keep their usual expiration time;
+	// only the copies on disk last longer.
+	v, ok := uc.entries.Get(upspin.UserName("a@a.com"))
+	if !ok {
+		t.Fatal("a@a.com not in cache")
+	}
+	if e := v.(*entry); e.expires.After(start.Add(defaultDuration+time.Minute)) || e.saveUntil.Before(start.Add(time.Hour)) {
+		t.Errorf("entry expires at %v and is saved until %v; want about %v and %v", e.expires, e.saveUntil, start.Add(defaultDuration), start.Add(time.Hour))
+	}
+
+	// A new cache backed by the same file should not need the key server.
+	c, _ = setupDisk(t, file, time.Hour)
+	sofar := keyService.lookups
+	for _, name := range []upspin.UserName{"a@a.com", "b@b.com"} {
+		u, err := c.Lookup(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if u.PublicKey != upspin.PublicKey(name+".key") {
+			t.Errorf("Lookup(%q) key = %q, want %q", name, u.PublicKey, name+".key")
+		}
+	}
+	if keyService.lookups != sofar {
+		t.Errorf("got %d lookups of the key server, want none", keyService.lookups-sofar)
+	}
+
+	// Expired entries are not loaded.
+	c, uc = setupDisk(t, file, -time.Hour)
+	try(t, keyService, c, "c@c.com")
+	uc.flush()
+	c, _ = setupDisk(t, file, time.Hour)
+	sofar = keyService.lookups
+	if _, err := c.Lookup("c@c.com"); err != nil {
+		t.Fatal(err)
+	}
+	if keyService.lookups != sofar+1 {
+		t.Errorf("got %d lookups of the key server, want 1", keyService.lookups-sofar)
+	}
+}
+
+func TestDiskCacheEvict(t *testing.T) {
+	dir, err := ioutil.TempDir("", "usercache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	uc := &userCache{
+		entries: cache.NewLRU(256),
+		disk:    &diskCache{file: filepath.Join(dir, "keycache")},
+	}
+	now := time.Now()
+	uc.entries.Add(upspin.UserName("old@a.com"), &entry{expires: now.Add(-time.Minute), saveUntil: now.Add(-time.Minute)})
+	uc.entries.Add(upspin.UserName("new@a.com"), &entry{expires: now.Add(time.Minute), saveUntil: now.Add(time.Minute)})
+	uc.entries.Add(upspin.UserName("disk@a.com"), &entry{expires: now.Add(-time.Minute), saveUntil: now.Add(time.Minute)})
+	uc.evict()
+	if _, ok := uc.entries.Get(upspin.UserName("old@a.com")); ok {
+		t.Error("expired entry was not evicted")
+	}
+	if _, ok := uc.entries.Get(upspin.UserName("new@a.com")); !ok {
+		t.Error("unexpired entry was evicted")
+	}
+	if _, ok := uc.entries.Get(upspin.UserName("disk@a.com")); !ok {
+		t.Error("entry with an unexpired copy on disk was evicted")
+	}
+}
@@ -13,11 +13,13 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"strings"
 	"sync"
 	"time"
 
 	"upspin.io/bind"
+	"upspin.io/config"
 	"upspin.io/errors"
 	"upspin.io/log"
 	"upspin.io/rpc/local"
@@ -82,6 +84,7 @@ type httpClient struct {
 	client   *http.Client
 	baseURL  string
 	proxyFor upspin.Endpoint // the server is a proxy for this endpoint.
+	host     string          // the server's host, for config.Credentials; empty if insecure.
 
 	clientAuth
 }
@@ -93,7 +96,19 @@ type httpClient struct {
 // it indicates that this connection is being used to proxy request to that
 // endpoint.
 func NewClient(cfg upspin.Config, netAddr upspin.NetAddr, security SecurityLevel, proxyFor upspin.Endpoint) (Client, error) {
+	return NewServerClient(cfg, "", netAddr, security, proxyFor)
+}
+
+// NewServerClient is like NewClient but also names the config key of the
+// server being dialed: "keyserver", "dirserver", "storeserver", or "cache".
+// If the config names a server of that kind at netAddr, the timeout and
+// TLS server name set in the config for it apply to the connection;
+// otherwise, as with NewClient, the defaults are used.
+func NewServerClient(cfg upspin.Config, server string, netAddr upspin.NetAddr, security SecurityLevel, proxyFor upspin.Endpoint) (Client, error) {
 	const op = "rpc.NewClient"
+	if !isConfiguredServer(cfg, server, netAddr) {
+		server = ""
+	}
 
 	c := &httpClient{
 		proxyFor: proxyFor,
@@ -109,19 +124,27 @@ func NewClient(cfg upspin.Config, netAddr upspin.NetAddr, security SecurityLevel
 		}
 		c.baseURL = "http://" + string(netAddr)
 	case Secure:
-		tlsConfig = &tls.Config{RootCAs: cfg.CertPool()}
+		tlsConfig = &tls.Config{
+			RootCAs:    cfg.CertPool(),
+			ServerName: tlsServerName(cfg, server, netAddr),
+		}
 		c.baseURL = "https://" + string(netAddr)
+		// Credentials are sent only over TLS.
+		c.host = string(netAddr)
+		if host, _, err := net.SplitHostPort(string(netAddr)); err == nil {
+			c.host = host
+		}
 	default:
 		return nil, errors.E(op, errors.Invalid, errors.Errorf("invalid security level to NewClient: %v", security))
 	}
 
 	t := &http.Transport{
 		TLSClientConfig: tlsConfig,
+		Proxy:           proxyFunc(cfg, security),
 		// The following values are the same as
 		// net/http.DefaultTransport.
-		Proxy: http.ProxyFromEnvironment,
 		DialContext: (&local.Dialer{
-			Timeout:   30 * time.Second,
+			Timeout:   dialTimeout(cfg, server),
 			KeepAlive: 30 * time.Second,
 		}).DialContext,
 		MaxIdleConns:          100,
@@ -138,6 +161,70 @@ func NewClient(cfg upspin.Config, netAddr upspin.NetAddr, security SecurityLevel
 	return c, nil
 }
 
+// isConfiguredServer reports whether the config names a server of the
+// given kind, such as "dirserver", at the given address.
+func isConfiguredServer(cfg upspin.Config, server string, netAddr upspin.NetAddr) bool {
+	var eps []upspin.Endpoint
+	switch server {
+	case "keyserver":
+		eps = []upspin.Endpoint{cfg.KeyEndpoint()}
+	case "dirserver":
+		eps = []upspin.Endpoint{cfg.DirEndpoint()}
+	case "storeserver":
+		eps = config.StoreEndpoints(cfg)
+	case "cache":
+		eps = []upspin.Endpoint{cfg.CacheEndpoint()}
+	}
+	for _, ep := range eps {
+		if ep.NetAddr == netAddr {
+			return true
+		}
+	}
+	return false
+}
+
+// dialTimeout returns the time allowed to connect to the named server:
+// the timeout set in the config for it or, if server is empty,
+// config.DefaultDialTimeout.
+func dialTimeout(cfg upspin.Config, server string) time.Duration {
+	if server != "" {
+		return config.EndpointTimeout(cfg, server)
+	}
+	return config.DefaultDialTimeout
+}
+
+// tlsServerName returns the name to expect in the TLS certificate of the
+// named server at the given address: the name set in the config for that
+// server, if any, or else the host portion of the address.
+func tlsServerName(cfg upspin.Config, server string, netAddr upspin.NetAddr) string {
+	if server != "" {
+		if host := config.TLSServerName(cfg, server); host != "" {
+			return host
+		}
+	}
+	host, _, err := net.SplitHostPort(string(netAddr))
+	if err != nil {
+		return string(netAddr)
+	}
+	return host
+}
+
+// proxyFunc returns the function that selects the proxy through which the
+// transport connects. If the config has a proxy key, it is used, except
+// for insecure connections, which are only made to the loopback network.
+// Otherwise the proxy is chosen from the environment variables HTTPS_PROXY,
+// HTTP_PROXY, and NO_PROXY, as config.ProxyURL describes.
+func proxyFunc(cfg upspin.Config, security SecurityLevel) func(*http.Request) (*url.URL, error) {
+	if cfg.Value("proxy") == "" {
+		return http.ProxyFromEnvironment
+	}
+	u := config.ProxyURL(cfg)
+	if u == nil || security == NoSecurity {
+		return nil
+	}
+	return http.ProxyURL(u)
+}
+
 func (c *httpClient) makeAuthenticatedRequest(op, method string, req pb.Message) (*http.Response, bool, error) {
 	token, haveToken := c.authToken()
 	header := make(http.Header)
@@ -177,6 +264,11 @@ func (c *httpClient) makeRequest(op, method string, req pb.Message, header http.
 		return nil, errors.E(op, errors.Invalid, err)
 	}
 	httpReq.Header = header
+	if c.host != "" {
+		if user, password, ok := config.Credentials(c.config, c.host); ok {
+			httpReq.SetBasicAuth(user, password)
+		}
+	}
 	resp, err := c.client.Do(httpReq)
 	if err != nil {
 		return nil, errors.E(op, errors.IO, err)
@@ -224,7 +316,12 @@ func (c *httpClient) Invoke(method string, req, resp pb.Message, stream Response
 				c.invalidateSession()
 				continue
 			}
-			return errors.E(op, errors.IO, errors.Errorf("%s: %s", httpResp.Status, msg))
+			kind := errors.IO
+			if httpResp.StatusCode == http.StatusNotFound {
+				// The server does not provide the method.
+				kind = errors.NotExist
+			}
+			return errors.E(op, kind, errors.Errorf("%s: %s", httpResp.Status, msg))
 		}
 		break
 	}
@@ -0,0 +1,111 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"upspin.io/config"
+	"upspin.io/upspin"
+	"upspin.io/upspin/proto"
+)
+
+func TestServerSettings(t *testing.T) {
+	// The directory and store servers share a host.
+	cfg := config.New()
+	cfg = config.SetDirEndpoint(cfg, upspin.Endpoint{Transport: upspin.Remote, NetAddr: "proxy.example.com:443"})
+	cfg = config.SetStoreEndpoint(cfg, upspin.Endpoint{Transport: upspin.Remote, NetAddr: "proxy.example.com:443"})
+	cfg = config.SetValue(cfg, "dirserver_tls_name", "dir.example.com")
+	cfg = config.SetValue(cfg, "dirserver_timeout", "5s")
+	cfg = config.SetValue(cfg, "storeserver_timeout", "1m")
+
+	tests := []struct {
+		server  string
+		addr    upspin.NetAddr
+		name    string
+		timeout time.Duration
+	}{
+		// The settings in the config for the server.
+		{"dirserver", "proxy.example.com:443", "dir.example.com", 5 * time.Second},
+		// No name set: the host in the address.
+		{"storeserver", "proxy.example.com:443", "proxy.example.com", time.Minute},
+		// Not a server named in the config.
+		{"storeserver", "other.example.com:443", "other.example.com", config.DefaultDialTimeout},
+		{"", "proxy.example.com:443", "proxy.example.com", config.DefaultDialTimeout},
+	}
+	for _, test := range tests {
+		server := test.server
+		if !isConfiguredServer(cfg, server, test.addr) {
+			server = ""
+		}
+		if got := tlsServerName(cfg, server, test.addr); got != test.name {
+			t.Errorf("%s at %s: TLS name %q, want %q", test.server, test.addr, got, test.name)
+		}
+		if got := dialTimeout(cfg, server); got != test.timeout {
+			t.Errorf("%s at %s: timeout %v, want %v", test.server, test.addr, got, test.timeout)
+		}
+	}
+}
+
+func TestCredentialsHeader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	netrc := filepath.Join(dir, "netrc")
+	if err := ioutil.WriteFile(netrc, []byte("machine 127.0.0.1 login ann password secret\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var auth string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	})
+	check := func(srv *httptest.Server, security SecurityLevel, want string) {
+		addr := upspin.NetAddr(strings.TrimPrefix(strings.TrimPrefix(srv.URL, "https://"), "http://"))
+		cfg := config.SetDirEndpoint(config.New(), upspin.Endpoint{Transport: upspin.Remote, NetAddr: addr})
+		cfg = config.SetValue(cfg, "credentials_file", netrc)
+		if srv.TLS != nil {
+			cert, err := x509.ParseCertificate(srv.TLS.Certificates[0].Certificate[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			pool := x509.NewCertPool()
+			pool.AddCert(cert)
+			cfg = config.SetCertPool(cfg, pool)
+		}
+		c, err := NewClient(cfg, addr, security, upspin.Endpoint{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		auth = ""
+		resp, err := c.(*httpClient).makeRequest("test", "Ping", &proto.Endpoint{}, make(http.Header))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if auth != want {
+			t.Errorf("security %v: Authorization = %q, want %q", security, auth, want)
+		}
+	}
+
+	tlsSrv := httptest.NewTLSServer(handler)
+	defer tlsSrv.Close()
+	check(tlsSrv, Secure, "Basic YW5uOnNlY3JldA==")
+
+	// Credentials are never sent without TLS.
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+	check(srv, NoSecurity, "")
+}
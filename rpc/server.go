@@ -109,10 +109,19 @@ func NewServer(cfg upspin.Config, svc Service) http.Handler {
 		}
 	}
 
-	return &serverImpl{
+	s := &serverImpl{
 		config:  cfg,
 		service: svc,
 	}
+	// Every service serves the Users method, unless it has its own.
+	if _, ok := svc.Methods[usersMethod]; !ok {
+		methods := map[string]Method{usersMethod: s.users}
+		for name, m := range svc.Methods {
+			methods[name] = m
+		}
+		s.service.Methods = methods
+	}
+	return s
 }
 
 type serverImpl struct {
@@ -165,6 +174,7 @@ func (s *serverImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
+		recordUser(session.User())
 	}
 
 	body, err := ioutil.ReadAll(r.Body)
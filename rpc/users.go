@@ -0,0 +1,168 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	pb "github.com/golang/protobuf/proto"
+
+	"upspin.io/errors"
+	"upspin.io/upspin"
+)
+
+// usersMethod is the name of the method, served by every Service,
+// that returns the statistics recorded by the server. Only the user
+// running the server may call it.
+const usersMethod = "Users"
+
+// UserStats describes the requests made to the servers in this process
+// by a single authenticated user.
+type UserStats struct {
+	User     upspin.UserName
+	Requests int64     // Number of authenticated requests.
+	LastSeen time.Time // Time of the most recent request, in UTC.
+}
+
+// userStats holds the UserStats for every user seen, keyed by user name.
+var userStats = struct {
+	sync.Mutex
+	m map[upspin.UserName]*UserStats
+}{
+	m: make(map[upspin.UserName]*UserStats),
+}
+
+// recordUser notes that the server handled a request for the given user.
+func recordUser(user upspin.UserName) {
+	if user == "" {
+		return
+	}
+	now := time.Now().UTC()
+	userStats.Lock()
+	defer userStats.Unlock()
+	s, ok := userStats.m[user]
+	if !ok {
+		s = &UserStats{User: user}
+		userStats.m[user] = s
+	}
+	s.Requests++
+	s.LastSeen = now
+}
+
+// Users returns the statistics for every authenticated user that has made
+// a request to the servers in this process at or after the given time,
+// sorted by user name. The zero time selects all users seen since the
+// process started.
+func Users(since time.Time) []UserStats {
+	userStats.Lock()
+	defer userStats.Unlock()
+	var users []UserStats
+	for _, s := range userStats.m {
+		if s.LastSeen.Before(since) {
+			continue
+		}
+		users = append(users, *s)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].User < users[j].User })
+	return users
+}
+
+// resetUsers forgets all recorded users. It is used in tests.
+func resetUsers() {
+	userStats.Lock()
+	userStats.m = make(map[upspin.UserName]*UserStats)
+	userStats.Unlock()
+}
+
+// The request and response messages of the Users method. They are
+// written by hand, in the form generated by protoc, as they are private
+// to this package.
+
+type usersRequest struct {
+	// Since is the earliest last-seen time of the users to list,
+	// in Unix nanoseconds.
+	Since int64 `protobuf:"varint,1,opt,name=since,proto3" json:"since,omitempty"`
+}
+
+func (m *usersRequest) Reset()         { *m = usersRequest{} }
+func (m *usersRequest) String() string { return pb.CompactTextString(m) }
+func (*usersRequest) ProtoMessage()    {}
+
+type usersResponse struct {
+	Users []*userStatsMessage `protobuf:"bytes,1,rep,name=users" json:"users,omitempty"`
+	Error []byte              `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (m *usersResponse) Reset()         { *m = usersResponse{} }
+func (m *usersResponse) String() string { return pb.CompactTextString(m) }
+func (*usersResponse) ProtoMessage()    {}
+
+type userStatsMessage struct {
+	User     string `protobuf:"bytes,1,opt,name=user,proto3" json:"user,omitempty"`
+	Requests int64  `protobuf:"varint,2,opt,name=requests,proto3" json:"requests,omitempty"`
+	LastSeen int64  `protobuf:"varint,3,opt,name=last_seen,json=lastSeen,proto3" json:"last_seen,omitempty"` // Unix nanoseconds.
+}
+
+func (m *userStatsMessage) Reset()         { *m = userStatsMessage{} }
+func (m *userStatsMessage) String() string { return pb.CompactTextString(m) }
+func (*userStatsMessage) ProtoMessage()    {}
+
+// users implements the Users method for the server.
+func (s *serverImpl) users(session Session, reqBytes []byte) (pb.Message, error) {
+	const op = "rpc.Users"
+	var req usersRequest
+	if err := pb.Unmarshal(reqBytes, &req); err != nil {
+		return nil, err
+	}
+	if owner := s.config.UserName(); session.User() != owner {
+		err := errors.E(op, session.User(), errors.Permission, errors.Errorf("only %s may list users", owner))
+		return &usersResponse{Error: errors.MarshalError(err)}, nil
+	}
+	var since time.Time
+	if req.Since != 0 {
+		since = time.Unix(0, req.Since)
+	}
+	resp := new(usersResponse)
+	for _, u := range Users(since) {
+		resp.Users = append(resp.Users, &userStatsMessage{
+			User:     string(u.User),
+			Requests: u.Requests,
+			LastSeen: u.LastSeen.UnixNano(),
+		})
+	}
+	return resp, nil
+}
+
+// ListUsers asks the server to which the client is connected for the
+// statistics it has recorded for users seen at or after the given time,
+// as reported by Users on the server. The service names one of the
+// services of the server, such as "Dir"; as the statistics cover the
+// whole server process, any one of its services will do. The user of
+// the client must be the user running the server.
+func ListUsers(c Client, service string, since time.Time) ([]UserStats, error) {
+	const op = "rpc.ListUsers"
+	req := new(usersRequest)
+	if !since.IsZero() {
+		req.Since = since.UnixNano()
+	}
+	resp := new(usersResponse)
+	if err := c.Invoke(service+"/"+usersMethod, req, resp, nil, nil); err != nil {
+		return nil, errors.E(op, err)
+	}
+	if len(resp.Error) != 0 {
+		return nil, errors.E(op, errors.UnmarshalError(resp.Error))
+	}
+	users := make([]UserStats, len(resp.Users))
+	for i, u := range resp.Users {
+		users[i] = UserStats{
+			User:     upspin.UserName(u.User),
+			Requests: u.Requests,
+			LastSeen: time.Unix(0, u.LastSeen).UTC(),
+		}
+	}
+	return users, nil
+}
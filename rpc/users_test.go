@@ -0,0 +1,107 @@
+// Copyright 2017 The Upspin Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rpc
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"upspin.io/config"
+	"upspin.io/errors"
+	"upspin.io/factotum"
+	"upspin.io/upspin"
+)
+
+func TestUsers(t *testing.T) {
+	resetUsers()
+	defer resetUsers()
+
+	recordUser("bob@example.com")
+	recordUser("alice@example.com")
+	recordUser("bob@example.com")
+	recordUser("") // Ignored.
+
+	users := Users(time.Time{})
+	if len(users) != 2 {
+		t.Fatalf("got %d users, want 2: %v", len(users), users)
+	}
+	if users[0].User != "alice@example.com" || users[0].Requests != 1 {
+		t.Errorf("users[0] = %+v, want alice@example.com with 1 request", users[0])
+	}
+	if users[1].User != "bob@example.com" || users[1].Requests != 2 {
+		t.Errorf("users[1] = %+v, want bob@example.com with 2 requests", users[1])
+	}
+
+	if users := Users(time.Now().Add(time.Hour)); len(users) != 0 {
+		t.Errorf("got %d users seen in the future, want 0", len(users))
+	}
+}
+
+func TestListUsers(t *testing.T) {
+	resetUsers()
+	defer resetUsers()
+
+	userConfig := func(name upspin.UserName, keys string) upspin.Config {
+		f, err := factotum.NewFromDir("../key/testdata/" + keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config.SetFactotum(config.SetUserName(config.New(), name), f)
+	}
+	owner := userConfig("user1@google.com", "user1")
+	other := userConfig("bob@example.com", "bob")
+	lookup := func(name upspin.UserName) (upspin.PublicKey, error) {
+		for _, cfg := range []upspin.Config{owner, other} {
+			if cfg.UserName() == name {
+				return cfg.Factotum().PublicKey(), nil
+			}
+		}
+		return "", errors.E(name, errors.NotExist)
+	}
+	srv := httptest.NewServer(NewServer(owner, Service{Name: "Test", Lookup: lookup}))
+	defer srv.Close()
+	addr := upspin.NetAddr(strings.TrimPrefix(srv.URL, "http://"))
+
+	client := func(cfg upspin.Config) Client {
+		c, err := NewClient(cfg, addr, NoSecurity, upspin.Endpoint{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	// Another user may not list the users, but is recorded trying.
+	if _, err := ListUsers(client(other), "Test", time.Time{}); !errors.Match(errors.E(errors.Permission), err) {
+		t.Errorf("ListUsers as another user: err = %v, want Permission error", err)
+	}
+
+	start := time.Now()
+	users, err := ListUsers(client(owner), "Test", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].User != "bob@example.com" || users[1].User != "user1@google.com" {
+		t.Fatalf("ListUsers = %v, want bob@example.com and user1@google.com", users)
+	}
+	if users[1].Requests != 1 {
+		t.Errorf("owner made %d requests, want 1", users[1].Requests)
+	}
+
+	// Only the owner has been seen since the start of its request.
+	users, err = ListUsers(client(owner), "Test", start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 1 || users[0].User != "user1@google.com" {
+		t.Errorf("ListUsers(since) = %v, want only user1@google.com", users)
+	}
+
+	// A service the server does not provide is reported as missing.
+	if _, err := ListUsers(client(owner), "Nonesuch", time.Time{}); !errors.Match(errors.E(errors.NotExist), err) {
+		t.Errorf("ListUsers for missing service: err = %v, want NotExist error", err)
+	}
+}
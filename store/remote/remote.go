@@ -119,7 +119,7 @@ func dialCache(op *operation, config upspin.Config, proxyFor upspin.Endpoint) up
 	}
 
 	// Call the cache. The cache is local so don't bother with TLS.
-	authClient, err := rpc.NewClient(config, ce.NetAddr, rpc.NoSecurity, proxyFor)
+	authClient, err := rpc.NewServerClient(config, "cache", ce.NetAddr, rpc.NoSecurity, proxyFor)
 	if err != nil {
 		// On error dial direct.
 		op.error(errors.IO, err)
@@ -149,7 +149,7 @@ func (r *remote) Dial(config upspin.Config, e upspin.Endpoint) (upspin.Service,
 	}
 
 	// Call the server directly.
-	authClient, err := rpc.NewClient(config, e.NetAddr, rpc.Secure, upspin.Endpoint{})
+	authClient, err := rpc.NewServerClient(config, "storeserver", e.NetAddr, rpc.Secure, upspin.Endpoint{})
 	if err != nil {
 		return nil, op.error(errors.IO, err)
 	}
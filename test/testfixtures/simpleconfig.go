@@ -84,3 +84,8 @@ func (cfg *simpleConfig) CertPool() *x509.CertPool {
 func (cfg *simpleConfig) Flags(string) map[string]string {
 	return nil
 }
+
+// Value implements upspin.Config.
+func (cfg *simpleConfig) Value(string) string {
+	return ""
+}
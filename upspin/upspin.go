@@ -746,6 +746,10 @@ type Config interface {
 
 	// Flags returns the configured command flags for the named command.
 	Flags(cmd string) map[string]string
+
+	// Value returns the value for the given configuration key,
+	// or the empty string if the key is not set.
+	Value(key string) string
 }
 
 // Dialer defines how to connect and authenticate to a server. Each